@@ -0,0 +1,50 @@
+package introspection
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// AccessLogEntry describes the authentication outcome of a single request, see WithAccessLog
+type AccessLogEntry struct {
+	// TokenFingerprint identifies the token without revealing it, it is empty when the request carried no usable token
+	TokenFingerprint string
+	Active           bool
+	Scopes           []string
+	Subject          string
+	// Err is the error FromContext returned for the request, if any
+	Err error
+	// Latency is the time spent obtaining the introspection result, including cache lookups
+	Latency time.Duration
+}
+
+// WithAccessLog calls log with an entry for every request the middleware handles, successful or not, once the rest of the chain has run
+func WithAccessLog(log func(AccessLogEntry)) Option {
+	return func(opt *Options) {
+		opt.accessLog = log
+	}
+}
+
+func newAccessLogEntry(token string, res *result, latency time.Duration) AccessLogEntry {
+	entry := AccessLogEntry{
+		Err:     res.Err,
+		Latency: latency,
+	}
+
+	if token != "" {
+		entry.TokenFingerprint = fingerprint(token)
+	}
+
+	if res.Result != nil {
+		entry.Active = res.Result.Active
+		entry.Scopes = res.Result.Scopes()
+		entry.Subject = res.Result.stringClaim("sub")
+	}
+
+	return entry
+}
+
+// fingerprint returns a short, non reversible identifier of token suitable for logs
+func fingerprint(token string) string {
+	return hex.EncodeToString(hashToken(token)[:8])
+}
@@ -0,0 +1,198 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	// ErrNoActorToken is returned by ActorFromContext when the request carried no actor token, see WithActorToken
+	ErrNoActorToken = errors.New("no actor token")
+	// ErrInactiveActor is used to reject requests with an inactive actor token when enforcement is enabled
+	ErrInactiveActor = errors.New("actor token is not active")
+	// ErrNoActClaim is returned by Result.Actor when the result carries no act claim, i.e. the token is not delegated
+	ErrNoActClaim = errors.New("result has no act claim")
+)
+
+// maxActDepth is the number of nested act claims Result.Actor decodes before failing
+const maxActDepth = 8
+
+// Actor is the act claim of a delegated token, as per rfc8693 section 4.1, identifying the current actor. Prior actors of a
+// delegation chain are nested in Actor.
+type Actor struct {
+	Sub      string
+	ClientID string
+	// Actor is the prior actor, nil at the end of the chain
+	Actor *Actor
+}
+
+// Actor decodes the act claim, including its nested prior actors up to 8 levels deep. It returns ErrNoActClaim when the result
+// carries none, and an error when an act claim is not an object or the chain is nested deeper.
+func (r *Result) Actor() (*Actor, error) {
+	raw, ok := r.Optionals["act"]
+	if !ok || string(raw) == "null" {
+		return nil, ErrNoActClaim
+	}
+
+	var first *Actor
+	for next, depth := &first, 1; raw != nil && string(raw) != "null"; depth++ {
+		if depth > maxActDepth {
+			return nil, fmt.Errorf("act claim is nested deeper than %d levels", maxActDepth)
+		}
+
+		var act struct {
+			Sub      string          `json:"sub"`
+			ClientID string          `json:"client_id"`
+			Act      json.RawMessage `json:"act"`
+		}
+
+		if err := json.Unmarshal(raw, &act); err != nil {
+			return nil, fmt.Errorf("invalid act claim: %v", err)
+		}
+
+		*next = &Actor{Sub: act.Sub, ClientID: act.ClientID}
+		next, raw = &(*next).Actor, act.Act
+	}
+
+	return first, nil
+}
+
+// DelegationChain returns the sub claims of the actors of the act claim, from the current actor to the earliest prior actor.
+// It returns nil when the result carries no valid act claim, see Actor.
+func (r *Result) DelegationChain() []string {
+	act, err := r.Actor()
+	if err != nil {
+		return nil
+	}
+
+	var chain []string
+	for ; act != nil; act = act.Actor {
+		chain = append(chain, act.Sub)
+	}
+
+	return chain
+}
+
+// ActorPolicy decides whether requests must carry an actor token, see WithActorToken
+type ActorPolicy int
+
+const (
+	// ActorOptional accepts requests without an actor token
+	ActorOptional ActorPolicy = iota
+	// ActorRequired rejects requests without an actor token when enforcement is enabled
+	ActorRequired
+)
+
+// WithActorToken introspects the token of the acting party of a delegation, as per rfc8693, sent in header alongside the subject's
+// token, e.g. X-Actor-Token, with or without a Bearer prefix. gRPC calls carry it in the metadata of the same name in lower case.
+// The result is available through ActorFromContext. The actor token is introspected against the same endpoint, with the same
+// credentials and the same caches, though under keys of its own, but the validations and requirements only apply to the subject's
+// token. With WithEnforcement, requests whose actor token failed or is inactive are rejected, and so are requests without one
+// under ActorRequired.
+func WithActorToken(header string, policy ActorPolicy) Option {
+	return func(opt *Options) {
+		opt.actorHeader = header
+		opt.actorPolicy = policy
+	}
+}
+
+// ActorFromContext returns the introspection result of the actor token, see WithActorToken. It returns ErrNoActorToken when the
+// request carried none, or wasn't introspected because its subject token was missing or invalid.
+func ActorFromContext(ctx context.Context) (*Result, error) {
+	val, ok := ctx.Value(resKey).(*result)
+	if !ok {
+		return nil, ErrNoMiddleware
+	}
+
+	if val.actor == nil {
+		return nil, ErrNoActorToken
+	}
+
+	return val.actor.Result, val.actor.Err
+}
+
+// resolveActor introspects the actor token among values, the values of the actor header, for res, the result of the subject token
+func resolveActor(ctx context.Context, values []string, res *result, opt *Options) {
+	if res.Err != nil || res.actor != nil {
+		return
+	}
+
+	res.actorRequired = opt.actorPolicy == ActorRequired
+
+	token, err := actorToken(ctx, values, opt)
+	if err != nil {
+		res.actor = &result{Err: err}
+		return
+	}
+
+	prev, _ := ctx.Value(discriminatorKey).(string)
+	ctx = context.WithValue(ctx, discriminatorKey, "actor:"+prev)
+
+	actor, _, err := softLookupResult(ctx, token, opt)
+	if err == nil {
+		err = checkDenyList(ctx, token, actor, opt)
+	}
+
+	if err != nil {
+		res.actor = &result{Err: err}
+		return
+	}
+
+	res.actor = &result{Result: revoked(actor, opt), token: token}
+}
+
+// actorToken returns the actor token among values
+func actorToken(ctx context.Context, values []string, opt *Options) (string, error) {
+	switch {
+	case len(values) == 0:
+		return "", ErrNoActorToken
+	case len(values) > 1:
+		return "", ErrAmbiguousBearer
+	}
+
+	token := values[0]
+	if len(token) >= len("Bearer ") && strings.EqualFold(token[:len("Bearer ")], "Bearer ") {
+		token = token[len("Bearer "):]
+	}
+
+	token, err := checkToken(ctx, token, opt)
+	if err == ErrNoBearer {
+		return "", ErrNoActorToken
+	}
+
+	return token, err
+}
+
+// actorError returns the reason why the request should be rejected because of its actor token, if any
+func (r *result) actorError() error {
+	if r.actor == nil || (r.actor.Err == ErrNoActorToken && !r.actorRequired) {
+		return nil
+	}
+
+	if r.actor.Err != nil {
+		return r.actor.Err
+	}
+
+	if !r.actor.Result.Active {
+		return ErrInactiveActor
+	}
+
+	return nil
+}
+
+// actorHeaderValues returns the values of the actor header of r
+func actorHeaderValues(r *http.Request, opt *Options) []string {
+	return r.Header.Values(opt.actorHeader)
+}
+
+// actorMDValues returns the values of the actor metadata of the call ctx belongs to
+func actorMDValues(ctx context.Context, opt *Options) []string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return md.Get(strings.ToLower(opt.actorHeader))
+}
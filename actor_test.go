@@ -0,0 +1,196 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestActorToken(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		token := r.PostFormValue("token")
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": token != "inactive", "sub": token})
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name   string
+		actor  string
+		policy intro.ActorPolicy
+		status int
+		sub    string
+		err    error
+	}{
+		{name: "Both Active", actor: "Bearer service", status: http.StatusOK, sub: `"service"`},
+		{name: "Without Bearer Prefix", actor: "service", status: http.StatusOK, sub: `"service"`},
+		{name: "Actor Inactive", actor: "inactive", status: http.StatusUnauthorized},
+		{name: "Absent Optional", status: http.StatusOK, err: intro.ErrNoActorToken},
+		{name: "Absent Required", policy: intro.ActorRequired, status: http.StatusUnauthorized},
+		{name: "Required", actor: "service", policy: intro.ActorRequired, status: http.StatusOK, sub: `"service"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				actor *intro.Result
+				err   error
+			)
+
+			h := intro.Introspection(ts.URL, intro.WithActorToken("X-Actor-Token", tc.policy), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor, err = intro.ActorFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer user")
+			if tc.actor != "" {
+				req.Header.Add("X-Actor-Token", tc.actor)
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			equals(t, tc.status, rr.Code)
+			if tc.status != http.StatusOK {
+				return
+			}
+
+			equals(t, tc.err, err)
+			if tc.sub != "" {
+				equals(t, true, actor.Active)
+				equals(t, tc.sub, string(actor.Optionals["sub"]))
+			}
+		})
+	}
+
+	t.Run("Without Enforcement", func(t *testing.T) {
+		var actor *intro.Result
+
+		h := intro.Introspection(ts.URL, intro.WithActorToken("X-Actor-Token", intro.ActorRequired))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actor, _ = intro.ActorFromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer user")
+		req.Header.Add("X-Actor-Token", "inactive")
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		equals(t, http.StatusOK, rr.Code)
+		equals(t, false, actor.Active)
+	})
+
+	t.Run("Cached Independently", func(t *testing.T) {
+		hits = 0
+
+		h := intro.Introspection(ts.URL,
+			intro.WithCache(intro.NewInMemoryCache(), time.Minute),
+			intro.WithActorToken("X-Actor-Token", intro.ActorOptional),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		serve := func(actor string) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer service")
+			req.Header.Add("X-Actor-Token", actor)
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		serve("service")
+		serve("service")
+		equals(t, 2, hits)
+
+		serve("other")
+		equals(t, 3, hits)
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer user", "x-actor-token", "service"))
+
+		ctx, err := intro.AuthFunc(ts.URL, intro.WithActorToken("X-Actor-Token", intro.ActorRequired), intro.WithEnforcement())(ctx)
+		ok(t, err)
+
+		actor, err := intro.ActorFromContext(ctx)
+		ok(t, err)
+		equals(t, `"service"`, string(actor.Optionals["sub"]))
+	})
+}
+
+func TestResultActor(t *testing.T) {
+	nested := func(levels int) string {
+		act := `{"sub":"service-0"}`
+		for i := 1; i < levels; i++ {
+			act = fmt.Sprintf(`{"sub":"service-%d","act":%s}`, i, act)
+		}
+
+		return act
+	}
+
+	tt := []struct {
+		name  string
+		act   string
+		exp   *intro.Actor
+		chain []string
+		err   bool
+	}{
+		{
+			name:  "Single Level",
+			act:   `{"sub":"admin@example.com","client_id":"console"}`,
+			exp:   &intro.Actor{Sub: "admin@example.com", ClientID: "console"},
+			chain: []string{"admin@example.com"},
+		},
+		{
+			name: "Multi Level",
+			act:  `{"sub":"https://service16.example.com","act":{"sub":"https://service77.example.com","act":{"client_id":"batch"}}}`,
+			exp: &intro.Actor{
+				Sub:   "https://service16.example.com",
+				Actor: &intro.Actor{Sub: "https://service77.example.com", Actor: &intro.Actor{ClientID: "batch"}},
+			},
+			chain: []string{"https://service16.example.com", "https://service77.example.com", ""},
+		},
+		{name: "Null Prior Actor", act: `{"sub":"service","act":null}`, exp: &intro.Actor{Sub: "service"}, chain: []string{"service"}},
+		{name: "At Depth Limit", act: nested(8), chain: []string{"service-7", "service-6", "service-5", "service-4", "service-3", "service-2", "service-1", "service-0"}},
+		{name: "Beyond Depth Limit", act: nested(9), err: true},
+		{name: "Not An Object", act: `"service"`, err: true},
+		{name: "Nested Not An Object", act: `{"sub":"service","act":["other"]}`, err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &intro.Result{Optionals: map[string]json.RawMessage{"act": json.RawMessage(tc.act)}}
+
+			act, err := res.Actor()
+			if tc.err {
+				assert(t, err != nil, "expected an error")
+				equals(t, []string(nil), res.DelegationChain())
+				return
+			}
+
+			ok(t, err)
+			if tc.exp != nil {
+				equals(t, tc.exp, act)
+			}
+			equals(t, tc.chain, res.DelegationChain())
+		})
+	}
+
+	t.Run("Absent", func(t *testing.T) {
+		res := &intro.Result{Optionals: map[string]json.RawMessage{}}
+
+		_, err := res.Actor()
+
+		equals(t, intro.ErrNoActClaim, err)
+		equals(t, []string(nil), res.DelegationChain())
+	})
+}
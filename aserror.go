@@ -0,0 +1,71 @@
+package introspection
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// maxErrorExcerpt is the number of bytes of an unsuccessful response body read to build its error
+	maxErrorExcerpt = 512
+	// maxDrainBytes is the number of bytes of a response body read before closing it so the connection can be reused,
+	// longer bodies are left unread and their connection is closed
+	maxDrainBytes = 1 << 20
+)
+
+// ASError is returned by FromContext when the introspection endpoint rejected the call with an OAuth error response,
+// as per rfc6749 section 5.2, e.g. {"error": "invalid_client"}
+type ASError struct {
+	// Code is the error member, e.g. invalid_client or temporarily_unavailable
+	Code string
+	// Description is the error_description member, if any
+	Description string
+	// StatusCode is the status the introspection endpoint responded with
+	StatusCode int
+}
+
+func (e *ASError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("status does not indicate success: code: %d, error: %s", e.StatusCode, e.Code)
+	}
+
+	return fmt.Sprintf("status does not indicate success: code: %d, error: %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+// StatusError is returned by FromContext when the introspection endpoint responded with a status that doesn't indicate success
+// and a body that is not an OAuth error response, see ASError
+type StatusError struct {
+	// StatusCode is the status the introspection endpoint responded with
+	StatusCode int
+	// Body holds the first 512 bytes of the response body
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status does not indicate success: code: %d, body: %q", e.StatusCode, e.Body)
+}
+
+// statusError returns the error for an unsuccessful response with code and body. An OAuth error body yields an ASError,
+// any other body a StatusError.
+func statusError(code int, body io.Reader) error {
+	data, _ := io.ReadAll(io.LimitReader(body, maxErrorExcerpt))
+
+	var oauthErr struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.Unmarshal(data, &oauthErr); err == nil && oauthErr.Error != "" {
+		return &ASError{Code: oauthErr.Error, Description: oauthErr.ErrorDescription, StatusCode: code}
+	}
+
+	return &StatusError{StatusCode: code, Body: strings.TrimSpace(string(data))}
+}
+
+// drainAndClose reads what remains of body, up to maxDrainBytes, and closes it so the connection can be reused
+func drainAndClose(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrainBytes))
+	body.Close()
+}
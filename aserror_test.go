@@ -0,0 +1,114 @@
+package introspection_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestASError(t *testing.T) {
+	tt := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		exp         *intro.ASError
+		contains    string
+	}{
+		{
+			name:        "OAuth Error",
+			status:      http.StatusUnauthorized,
+			contentType: "application/json",
+			body:        `{"error":"invalid_client","error_description":"client authentication failed"}`,
+			exp:         &intro.ASError{Code: "invalid_client", Description: "client authentication failed", StatusCode: http.StatusUnauthorized},
+		},
+		{
+			name:        "OAuth Error Without Description",
+			status:      http.StatusServiceUnavailable,
+			contentType: "application/json",
+			body:        `{"error":"temporarily_unavailable"}`,
+			exp:         &intro.ASError{Code: "temporarily_unavailable", StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			name:        "Plain Text",
+			status:      http.StatusBadRequest,
+			contentType: "text/plain",
+			body:        "bad request\n",
+			contains:    `code: 400, body: "bad request"`,
+		},
+		{
+			name:        "JSON Without Error",
+			status:      http.StatusInternalServerError,
+			contentType: "application/json",
+			body:        `{"message":"boom"}`,
+			contains:    `code: 500, body: "{\"message\":\"boom\"}"`,
+		},
+		{
+			name:        "Long Body",
+			status:      http.StatusBadGateway,
+			contentType: "text/html",
+			body:        strings.Repeat("a", 4096),
+			contains:    `code: 502, body: "` + strings.Repeat("a", 512) + `"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer ts.Close()
+
+			_, err := intro.FromContext(introspectedContextAt(t, ts.URL))
+			assert(t, err != nil, "expected an error")
+
+			asErr, isASError := err.(*intro.ASError)
+			if tc.exp != nil {
+				assert(t, isASError, "error should be an ASError: %v", err)
+				equals(t, tc.exp, asErr)
+				return
+			}
+
+			assert(t, !isASError, "error should not be an ASError: %v", err)
+			assert(t, strings.Contains(err.Error(), tc.contains), "error %q should contain %q", err.Error(), tc.contains)
+			assert(t, !strings.Contains(err.Error(), strings.Repeat("a", 513)), "error should hold an excerpt of the body")
+		})
+	}
+}
+
+func TestStatusErrorConnectionReuse(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(strings.Repeat("bad request ", 40000)))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	setClient := func(opt *intro.Options) { opt.Client = client }
+
+	for i := 0; i < 3; i++ {
+		_, err := intro.FromContext(introspectedContextAt(t, ts.URL, setClient))
+
+		statusErr, isStatusError := err.(*intro.StatusError)
+		assert(t, isStatusError, "error should be a StatusError: %v", err)
+		equals(t, http.StatusBadRequest, statusErr.StatusCode)
+		equals(t, strings.Repeat("bad request ", 1024)[:512], statusErr.Body)
+	}
+
+	equals(t, int32(1), atomic.LoadInt32(&conns))
+}
@@ -0,0 +1,93 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidAudience is returned by FromContext when the token is not intended for the audience required by WithRequiredAudience
+var ErrInvalidAudience = errors.New("token is not intended for this audience")
+
+// Audiences returns the aud claim, which may be a single string or an array of strings, without duplicates.
+// It returns nil when the claim is absent, empty or malformed.
+func (r *Result) Audiences() []string {
+	raw, ok := r.Optionals["aud"]
+	if !ok {
+		return nil
+	}
+
+	var auds []string
+	if err := json.Unmarshal(raw, &auds); err != nil {
+		var aud string
+		if err := json.Unmarshal(raw, &aud); err != nil {
+			return nil
+		}
+
+		auds = []string{aud}
+	}
+
+	var out []string
+	seen := make(map[string]bool, len(auds))
+	for _, aud := range auds {
+		if aud != "" && !seen[aud] {
+			seen[aud] = true
+			out = append(out, aud)
+		}
+	}
+
+	return out
+}
+
+// HasAudience reports whether aud is exactly one of the token's audiences
+func (r *Result) HasAudience(aud string) bool {
+	return r.hasAudience(aud, func(s string) string { return s })
+}
+
+// HasNormalizedAudience is like HasAudience but compares URL shaped audiences leniently: the scheme and host are compared case
+// insensitively and a trailing slash is ignored. Other audiences are compared exactly.
+func (r *Result) HasNormalizedAudience(aud string) bool {
+	return r.hasAudience(aud, normalizeAudience)
+}
+
+func (r *Result) hasAudience(aud string, normalize func(string) string) bool {
+	aud = normalize(aud)
+	for _, a := range r.Audiences() {
+		if normalize(a) == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeAudience lower cases the scheme and host of an absolute URL and strips a trailing slash from it, other values are returned as is
+func normalizeAudience(aud string) string {
+	u, err := url.Parse(aud)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return aud
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// WithRequiredAudience rejects active tokens whose aud claim does not contain aud with ErrInvalidAudience. With normalized set
+// audiences are compared as by HasNormalizedAudience, otherwise exactly.
+func WithRequiredAudience(aud string, normalized bool) Option {
+	return WithResultValidator(func(_ context.Context, res *Result) error {
+		return checkAudience(res, aud, normalized)
+	})
+}
+
+func checkAudience(res *Result, aud string, normalized bool) error {
+	if normalized && res.HasNormalizedAudience(aud) || !normalized && res.HasAudience(aud) {
+		return nil
+	}
+
+	return ErrInvalidAudience
+}
@@ -0,0 +1,93 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestAudiences(t *testing.T) {
+	tt := []struct {
+		name string
+		aud  string
+		want []string
+	}{
+		{name: "Absent"},
+		{name: "String", aud: `"api"`, want: []string{"api"}},
+		{name: "Empty String", aud: `""`},
+		{name: "Array", aud: `["api", "web"]`, want: []string{"api", "web"}},
+		{name: "Empty Array", aud: `[]`},
+		{name: "Duplicates", aud: `["api", "web", "api"]`, want: []string{"api", "web"}},
+		{name: "Malformed", aud: `42`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := intro.Result{Active: true, Optionals: map[string]json.RawMessage{}}
+			if tc.aud != "" {
+				res.Optionals["aud"] = json.RawMessage(tc.aud)
+			}
+
+			equals(t, tc.want, res.Audiences())
+		})
+	}
+}
+
+func TestHasAudience(t *testing.T) {
+	tt := []struct {
+		name       string
+		aud        string
+		check      string
+		exact      bool
+		normalized bool
+	}{
+		{name: "Exact", aud: `"https://api.example.com"`, check: "https://api.example.com", exact: true, normalized: true},
+		{name: "Trailing Slash", aud: `"https://api.example.com/"`, check: "https://api.example.com", normalized: true},
+		{name: "Trailing Slash On Check", aud: `"https://api.example.com/v1"`, check: "https://api.example.com/v1/", normalized: true},
+		{name: "Host Case", aud: `"https://API.Example.com"`, check: "https://api.example.com", normalized: true},
+		{name: "Scheme Case", aud: `"HTTPS://api.example.com"`, check: "https://api.example.com", normalized: true},
+		{name: "Path Case", aud: `"https://api.example.com/V1"`, check: "https://api.example.com/v1"},
+		{name: "Different Host", aud: `"https://api.example.com"`, check: "https://web.example.com"},
+		{name: "Plain Case", aud: `"API"`, check: "api"},
+		{name: "Plain Trailing Slash", aud: `"api/"`, check: "api"},
+		{name: "In Array", aud: `["web", "https://api.example.com/"]`, check: "https://api.example.com", normalized: true},
+		{name: "Empty Array", aud: `[]`, check: "api"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := intro.Result{Active: true, Optionals: map[string]json.RawMessage{"aud": json.RawMessage(tc.aud)}}
+
+			equals(t, tc.exact, res.HasAudience(tc.check))
+			equals(t, tc.normalized, res.HasNormalizedAudience(tc.check))
+		})
+	}
+}
+
+func TestWithRequiredAudience(t *testing.T) {
+	tt := []struct {
+		name       string
+		data       map[string]interface{}
+		normalized bool
+		err        error
+	}{
+		{name: "Match", data: map[string]interface{}{"active": true, "aud": []string{"web", "https://api.example.com"}}},
+		{name: "Match String", data: map[string]interface{}{"active": true, "aud": "https://api.example.com"}},
+		{name: "Absent", data: map[string]interface{}{"active": true}, err: intro.ErrInvalidAudience},
+		{name: "Mismatch", data: map[string]interface{}{"active": true, "aud": "web"}, err: intro.ErrInvalidAudience},
+		{name: "Not Normalized", data: map[string]interface{}{"active": true, "aud": "https://API.example.com/"}, err: intro.ErrInvalidAudience},
+		{name: "Normalized", data: map[string]interface{}{"active": true, "aud": "https://API.example.com/"}, normalized: true},
+		{name: "Inactive", data: map[string]interface{}{"active": false}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := introspectedContext(t, tc.data, intro.WithRequiredAudience("https://api.example.com", tc.normalized))
+
+			_, err := intro.FromContext(ctx)
+
+			equals(t, tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInsufficientScope is returned by Authorize when the token lacks one of the required scopes
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// Authorize is a helper for handlers that returns the introspection result from ctx only if the token is active and has all the
+// required scopes. Otherwise it returns the error from FromContext, ErrInactive or ErrInsufficientScope respectively.
+func Authorize(ctx context.Context, requiredScopes ...string) (*Result, error) {
+	res, err := FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Active {
+		return nil, ErrInactive
+	}
+
+	for _, scope := range requiredScopes {
+		if !res.HasScope(scope) {
+			return nil, ErrInsufficientScope
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,264 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+// introspectedContext returns the request context the middleware hands to handlers when the endpoint responds with data
+func introspectedContext(t *testing.T, data map[string]interface{}, opts ...intro.Option) context.Context {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer ts.Close()
+
+	var ctx context.Context
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	return ctx
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Run("No Middleware", func(t *testing.T) {
+		res, err := intro.Authorize(context.Background())
+
+		equals(t, intro.ErrNoMiddleware, err)
+		assert(t, res == nil, "response should be nil when err is non-nil")
+	})
+
+	t.Run("Introspection Error", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+
+		intro.Introspection("/introspect")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := intro.Authorize(r.Context())
+
+			equals(t, intro.ErrNoBearer, err)
+			assert(t, res == nil, "response should be nil when err is non-nil")
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("Inactive", func(t *testing.T) {
+		res, err := intro.Authorize(introspectedContext(t, map[string]interface{}{"active": false}))
+
+		equals(t, intro.ErrInactive, err)
+		assert(t, res == nil, "response should be nil when err is non-nil")
+	})
+
+	t.Run("Insufficient Scope", func(t *testing.T) {
+		ctx := introspectedContext(t, map[string]interface{}{"active": true, "scope": "read"})
+
+		res, err := intro.Authorize(ctx, "read", "write")
+
+		equals(t, intro.ErrInsufficientScope, err)
+		assert(t, res == nil, "response should be nil when err is non-nil")
+	})
+
+	t.Run("Authorized", func(t *testing.T) {
+		ctx := introspectedContext(t, map[string]interface{}{"active": true, "scope": "read write"})
+
+		res, err := intro.Authorize(ctx, "read", "write")
+
+		ok(t, err)
+		equals(t, []string{"read", "write"}, res.Scopes())
+	})
+}
+
+func TestRequireScopeSemantics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.PostFormValue("token") == "inactive" {
+			w.Write([]byte(`{"active": false}`))
+			return
+		}
+
+		w.Write([]byte(`{"active": true, "scope": "read:* profile"}`))
+	}))
+	defer ts.Close()
+
+	wildcard := func(have, want string) bool {
+		return strings.HasSuffix(have, ":*") && strings.HasPrefix(want, strings.TrimSuffix(have, "*"))
+	}
+
+	tt := []struct {
+		name    string
+		require func(...string) func(http.Handler) http.Handler
+		scopes  []string
+		opts    []intro.Option
+		token   string
+		status  int
+	}{
+		{name: "All", require: intro.RequireAllScopes, scopes: []string{"profile", "read:*"}, status: http.StatusOK},
+		{name: "All Missing One", require: intro.RequireAllScopes, scopes: []string{"profile", "write"}, status: http.StatusForbidden},
+		{name: "Any", require: intro.RequireAnyScope, scopes: []string{"write", "profile"}, status: http.StatusOK},
+		{name: "Any Missing All", require: intro.RequireAnyScope, scopes: []string{"write", "admin"}, status: http.StatusForbidden},
+		{name: "Any Inactive", require: intro.RequireAnyScope, scopes: []string{"profile"}, token: "inactive", status: http.StatusUnauthorized},
+		{name: "Exact Match Without Matcher", require: intro.RequireAllScopes, scopes: []string{"read:users"}, status: http.StatusForbidden},
+		{name: "Wildcard All", require: intro.RequireAllScopes, scopes: []string{"read:users", "read:orders", "profile"}, opts: []intro.Option{intro.WithScopeMatcher(wildcard)}, status: http.StatusOK},
+		{name: "Wildcard Any", require: intro.RequireAnyScope, scopes: []string{"write:users", "read:users"}, opts: []intro.Option{intro.WithScopeMatcher(wildcard)}, status: http.StatusOK},
+		{name: "Wildcard No Match", require: intro.RequireAnyScope, scopes: []string{"write:users"}, opts: []intro.Option{intro.WithScopeMatcher(wildcard)}, status: http.StatusForbidden},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			token := tc.token
+			if token == "" {
+				token = "token"
+			}
+
+			h := intro.Introspection(ts.URL, tc.opts...)(tc.require(tc.scopes...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+			equals(t, tc.status, serveStatus(h, token))
+		})
+	}
+}
+
+func TestChainAnyScope(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true, "scope": "read"}`))
+	}))
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	h, err := intro.NewChain(ts.URL).RequireAnyScope("write", "read").Handler(next)
+	ok(t, err)
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+
+	h, err = intro.NewChain(ts.URL).RequireAllScopes("write", "read").Handler(next)
+	ok(t, err)
+	equals(t, http.StatusForbidden, serveStatus(h, "token"))
+}
+
+func TestInsufficientScopeChallenge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.PostFormValue("token") == "inactive" {
+			w.Write([]byte(`{"active": false}`))
+			return
+		}
+
+		w.Write([]byte(`{"active": true, "scope": "read"}`))
+	}))
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	chained, err := intro.NewChain(ts.URL).RequireScopes("read", "orders:write").Handler(next)
+	ok(t, err)
+
+	tt := []struct {
+		name      string
+		h         http.Handler
+		token     string
+		status    int
+		challenge string
+	}{
+		{
+			name:      "All Scopes",
+			h:         intro.Introspection(ts.URL)(intro.RequireScopes("read", "orders:write")(next)),
+			status:    http.StatusForbidden,
+			challenge: `Bearer error="insufficient_scope", scope="read orders:write"`,
+		},
+		{
+			name:      "Any Scope",
+			h:         intro.Introspection(ts.URL)(intro.RequireAnyScope("admin", "orders:write")(next)),
+			status:    http.StatusForbidden,
+			challenge: `Bearer error="insufficient_scope", scope="admin orders:write"`,
+		},
+		{name: "Chain", h: chained, status: http.StatusForbidden, challenge: `Bearer error="insufficient_scope", scope="read orders:write"`},
+		{
+			name:      "Inactive",
+			h:         intro.Introspection(ts.URL)(intro.RequireScopes("orders:write")(next)),
+			token:     "inactive",
+			status:    http.StatusUnauthorized,
+			challenge: `Bearer error="invalid_token"`,
+		},
+		{name: "Granted", h: intro.Introspection(ts.URL)(intro.RequireScopes("read")(next)), status: http.StatusOK},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			token := tc.token
+			if token == "" {
+				token = "token"
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			tc.h.ServeHTTP(rr, req)
+
+			equals(t, tc.status, rr.Code)
+			equals(t, tc.challenge, rr.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestProxyRequirementChallenge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.PostFormValue("token") == "inactive" {
+			w.Write([]byte(`{"active": false}`))
+			return
+		}
+
+		w.Write([]byte(`{"active": true, "scope": "read"}`))
+	}))
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tt := []struct {
+		name      string
+		h         http.Handler
+		header    string
+		status    int
+		challenge string
+	}{
+		{name: "Active", h: intro.RequireActive()(next), header: "Bearer token", status: http.StatusOK},
+		{name: "Inactive", h: intro.RequireActive()(next), header: "Bearer inactive", status: http.StatusProxyAuthRequired, challenge: `Bearer error="invalid_token"`},
+		{name: "No Bearer", h: intro.RequireActive()(next), status: http.StatusProxyAuthRequired, challenge: "Bearer"},
+		{
+			name:      "Insufficient Scope",
+			h:         intro.RequireScopes("orders:write")(next),
+			header:    "Bearer token",
+			status:    http.StatusForbidden,
+			challenge: `Bearer error="insufficient_scope", scope="orders:write"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				req.Header.Add("Proxy-Authorization", tc.header)
+			}
+
+			rr := httptest.NewRecorder()
+			intro.Introspection(ts.URL, intro.WithProxyAuthorization())(tc.h).ServeHTTP(rr, req)
+
+			equals(t, tc.status, rr.Code)
+			equals(t, tc.challenge, rr.Header().Get("Proxy-Authenticate"))
+			equals(t, "", rr.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package introspection
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// WithAuthorizer adds a policy that every request with an active token must pass, for decisions that depend on both the request
+// and the token, e.g. a tenant path segment that must equal the token's tenant_id claim. Authorizers run after the token is
+// introspected or served from the cache, in the order they were added, and stop at the first error. That error is what
+// FromContext returns and, with WithEnforcement, rejects the request with 403 Forbidden, or with the status of an error
+// implementing StatusCode() int. The gRPC AuthFunc ignores them, see WithGRPCAuthorizer.
+func WithAuthorizer(authorize func(r *http.Request, res *Result) error) Option {
+	return func(opt *Options) {
+		opt.authorizers = append(opt.authorizers, authorize)
+	}
+}
+
+// WithGRPCAuthorizer is WithAuthorizer for the gRPC AuthFunc, authorize is passed the full method name of the call, e.g.
+// /package.Service/Method, and its incoming metadata. An error rejects the call with codes.PermissionDenied, or with the code
+// the status of an error implementing StatusCode() int maps to. The HTTP middleware ignores them.
+func WithGRPCAuthorizer(authorize func(ctx context.Context, method string, md metadata.MD, res *Result) error) Option {
+	return func(opt *Options) {
+		opt.grpcAuthorizers = append(opt.grpcAuthorizers, authorize)
+	}
+}
+
+// authorizationError is an error returned by an authorizer, as the middleware rejects requests with it
+type authorizationError struct {
+	err error
+}
+
+func (e *authorizationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *authorizationError) Unwrap() error {
+	return e.err
+}
+
+// status returns the status and the rfc6750 error code the request is rejected with
+func (e *authorizationError) status() (int, string) {
+	status := http.StatusForbidden
+	if sc, ok := e.err.(interface{ StatusCode() int }); ok {
+		status = sc.StatusCode()
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return status, "invalid_request"
+	case http.StatusUnauthorized:
+		return status, "invalid_token"
+	case http.StatusForbidden:
+		return status, "insufficient_scope"
+	default:
+		return status, ""
+	}
+}
+
+// authorizeRequest runs the authorizers on r if res is accepted, it returns a copy of res failing with the first error, or res
+func authorizeRequest(r *http.Request, res *result, opt *Options) *result {
+	if res.enforcementError() != nil {
+		return res
+	}
+
+	for _, authorize := range opt.authorizers {
+		if err := authorize(r, res.Result); err != nil {
+			return denied(res, err)
+		}
+	}
+
+	return res
+}
+
+// authorizeCall is authorizeRequest for the gRPC call ctx belongs to
+func authorizeCall(ctx context.Context, res *result, opt *Options) *result {
+	if res.enforcementError() != nil {
+		return res
+	}
+
+	method, _ := grpc.Method(ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, authorize := range opt.grpcAuthorizers {
+		if err := authorize(ctx, method, md, res.Result); err != nil {
+			return denied(res, err)
+		}
+	}
+
+	return res
+}
+
+// denied returns a copy of res failing with err. res itself may be shared with an enclosing middleware, see resolve.
+func denied(res *result, err error) *result {
+	cp := *res
+	cp.Err, cp.denied = err, true
+
+	return &cp
+}
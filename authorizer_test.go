@@ -0,0 +1,178 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	intro "github.com/srikrsna/oauth-introspection"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var errWrongTenant = errors.New("token belongs to another tenant")
+
+type statusCodeError int
+
+func (e statusCodeError) Error() string   { return http.StatusText(int(e)) }
+func (e statusCodeError) StatusCode() int { return int(e) }
+
+func tenantServer(t *testing.T) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		switch token := r.PostFormValue("token"); token {
+		case "inactive":
+			w.Write([]byte(`{"active": false}`))
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "tenant_id": token})
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func tenant(res *intro.Result) string {
+	var id string
+	json.Unmarshal(res.Optionals["tenant_id"], &id)
+	return id
+}
+
+func TestAuthorizer(t *testing.T) {
+	ts := tenantServer(t)
+
+	// the tenant path segment, as in /tenants/{tenant}/orders, must be the token's tenant_id claim
+	tenantPath := func(r *http.Request, res *intro.Result) error {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if len(parts) < 2 || parts[0] != "tenants" || parts[1] != tenant(res) {
+			return errWrongTenant
+		}
+
+		return nil
+	}
+
+	var calls int
+	counting := func(r *http.Request, res *intro.Result) error {
+		calls++
+		return nil
+	}
+
+	var got error
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, got = intro.FromContext(r.Context())
+	})
+
+	serve := func(h http.Handler, path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	t.Run("Tenant Path", func(t *testing.T) {
+		calls = 0
+		h := intro.Introspection(ts.URL, intro.WithCache(intro.NewInMemoryCache(), time.Minute), intro.WithAuthorizer(tenantPath), intro.WithAuthorizer(counting), intro.WithEnforcement())(next)
+
+		equals(t, http.StatusOK, serve(h, "/tenants/acme/orders", "acme"))
+		equals(t, http.StatusForbidden, serve(h, "/tenants/globex/orders", "acme"))
+		equals(t, http.StatusForbidden, serve(h, "/orders", "acme"))
+		equals(t, http.StatusUnauthorized, serve(h, "/tenants/acme/orders", "inactive"))
+
+		// cached results are authorized against each request too
+		equals(t, http.StatusForbidden, serve(h, "/tenants/globex/orders", "acme"))
+		equals(t, http.StatusOK, serve(h, "/tenants/acme/orders", "acme"))
+
+		// the authorizers compose, stopping at the first error
+		equals(t, 2, calls)
+	})
+
+	t.Run("FromContext", func(t *testing.T) {
+		h := intro.Introspection(ts.URL, intro.WithAuthorizer(tenantPath))(next)
+
+		equals(t, http.StatusOK, serve(h, "/tenants/globex/orders", "acme"))
+		equals(t, errWrongTenant, got)
+
+		equals(t, http.StatusOK, serve(h, "/tenants/acme/orders", "acme"))
+		ok(t, got)
+	})
+
+	t.Run("Status Code", func(t *testing.T) {
+		tt := []struct {
+			name   string
+			err    error
+			status int
+			header string
+		}{
+			{name: "Default", err: errWrongTenant, status: http.StatusForbidden, header: `Bearer error="insufficient_scope"`},
+			{name: "Not Found", err: statusCodeError(http.StatusNotFound), status: http.StatusNotFound},
+			{name: "Unauthorized", err: statusCodeError(http.StatusUnauthorized), status: http.StatusUnauthorized, header: `Bearer error="invalid_token"`},
+		}
+
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				h := intro.Introspection(ts.URL, intro.WithAuthorizer(func(*http.Request, *intro.Result) error { return tc.err }), intro.WithEnforcement())(next)
+
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Add("Authorization", "Bearer acme")
+
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+
+				equals(t, tc.status, rr.Code)
+				equals(t, tc.header, rr.Header().Get("WWW-Authenticate"))
+			})
+		}
+	})
+}
+
+func TestGRPCAuthorizer(t *testing.T) {
+	ts := tenantServer(t)
+
+	var method string
+	auth := intro.AuthFunc(ts.URL, intro.WithEnforcement(), intro.WithGRPCAuthorizer(func(ctx context.Context, m string, md metadata.MD, res *intro.Result) error {
+		method = m
+		if v := md.Get("x-tenant"); len(v) != 1 || v[0] != tenant(res) {
+			return errWrongTenant
+		}
+
+		return nil
+	}), intro.WithGRPCAuthorizer(func(ctx context.Context, m string, md metadata.MD, res *intro.Result) error {
+		if len(md.Get("x-malformed")) > 0 {
+			return statusCodeError(http.StatusBadRequest)
+		}
+
+		return nil
+	}))
+
+	lis := echoGRPCServer(t, auth)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	ok(t, err)
+	defer conn.Close()
+
+	call := func(kv ...string) codes.Code {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), kv...)
+		return status.Code(conn.Invoke(ctx, "/test.Echo/Echo", &wrappers.StringValue{Value: "ping"}, &wrappers.StringValue{}))
+	}
+
+	equals(t, codes.OK, call("authorization", "Bearer acme", "x-tenant", "acme"))
+	equals(t, "/test.Echo/Echo", method)
+	equals(t, codes.PermissionDenied, call("authorization", "Bearer acme", "x-tenant", "globex"))
+	equals(t, codes.InvalidArgument, call("authorization", "Bearer acme", "x-tenant", "acme", "x-malformed", "1"))
+	equals(t, codes.Unauthenticated, call("authorization", "Bearer inactive", "x-tenant", "acme"))
+}
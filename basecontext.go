@@ -0,0 +1,105 @@
+package introspection
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundGrace is how long background work in flight may continue once the base context is done, see WithBaseContext
+const backgroundGrace = 5 * time.Second
+
+// WithBaseContext binds the background work of the middleware to ctx, e.g. a context cancelled on graceful shutdown: once ctx is
+// done no further background work is started and the work in flight, like the introspections WithSoftDeadline lets finish in the
+// background, is cancelled after a grace period of 5 seconds. Requests are still served, their lookups no longer outlive them.
+// Caches have their own lifetime, see CacheBaseContext.
+func WithBaseContext(ctx context.Context) Option {
+	return func(opt *Options) {
+		opt.baseCtx = ctx
+	}
+}
+
+// backgroundContext returns a context for background work started on behalf of the request ctx belongs to. It carries the values
+// of ctx but not its cancellation, it is cancelled backgroundGrace after the base context is done instead. ok is false when the
+// base context is already done, no background work should be started then. stop releases the resources of the context.
+func backgroundContext(ctx context.Context, opt *Options) (bg context.Context, stop func(), ok bool) {
+	if opt.baseCtx == nil {
+		return withoutCancel{ctx}, func() {}, true
+	}
+
+	if opt.baseCtx.Err() != nil {
+		return nil, nil, false
+	}
+
+	bg, cancel := context.WithCancel(withoutCancel{ctx})
+
+	var (
+		mu      sync.Mutex
+		grace   Timer
+		stopped bool
+	)
+
+	unregister := afterFunc(opt.baseCtx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !stopped {
+			grace = opt.clock.AfterFunc(backgroundGrace, cancel)
+		}
+	})
+
+	stop = func() {
+		unregister()
+
+		mu.Lock()
+		stopped = true
+		if grace != nil {
+			grace.Stop()
+		}
+		mu.Unlock()
+
+		cancel()
+	}
+
+	return bg, stop, true
+}
+
+// withoutCancel carries the values of a context but not its cancellation, like context.WithoutCancel which needs Go 1.21
+type withoutCancel struct {
+	parent context.Context
+}
+
+func (withoutCancel) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (withoutCancel) Done() <-chan struct{} {
+	return nil
+}
+
+func (withoutCancel) Err() error {
+	return nil
+}
+
+func (c withoutCancel) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// afterFunc calls f in its own goroutine once ctx is done, unless stop was called before, like context.AfterFunc which needs
+// Go 1.21. The goroutine waits until either happens.
+func afterFunc(ctx context.Context, f func()) (stop func()) {
+	stopped := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f()
+		case <-stopped:
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(stopped) })
+	}
+}
@@ -0,0 +1,90 @@
+package introspection_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestBaseContext(t *testing.T) {
+	received, abandoned := make(chan struct{}, 1), make(chan struct{}, 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("token") == "fast" {
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(`{"active": true}`))
+			return
+		}
+
+		received <- struct{}{}
+		<-r.Context().Done()
+		abandoned <- struct{}{}
+	}))
+	defer ts.Close()
+
+	// no idle connections, so that only the goroutines of the middleware can remain
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	setClient := func(opt *intro.Options) { opt.Client = client }
+
+	goroutines := runtime.NumGoroutine()
+
+	clock := introspectiontest.NewClock(time.Now())
+	base, cancel := context.WithCancel(context.Background())
+
+	// the introspection only continues in the background when there is a cache to warm
+	h := intro.Introspection(ts.URL, setClient, intro.WithClock(clock), intro.WithBaseContext(base), intro.WithMicroCache(time.Second), intro.WithSoftDeadline(time.Second, nil))
+
+	serve := func(token string) chan error {
+		out := make(chan error, 1)
+		go func() {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer "+token)
+
+			h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, err := intro.FromContext(r.Context())
+				out <- err
+			})).ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		return out
+	}
+
+	out := serve("slow")
+	<-received
+	clock.Advance(time.Second)
+	equals(t, intro.ErrSoftDeadline, <-out)
+
+	cancel()
+
+	select {
+	case <-abandoned:
+		t.Fatal("the background introspection should be given a grace period")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the grace period is scheduled asynchronously once the base context is done
+	for done := false; !done; {
+		clock.Advance(time.Second)
+
+		select {
+		case <-abandoned:
+			done = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// no background introspection is started anymore
+	ok(t, <-serve("fast"))
+
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > goroutines; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d remain, %d before", runtime.NumGoroutine(), goroutines)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package introspection
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// WithBasicPasswordToken accepts the password of a Basic credential, as in Authorization: Basic base64(username:token), as the
+// token of legacy clients whose username matches matchUsername, e.g. a fixed API key, in HTTP requests and gRPC metadata alike.
+// It only applies when there is no Bearer credential, which always takes precedence, and Basic credentials of other usernames
+// are ignored. More than one matching Basic credential, or one along with another token under WithRejectMultipleTokens, fails
+// with ErrAmbiguousBearer. Neither the username nor the password are logged or passed to hooks.
+func WithBasicPasswordToken(matchUsername func(username string) bool) Option {
+	return func(opt *Options) {
+		opt.basicUsername = matchUsername
+	}
+}
+
+// basicPasswordToken returns the password of the Basic credential among the Authorization values whose username opt accepts,
+// see WithBasicPasswordToken
+func basicPasswordToken(values []string, opt *Options) (string, error) {
+	var token string
+	found := false
+
+	for _, v := range values {
+		if len(v) < len("Basic ") || !strings.EqualFold(v[:len("Basic ")], "Basic ") {
+			continue
+		}
+
+		username, password, ok := parseBasic(strings.TrimSpace(v[len("Basic "):]))
+		if !ok || !opt.basicUsername(username) {
+			continue
+		}
+
+		if found {
+			return "", ErrAmbiguousBearer
+		}
+
+		token, found = password, true
+	}
+
+	if !found {
+		return "", ErrNoBearer
+	}
+
+	return token, nil
+}
+
+// hasBasicPasswordToken reports whether the Authorization values carry a Basic credential accepted by WithBasicPasswordToken
+func hasBasicPasswordToken(values []string, opt *Options) bool {
+	if opt.basicUsername == nil {
+		return false
+	}
+
+	_, err := basicPasswordToken(values, opt)
+	return err != ErrNoBearer
+}
+
+// parseBasic decodes the user-pass of a Basic credential, see rfc7617 section 2
+func parseBasic(credentials string) (username, password string, ok bool) {
+	data, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(data), ":")
+}
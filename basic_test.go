@@ -0,0 +1,115 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestBasicPasswordToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": r.PostFormValue("token")})
+	}))
+	defer ts.Close()
+
+	basic := func(username, password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	legacy := intro.WithBasicPasswordToken(func(username string) bool { return username == "apikey" })
+
+	tt := []struct {
+		name    string
+		target  string
+		headers []string
+		options []intro.Option
+		token   string
+		err     error
+	}{
+		{name: "Matching Username", headers: []string{basic("apikey", "legacy-token")}, options: []intro.Option{legacy}, token: "legacy-token"},
+		{name: "Lowercase Scheme", headers: []string{"basic " + base64.StdEncoding.EncodeToString([]byte("apikey:legacy-token"))}, options: []intro.Option{legacy}, token: "legacy-token"},
+		{name: "Other Username", headers: []string{basic("someone", "legacy-token")}, options: []intro.Option{legacy}, err: intro.ErrNoBearer},
+		{name: "Not Opted In", headers: []string{basic("apikey", "legacy-token")}, err: intro.ErrNoBearer},
+		{name: "Malformed", headers: []string{"Basic !!!"}, options: []intro.Option{legacy}, err: intro.ErrNoBearer},
+		{name: "Empty Password", headers: []string{basic("apikey", "")}, options: []intro.Option{legacy}, err: intro.ErrNoBearer},
+		{name: "Bearer Takes Precedence", headers: []string{basic("apikey", "legacy-token"), "Bearer token"}, options: []intro.Option{legacy}, token: "token"},
+		{name: "Bearer And Basic Rejected", headers: []string{basic("apikey", "legacy-token"), "Bearer token"}, options: []intro.Option{legacy, intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Bearer And Other Basic", headers: []string{basic("proxy", "secret"), "Bearer token"}, options: []intro.Option{legacy, intro.WithRejectMultipleTokens()}, token: "token"},
+		{name: "Basic And Query Rejected", target: "/?access_token=other", headers: []string{basic("apikey", "legacy-token")}, options: []intro.Option{legacy, intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Repeated Basic", headers: []string{basic("apikey", "one"), basic("apikey", "two")}, options: []intro.Option{legacy}, err: intro.ErrAmbiguousBearer},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			target := tc.target
+			if target == "" {
+				target = "/"
+			}
+
+			req := httptest.NewRequest("GET", target, nil)
+			for _, h := range tc.headers {
+				req.Header.Add("Authorization", h)
+			}
+
+			var called bool
+			intro.Introspection(ts.URL, tc.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+
+				res, err := intro.FromContext(r.Context())
+				equals(t, tc.err, err)
+				if err == nil {
+					equals(t, tc.token, res.Sub)
+				}
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert(t, called, "handler should be called")
+		})
+	}
+}
+
+func TestBasicPasswordTokenGRPC(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": r.PostFormValue("token")})
+	}))
+	defer ts.Close()
+
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("apikey:legacy-token"))
+	legacy := intro.WithBasicPasswordToken(func(username string) bool { return username == "apikey" })
+
+	tt := []struct {
+		name    string
+		values  []string
+		options []intro.Option
+		token   string
+		err     error
+	}{
+		{name: "Basic Only", values: []string{basic}, options: []intro.Option{legacy}, token: "legacy-token"},
+		{name: "Bearer Takes Precedence", values: []string{basic, "Bearer token"}, options: []intro.Option{legacy}, token: "token"},
+		{name: "Bearer And Basic Rejected", values: []string{basic, "Bearer token"}, options: []intro.Option{legacy, intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Bearer Only Rejecting", values: []string{"Bearer token"}, options: []intro.Option{legacy, intro.WithRejectMultipleTokens()}, token: "token"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			md := metadata.MD{"authorization": tc.values}
+
+			ctx, err := intro.AuthFunc(ts.URL, tc.options...)(metadata.NewIncomingContext(context.Background(), md))
+			ok(t, err)
+
+			res, err := intro.FromContext(ctx)
+			equals(t, tc.err, err)
+			if err == nil {
+				equals(t, tc.token, res.Sub)
+			}
+		})
+	}
+}
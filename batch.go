@@ -0,0 +1,96 @@
+package introspection
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultBatchConcurrency is the number of tokens a BatchIntrospector introspects at once without WithMaxConcurrency
+const defaultBatchConcurrency = 16
+
+// BatchIntrospector introspects many tokens at once, e.g. to audit sessions from admin tooling. Tokens go through the same
+// lookup as in the middleware, so the cache, WithMaxConcurrency, WithCacheCircuitBreaker and the other options apply.
+type BatchIntrospector struct {
+	opt         Options
+	concurrency int
+}
+
+// NewBatchIntrospector returns a BatchIntrospector introspecting tokens at endpoint with opts. It introspects as many tokens at
+// once as WithMaxConcurrency allows, 16 without it. Options about requests, such as WithEnforcement, are ignored.
+func NewBatchIntrospector(endpoint string, opts ...Option) *BatchIntrospector {
+	b := &BatchIntrospector{opt: makeOptions(endpoint, opts), concurrency: defaultBatchConcurrency}
+	if b.opt.maxConcurrency > 0 {
+		b.concurrency = b.opt.maxConcurrency
+	}
+
+	return b
+}
+
+// IntrospectAll introspects tokens, the result or the error of tokens[i] is at index i of the returned slices. Inactive tokens
+// get a result whose Active is false, not an error. Identical tokens are introspected once and share their result.
+// IntrospectAll only fails as a whole, with ctx's error, when ctx is done before every token was introspected.
+func (b *BatchIntrospector) IntrospectAll(ctx context.Context, tokens []string) ([]*Result, []error, error) {
+	results, errs := make([]*Result, len(tokens)), make([]error, len(tokens))
+
+	// first holds the index of the first occurrence of each token, unique the indexes of those first occurrences
+	first := make(map[string]int, len(tokens))
+	unique := make([]int, 0, len(tokens))
+	for i, token := range tokens {
+		if _, ok := first[token]; !ok {
+			first[token] = i
+			unique = append(unique, i)
+		}
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := b.concurrency
+	if workers > len(unique) {
+		workers = len(unique)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i], errs[i] = b.introspect(ctx, tokens[i])
+			}
+		}()
+	}
+
+feed:
+	for _, i := range unique {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for i, token := range tokens {
+		if j := first[token]; j != i {
+			results[i], errs[i] = results[j], errs[j]
+		}
+	}
+
+	return results, errs, nil
+}
+
+// introspect returns the result for a single token of a batch
+func (b *BatchIntrospector) introspect(ctx context.Context, token string) (*Result, error) {
+	token, err := checkToken(ctx, token, &b.opt)
+	if err != nil {
+		return nil, err
+	}
+
+	res := resolve(ctx, token, &b.opt)
+	return res.Result, res.Err
+}
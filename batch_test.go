@@ -0,0 +1,119 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestBatchIntrospector(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		hits     = make(map[string]int)
+		inFlight int32
+		peak     int32
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+		}
+
+		token := r.PostFormValue("token")
+		mu.Lock()
+		hits[token]++
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		switch token {
+		case "failing":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "inactive":
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(`{"active": false}`))
+		default:
+			w.Header().Add("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": token})
+		}
+	}))
+	defer ts.Close()
+
+	b := intro.NewBatchIntrospector(ts.URL, intro.WithMaxConcurrency(3), intro.WithCache(intro.NewInMemoryCache(), time.Minute))
+
+	t.Run("Concurrency Bound", func(t *testing.T) {
+		tokens := make([]string, 30)
+		for i := range tokens {
+			tokens[i] = fmt.Sprintf("token-%d", i)
+		}
+
+		results, errs, err := b.IntrospectAll(context.Background(), tokens)
+		ok(t, err)
+
+		for i, token := range tokens {
+			ok(t, errs[i])
+			equals(t, token, results[i].Sub)
+		}
+
+		assert(t, atomic.LoadInt32(&peak) <= 3, "at most 3 tokens should be introspected at once, got %d", peak)
+	})
+
+	t.Run("Mixed Outcomes", func(t *testing.T) {
+		tokens := []string{"alice", "failing", "inactive", "alice", "bob", "failing", " "}
+
+		results, errs, err := b.IntrospectAll(context.Background(), tokens)
+		ok(t, err)
+
+		equals(t, "alice", results[0].Sub)
+		ok(t, errs[0])
+
+		_, isStatusError := errs[1].(*intro.StatusError)
+		assert(t, isStatusError, "error should be a StatusError: %v", errs[1])
+		assert(t, results[1] == nil, "failed tokens should have no result")
+
+		ok(t, errs[2])
+		equals(t, false, results[2].Active)
+
+		assert(t, results[3] == results[0], "identical tokens should share their result")
+		equals(t, "bob", results[4].Sub)
+		equals(t, errs[1], errs[5])
+		equals(t, intro.ErrNoBearer, errs[6])
+
+		mu.Lock()
+		defer mu.Unlock()
+		equals(t, 1, hits["alice"])
+		equals(t, 1, hits["failing"])
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		results, errs, err := b.IntrospectAll(context.Background(), []string{"alice", "bob"})
+		ok(t, err)
+		ok(t, errs[0])
+		ok(t, errs[1])
+
+		assert(t, results[0].FromCache && results[1].FromCache, "results should be served from the cache")
+
+		mu.Lock()
+		defer mu.Unlock()
+		equals(t, 1, hits["alice"])
+		equals(t, 1, hits["bob"])
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, errs, err := b.IntrospectAll(ctx, []string{"carol", "dave"})
+		equals(t, context.Canceled, err)
+		assert(t, results == nil && errs == nil, "a cancelled batch should have no results")
+	})
+}
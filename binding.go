@@ -0,0 +1,76 @@
+package introspection
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// BindingMode decides what happens to requests presenting a cached token from another binding, see WithBindTo
+type BindingMode int
+
+const (
+	// BindingReject fails such requests with a *BindingMismatchError
+	BindingReject BindingMode = iota
+	// BindingWarn only reports them to Hooks.OnBindingMismatch
+	BindingWarn
+)
+
+// BindingMismatchError is returned by FromContext when a cached result is reused from another binding than the one it was cached
+// for, see WithBindTo
+type BindingMismatchError struct {
+	// Bound is the binding of the request the result was cached for
+	Bound string
+	// Presented is the binding of the request that reused it
+	Presented string
+}
+
+func (e *BindingMismatchError) Error() string {
+	return fmt.Sprintf("token bound to %q is used from %q", e.Bound, e.Presented)
+}
+
+const bindingKey = resKeyType(6)
+
+// WithBindTo binds cached results to the client that presented the token first, as told by bind, e.g. its IP address with
+// ClientIP or its User-Agent. The binding is stored with the result, see Result.Binding, and requests reusing the cached result
+// with another binding are reported to Hooks.OnBindingMismatch and, with BindingReject, fail with a *BindingMismatchError.
+// Fresh results are always bound to the request they were introspected for. It applies to the HTTP middleware only.
+func WithBindTo(bind func(r *http.Request) string, mode BindingMode) Option {
+	return func(opt *Options) {
+		opt.bind = bind
+		opt.bindingMode = mode
+	}
+}
+
+// bindingContext returns ctx carrying the binding of r, if WithBindTo is used
+func bindingContext(ctx context.Context, r *http.Request, opt *Options) context.Context {
+	if opt.bind == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, bindingKey, opt.bind(r))
+}
+
+// bindResult records the binding of the request ctx belongs to in the fresh res
+func bindResult(ctx context.Context, res *Result) {
+	if binding, ok := ctx.Value(bindingKey).(string); ok {
+		res.Binding = binding
+	}
+}
+
+// checkBinding fails cached results reused from another binding than theirs, unless BindingWarn is used
+func checkBinding(ctx context.Context, res *Result, opt *Options) error {
+	presented, ok := ctx.Value(bindingKey).(string)
+	if !ok || !res.FromCache || res.Binding == presented {
+		return nil
+	}
+
+	err := &BindingMismatchError{Bound: res.Binding, Presented: presented}
+	opt.hooks.bindingMismatch(ctx, err)
+
+	if opt.bindingMode == BindingWarn {
+		return nil
+	}
+
+	return err
+}
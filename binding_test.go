@@ -0,0 +1,71 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestBindTo(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		mode     intro.BindingMode
+		mismatch int
+	}{
+		{name: "Reject", mode: intro.BindingReject, mismatch: http.StatusUnauthorized},
+		{name: "Warn", mode: intro.BindingWarn, mismatch: http.StatusOK},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			calls = 0
+
+			var mismatches []error
+			hooks := intro.Hooks{OnBindingMismatch: func(_ context.Context, err error) { mismatches = append(mismatches, err) }}
+
+			var bound string
+			h := intro.Introspection(ts.URL,
+				intro.WithCache(intro.NewInMemoryCache(), time.Minute),
+				intro.WithBindTo(func(r *http.Request) string { return intro.ClientIP(r) }, tc.mode),
+				intro.WithHooks(hooks),
+				intro.WithEnforcement(),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, _ := intro.FromContext(r.Context())
+				bound = res.Binding
+			}))
+
+			serve := func(remote string) int {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Add("Authorization", "Bearer token")
+				req.RemoteAddr = remote
+
+				rr := httptest.NewRecorder()
+				h.ServeHTTP(rr, req)
+
+				return rr.Code
+			}
+
+			equals(t, http.StatusOK, serve("192.0.2.1:1234"))
+			equals(t, "192.0.2.1", bound)
+			equals(t, http.StatusOK, serve("192.0.2.1:5678"))
+			equals(t, 0, len(mismatches))
+
+			equals(t, tc.mismatch, serve("198.51.100.7:1234"))
+			equals(t, []error{&intro.BindingMismatchError{Bound: "192.0.2.1", Presented: "198.51.100.7"}}, mismatches)
+			equals(t, 1, calls)
+		})
+	}
+}
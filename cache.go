@@ -1,6 +1,9 @@
 package introspection
 
 import (
+	"context"
+	"errors"
+	"hash/fnv"
 	"sync"
 	"time"
 )
@@ -14,43 +17,361 @@ type Cache interface {
 	Store(key string, res *Result, exp time.Duration)
 }
 
+// EntryInfo describes a cache entry, as opposed to the token its result is for
+type EntryInfo struct {
+	// StoredAt is when the entry was stored, by the last introspection of its token
+	StoredAt time.Time
+	// ExpiresAt is when the entry expires and the token will be introspected again
+	ExpiresAt time.Time
+}
+
+// EntryInspector is implemented by caches that can tell when their entries were stored and expire, see Meta.EntryAge
+type EntryInspector interface {
+	// GetEntry is like Get and also returns the metadata of the entry
+	GetEntry(key string) (*Result, EntryInfo)
+}
+
+// Toucher is implemented by caches that can extend the expiry of an entry, it is needed by WithSlidingCacheExpiration
+type Toucher interface {
+	// Touch makes the entry under key expire exp from now, it reports whether there was an unexpired entry
+	Touch(key string, exp time.Duration) bool
+}
+
+// SubjectInvalidator is implemented by caches that can evict the results of every token of a subject, see InvalidateSubject
+type SubjectInvalidator interface {
+	// InvalidateSubject evicts the results whose sub claim is sub
+	InvalidateSubject(ctx context.Context, sub string) error
+}
+
+// ErrInvalidationUnsupported is returned by InvalidateSubject for caches that don't implement SubjectInvalidator
+var ErrInvalidationUnsupported = errors.New("introspection: cache does not support invalidating subjects")
+
+// InvalidateSubject evicts the results of every token of sub from cache, e.g. once the user's account is disabled, so that the
+// next request with any of them is introspected again. The caches of this package support it, more efficiently with
+// CacheSubjectIndex, other caches must implement SubjectInvalidator, otherwise ErrInvalidationUnsupported is returned.
+func InvalidateSubject(ctx context.Context, cache Cache, sub string) error {
+	inv, ok := cache.(SubjectInvalidator)
+	if !ok {
+		return ErrInvalidationUnsupported
+	}
+
+	return inv.InvalidateSubject(ctx, sub)
+}
+
+// CacheOption configures the caches provided by this package
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	clock         Clock
+	sweepInterval time.Duration
+	subjectIndex  bool
+	baseCtx       context.Context
+}
+
+// defaultSweepInterval is how often the in memory cache removes expired entries unless CacheSweepInterval is used
+const defaultSweepInterval = time.Minute
+
+// CacheClock sets the clock used to expire cache entries, defaults to SystemClock
+func CacheClock(c Clock) CacheOption {
+	return func(opt *cacheOptions) {
+		opt.clock = c
+	}
+}
+
+// CacheSweepInterval sets how often expired entries are removed from memory, defaults to a minute. Expired entries are never
+// returned by Get, the interval only bounds how long they keep using memory.
+func CacheSweepInterval(d time.Duration) CacheOption {
+	return func(opt *cacheOptions) {
+		opt.sweepInterval = d
+	}
+}
+
+// CacheSubjectIndex maintains an index of the cached keys per sub claim, so that InvalidateSubject only visits the entries of the
+// subject instead of every entry. It costs memory proportional to the number of entries, they leave the index as they expire.
+func CacheSubjectIndex() CacheOption {
+	return func(opt *cacheOptions) {
+		opt.subjectIndex = true
+	}
+}
+
+// CacheBaseContext stops the janitor removing expired entries once ctx is done, e.g. on graceful shutdown. Expired entries are
+// still never returned by Get, but are no longer removed from memory.
+func CacheBaseContext(ctx context.Context) CacheOption {
+	return func(opt *cacheOptions) {
+		opt.baseCtx = ctx
+	}
+}
+
+func makeCacheOptions(opts []CacheOption) cacheOptions {
+	opt := cacheOptions{
+		clock:         SystemClock,
+		sweepInterval: defaultSweepInterval,
+	}
+
+	for _, apply := range opts {
+		apply(&opt)
+	}
+
+	return opt
+}
+
 // NewInMemoryCache returns an in memory implementation of the Cache. Useful for testing and single instance apps.
-func NewInMemoryCache() Cache {
-	return &inMemoryCache{
-		results: make(map[string]*Result),
-		expiry:  make(map[string]*time.Timer),
+//
+// Entries are removed by a single janitor that runs every sweep interval while the cache is not empty, see CacheSweepInterval.
+func NewInMemoryCache(opts ...CacheOption) Cache {
+	opt := makeCacheOptions(opts)
+
+	mc := &inMemoryCache{
+		clock:         opt.clock,
+		sweepInterval: opt.sweepInterval,
+		entries:       make(map[string]cacheEntry),
+	}
+
+	if opt.subjectIndex {
+		mc.subjects = make(map[string]map[string]struct{})
+	}
+
+	if opt.baseCtx != nil {
+		afterFunc(opt.baseCtx, mc.stopJanitor)
 	}
+
+	return mc
+}
+
+type cacheEntry struct {
+	res     *Result
+	stored  time.Time
+	expires time.Time
 }
 
 type inMemoryCache struct {
 	sync.RWMutex
 
-	results map[string]*Result
-	expiry  map[string]*time.Timer
+	clock         Clock
+	sweepInterval time.Duration
+
+	entries map[string]cacheEntry
+	// subjects holds the keys of the entries per sub claim, nil unless CacheSubjectIndex is used
+	subjects map[string]map[string]struct{}
+	// janitor is the pending sweep, nil while the cache is empty
+	janitor Timer
+	// stopped is set once the base context is done, no sweep is scheduled anymore
+	stopped bool
 }
 
 func (mc *inMemoryCache) Get(key string) *Result {
+	res, _ := mc.GetEntry(key)
+	return res
+}
+
+func (mc *inMemoryCache) GetEntry(key string) (*Result, EntryInfo) {
 	mc.RLock()
 	defer mc.RUnlock()
 
-	return mc.results[key]
+	e, ok := mc.entries[key]
+	if !ok || !mc.clock.Now().Before(e.expires) {
+		return nil, EntryInfo{}
+	}
+
+	return e.res, EntryInfo{StoredAt: e.stored, ExpiresAt: e.expires}
 }
 
 func (mc *inMemoryCache) Store(key string, res *Result, exp time.Duration) {
 	mc.Lock()
+	defer mc.Unlock()
 
-	mc.results[key] = res
+	if prev, ok := mc.entries[key]; ok {
+		mc.unindex(key, prev.res)
+	}
+
+	now := mc.clock.Now()
+	mc.entries[key] = cacheEntry{res: res, stored: now, expires: now.Add(exp)}
+	mc.index(key, res)
 
-	if val, ok := mc.expiry[key]; ok {
-		val.Stop()
+	if mc.janitor == nil && !mc.stopped {
+		mc.janitor = mc.clock.AfterFunc(mc.sweepInterval, mc.sweep)
 	}
+}
 
-	mc.expiry[key] = time.AfterFunc(exp, func() {
-		mc.Lock()
-		delete(mc.results, key)
-		delete(mc.expiry, key)
-		mc.Unlock()
-	})
+// sweep removes expired entries and schedules the next sweep if entries remain
+func (mc *inMemoryCache) sweep() {
+	mc.Lock()
+	defer mc.Unlock()
+
+	now := mc.clock.Now()
+	for key, e := range mc.entries {
+		if !now.Before(e.expires) {
+			delete(mc.entries, key)
+			mc.unindex(key, e.res)
+		}
+	}
+
+	mc.janitor = nil
+	if len(mc.entries) > 0 && !mc.stopped {
+		mc.janitor = mc.clock.AfterFunc(mc.sweepInterval, mc.sweep)
+	}
+}
+
+// stopJanitor cancels the pending sweep and prevents further ones, see CacheBaseContext
+func (mc *inMemoryCache) stopJanitor() {
+	mc.Lock()
+	defer mc.Unlock()
+
+	mc.stopped = true
+	if mc.janitor != nil {
+		mc.janitor.Stop()
+		mc.janitor = nil
+	}
+}
 
-	mc.Unlock()
+func (mc *inMemoryCache) Touch(key string, exp time.Duration) bool {
+	mc.Lock()
+	defer mc.Unlock()
+
+	now := mc.clock.Now()
+
+	e, ok := mc.entries[key]
+	if !ok || !now.Before(e.expires) {
+		return false
+	}
+
+	e.expires = now.Add(exp)
+	mc.entries[key] = e
+
+	return true
+}
+
+func (mc *inMemoryCache) InvalidateSubject(_ context.Context, sub string) error {
+	mc.Lock()
+	defer mc.Unlock()
+
+	if mc.subjects == nil {
+		for key, e := range mc.entries {
+			if e.res.Sub == sub {
+				delete(mc.entries, key)
+			}
+		}
+
+		return nil
+	}
+
+	for key := range mc.subjects[sub] {
+		delete(mc.entries, key)
+	}
+
+	delete(mc.subjects, sub)
+	return nil
+}
+
+// index adds key to the subject index under the sub claim of res, the caller holds the lock
+func (mc *inMemoryCache) index(key string, res *Result) {
+	if mc.subjects == nil || res.Sub == "" {
+		return
+	}
+
+	keys, ok := mc.subjects[res.Sub]
+	if !ok {
+		keys = make(map[string]struct{})
+		mc.subjects[res.Sub] = keys
+	}
+
+	keys[key] = struct{}{}
+}
+
+// unindex removes key from the subject index, the caller holds the lock
+func (mc *inMemoryCache) unindex(key string, res *Result) {
+	keys, ok := mc.subjects[res.Sub]
+	if !ok {
+		return
+	}
+
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(mc.subjects, res.Sub)
+	}
+}
+
+// NewShardedCache returns an in memory Cache split into shards independently locked parts, keys are spread over them by hash.
+// It behaves exactly like NewInMemoryCache but scales better when many goroutines use distinct keys, e.g. under tens of
+// thousands of requests per second. NewInMemoryCache remains the better choice for small deployments.
+// shards less than 1 is taken as 1.
+func NewShardedCache(shards int, opts ...CacheOption) Cache {
+	if shards < 1 {
+		shards = 1
+	}
+
+	sc := make(shardedCache, shards)
+	for i := range sc {
+		sc[i] = NewInMemoryCache(opts...).(*inMemoryCache)
+	}
+
+	return sc
+}
+
+type shardedCache []*inMemoryCache
+
+func (sc shardedCache) shard(key string) *inMemoryCache {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return sc[h.Sum32()%uint32(len(sc))]
+}
+
+func (sc shardedCache) Get(key string) *Result {
+	return sc.shard(key).Get(key)
+}
+
+func (sc shardedCache) GetEntry(key string) (*Result, EntryInfo) {
+	return sc.shard(key).GetEntry(key)
+}
+
+func (sc shardedCache) Store(key string, res *Result, exp time.Duration) {
+	sc.shard(key).Store(key, res, exp)
+}
+
+func (sc shardedCache) Touch(key string, exp time.Duration) bool {
+	return sc.shard(key).Touch(key, exp)
+}
+
+func (sc shardedCache) InvalidateSubject(ctx context.Context, sub string) error {
+	for _, mc := range sc {
+		mc.InvalidateSubject(ctx, sub)
+	}
+
+	return nil
+}
+
+// errorCache remembers introspection failures per cache key for a short time, see WithErrorCacheTTL
+type errorCache struct {
+	sync.Mutex
+
+	clock Clock
+	errs  map[string]error
+}
+
+func newErrorCache(clock Clock) *errorCache {
+	return &errorCache{clock: clock, errs: make(map[string]error)}
+}
+
+func (ec *errorCache) Get(key string) error {
+	ec.Lock()
+	defer ec.Unlock()
+
+	return ec.errs[key]
+}
+
+func (ec *errorCache) Store(key string, err error, exp time.Duration) {
+	ec.Lock()
+	defer ec.Unlock()
+
+	if _, ok := ec.errs[key]; ok {
+		return
+	}
+
+	ec.errs[key] = err
+
+	ec.clock.AfterFunc(exp, func() {
+		ec.Lock()
+		delete(ec.errs, key)
+		ec.Unlock()
+	})
 }
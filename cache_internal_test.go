@@ -0,0 +1,142 @@
+package introspection
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a minimal Clock whose single pending timer fires on advance
+type fakeClock struct {
+	now time.Time
+
+	at time.Time
+	f  func()
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.at, c.f = c.now.Add(d), f
+	return c
+}
+
+func (c *fakeClock) Stop() bool {
+	pending := c.f != nil
+	c.f = nil
+	return pending
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+
+	if f := c.f; f != nil && !c.at.After(c.now) {
+		c.f = nil
+		f()
+	}
+}
+
+func TestInMemoryCacheJanitor(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+
+	mc := NewInMemoryCache(CacheClock(clock), CacheSweepInterval(time.Minute)).(*inMemoryCache)
+
+	mc.Store("short", &Result{Active: true}, time.Second)
+	mc.Store("long", &Result{Active: true}, 90*time.Second)
+
+	if mc.janitor == nil {
+		t.Fatal("janitor should be scheduled once the cache has entries")
+	}
+
+	clock.advance(time.Minute)
+
+	if _, ok := mc.entries["short"]; ok {
+		t.Fatal("expired entry should have been swept")
+	}
+
+	if _, ok := mc.entries["long"]; !ok {
+		t.Fatal("live entry should not have been swept")
+	}
+
+	if mc.janitor == nil {
+		t.Fatal("janitor should be rescheduled while entries remain")
+	}
+
+	clock.advance(time.Minute)
+
+	if len(mc.entries) != 0 {
+		t.Fatalf("all entries should have been swept, %d remain", len(mc.entries))
+	}
+
+	if mc.janitor != nil {
+		t.Fatal("janitor should stop once the cache is empty")
+	}
+}
+
+func TestSubjectIndexCleanup(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+
+	mc := NewInMemoryCache(CacheClock(clock), CacheSweepInterval(time.Minute), CacheSubjectIndex()).(*inMemoryCache)
+
+	mc.Store("a1", &Result{Active: true, Sub: "alice"}, time.Second)
+	mc.Store("a2", &Result{Active: true, Sub: "alice"}, 90*time.Second)
+	mc.Store("b1", &Result{Active: true, Sub: "bob"}, time.Second)
+	mc.Store("a2", &Result{Active: true, Sub: "carol"}, 90*time.Second)
+
+	if len(mc.subjects["alice"]) != 1 || len(mc.subjects["carol"]) != 1 {
+		t.Fatalf("overwritten entry should move to its new subject: %v", mc.subjects)
+	}
+
+	clock.advance(time.Minute)
+
+	if len(mc.subjects) != 1 || len(mc.subjects["carol"]) != 1 {
+		t.Fatalf("expired entries should leave the index: %v", mc.subjects)
+	}
+
+	clock.advance(time.Minute)
+
+	if len(mc.subjects) != 0 {
+		t.Fatalf("index should be empty once the cache is: %v", mc.subjects)
+	}
+}
+
+func TestInMemoryCacheBaseContext(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mc := NewInMemoryCache(CacheClock(clock), CacheBaseContext(ctx)).(*inMemoryCache)
+	mc.Store("token", &Result{Active: true}, time.Second)
+
+	if mc.janitor == nil {
+		t.Fatal("janitor should be scheduled once the cache has entries")
+	}
+
+	cancel()
+
+	// the janitor is stopped asynchronously, once the context is done
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		mc.RLock()
+		stopped := mc.stopped && mc.janitor == nil
+		mc.RUnlock()
+
+		if stopped {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("janitor should stop once the base context is done")
+		}
+	}
+
+	mc.Store("other", &Result{Active: true}, time.Second)
+
+	if mc.janitor != nil {
+		t.Fatal("no janitor should be scheduled after the base context is done")
+	}
+
+	if mc.Get("other") == nil {
+		t.Fatal("the cache should keep working")
+	}
+}
@@ -1,7 +1,11 @@
 package introspection_test
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -10,6 +14,7 @@ import (
 	"time"
 
 	"github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
 )
 
 func TestInMemoryCacheBasic(t *testing.T) {
@@ -23,21 +28,45 @@ func TestInMemoryCacheBasic(t *testing.T) {
 }
 
 func TestInMemoryCacheExpiry(t *testing.T) {
-	c := introspection.NewInMemoryCache()
+	clock := introspectiontest.NewClock(time.Now())
+
+	c := introspection.NewInMemoryCache(introspection.CacheClock(clock))
 
 	res := introspection.Result{Active: true}
 
 	c.Store("key", &res, 2*time.Millisecond)
 
-	time.Sleep(1 * time.Microsecond)
+	clock.Advance(1 * time.Millisecond)
 
 	equals(t, res, *c.Get("key"))
 
-	time.Sleep(3 * time.Millisecond)
+	clock.Advance(1 * time.Millisecond)
 
 	assert(t, c.Get("key") == nil, "key should have expired")
 }
 
+func TestInMemoryCacheLazyExpiry(t *testing.T) {
+	clock := introspectiontest.NewClock(time.Now())
+
+	c := introspection.NewInMemoryCache(introspection.CacheClock(clock), introspection.CacheSweepInterval(time.Hour))
+
+	res := introspection.Result{Active: true}
+
+	c.Store("key", &res, time.Second)
+
+	clock.Advance(time.Second - time.Nanosecond)
+
+	equals(t, res, *c.Get("key"))
+
+	clock.Advance(time.Nanosecond)
+
+	assert(t, c.Get("key") == nil, "key should have expired before the janitor ran")
+
+	c.Store("key", &res, time.Second)
+
+	equals(t, res, *c.Get("key"))
+}
+
 func TestInMemoryCacheParallel(t *testing.T) {
 	c := introspection.NewInMemoryCache()
 
@@ -62,6 +91,121 @@ func TestInMemoryCacheParallel(t *testing.T) {
 	equals(t, res, *c.Get("key"))
 }
 
+func BenchmarkInMemoryCacheStore(b *testing.B) {
+	c := introspection.NewInMemoryCache()
+
+	res := introspection.Result{Active: true}
+
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("token-%d", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.Store(keys[i%len(keys)], &res, time.Minute)
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	clock := introspectiontest.NewClock(time.Now())
+
+	c := introspection.NewShardedCache(8, introspection.CacheClock(clock))
+
+	for i := 0; i < 100; i++ {
+		res := introspection.Result{Active: i%2 == 0}
+		c.Store(fmt.Sprint("key", i), &res, time.Duration(i+1)*time.Second)
+	}
+
+	for i := 0; i < 100; i++ {
+		equals(t, introspection.Result{Active: i%2 == 0}, *c.Get(fmt.Sprint("key", i)))
+	}
+
+	clock.Advance(50 * time.Second)
+
+	for i := 0; i < 100; i++ {
+		equals(t, i >= 50, c.Get(fmt.Sprint("key", i)) != nil)
+	}
+
+	assert(t, introspection.NewShardedCache(0).Get("key") == nil, "a cache with no shards should still work")
+}
+
+func TestShardedCacheMatchesInMemoryCache(t *testing.T) {
+	clock := introspectiontest.NewClock(time.Now())
+
+	single := introspection.NewInMemoryCache(introspection.CacheClock(clock))
+	sharded := introspection.NewShardedCache(16, introspection.CacheClock(clock))
+
+	results := []introspection.Result{{Active: true}, {Active: false}}
+
+	for step := 0; step < 200; step++ {
+		key := fmt.Sprint("key", step%37)
+
+		if step%3 == 0 {
+			res := &results[step%2]
+			exp := time.Duration(step%7) * time.Second
+
+			single.Store(key, res, exp)
+			sharded.Store(key, res, exp)
+		}
+
+		equals(t, single.Get(key), sharded.Get(key))
+
+		clock.Advance(500 * time.Millisecond)
+	}
+}
+
+// benchmarkCacheParallel runs parallel lookups over many distinct keys, every writeEvery-th operation is a Store, 0 for none
+func benchmarkCacheParallel(b *testing.B, c introspection.Cache, writeEvery int) {
+	res := introspection.Result{Active: true}
+
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("token-%d", i)
+		c.Store(keys[i], &res, time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if writeEvery > 0 && i%writeEvery == 0 {
+				c.Store(key, &res, time.Hour)
+			} else {
+				c.Get(key)
+			}
+			i += 7919
+		}
+	})
+}
+
+func BenchmarkCacheParallelRead(b *testing.B) {
+	b.Run("InMemory", func(b *testing.B) {
+		benchmarkCacheParallel(b, introspection.NewInMemoryCache(), 0)
+	})
+
+	b.Run("Sharded", func(b *testing.B) {
+		benchmarkCacheParallel(b, introspection.NewShardedCache(32), 0)
+	})
+}
+
+func BenchmarkCacheParallelMixed(b *testing.B) {
+	for _, writeEvery := range []int{2, 4, 16} {
+		b.Run(fmt.Sprintf("InMemory/1in%d", writeEvery), func(b *testing.B) {
+			benchmarkCacheParallel(b, introspection.NewInMemoryCache(), writeEvery)
+		})
+
+		b.Run(fmt.Sprintf("Sharded/1in%d", writeEvery), func(b *testing.B) {
+			benchmarkCacheParallel(b, introspection.NewShardedCache(32), writeEvery)
+		})
+	}
+}
+
 func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
 	if !condition {
 		_, file, line, _ := runtime.Caller(1)
@@ -85,3 +229,174 @@ func equals(tb testing.TB, exp, act interface{}) {
 		tb.FailNow()
 	}
 }
+
+func TestCacheDiscriminator(t *testing.T) {
+	calls := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get("X-Tenant")
+		calls[tenant]++
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "tenant": tenant})
+	}))
+	defer ts.Close()
+
+	var tenant string
+	h := introspection.Introspection(ts.URL,
+		introspection.WithCache(introspection.NewInMemoryCache(), time.Minute),
+		introspection.WithCacheDiscriminator(func(r *http.Request) string { return r.Header.Get("X-Tenant") }),
+		introspection.WithRequestModifier(func(r *http.Request) { r.Header.Set("X-Tenant", tenant) }),
+	)
+
+	serve := func(id string) *introspection.Result {
+		tenant = id
+
+		var res *introspection.Result
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+		req.Header.Add("X-Tenant", id)
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, _ = introspection.FromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, id := range []string{"a", "b"} {
+			res := serve(id)
+
+			assert(t, res.Active, "token should be active")
+			equals(t, json.RawMessage(`"`+id+`"`), res.Optionals["tenant"])
+			equals(t, i > 0, res.FromCache)
+		}
+	}
+
+	equals(t, map[string]int{"a": 1, "b": 1}, calls)
+}
+
+func TestErrorCacheDiscriminator(t *testing.T) {
+	calls := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get("X-Tenant")
+		calls[tenant]++
+
+		if tenant == "a" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	var tenant string
+	h := introspection.Introspection(ts.URL,
+		introspection.WithErrorCacheTTL(time.Minute),
+		introspection.WithCacheDiscriminator(func(r *http.Request) string { return r.Header.Get("X-Tenant") }),
+		introspection.WithRequestModifier(func(r *http.Request) { r.Header.Set("X-Tenant", tenant) }),
+	)
+
+	serve := func(id string) error {
+		tenant = id
+
+		var err error
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+		req.Header.Add("X-Tenant", id)
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err = introspection.FromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return err
+	}
+
+	assert(t, serve("a") != nil, "tenant a should fail")
+	assert(t, serve("a") != nil, "tenant a should fail from the error cache")
+	equals(t, nil, serve("b"))
+
+	equals(t, map[string]int{"a": 1, "b": 1}, calls)
+}
+
+func TestInvalidateSubject(t *testing.T) {
+	hits := make(map[string]int)
+	var mu sync.Mutex
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.PostFormValue("token")
+
+		mu.Lock()
+		hits[token]++
+		mu.Unlock()
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": token[:len(token)-1]})
+	}))
+	defer ts.Close()
+
+	tokens := []string{"alice1", "alice2", "alice3", "bob1"}
+
+	caches := map[string]introspection.Cache{
+		"Indexed":         introspection.NewInMemoryCache(introspection.CacheSubjectIndex()),
+		"Scanned":         introspection.NewInMemoryCache(),
+		"Sharded Indexed": introspection.NewShardedCache(4, introspection.CacheSubjectIndex()),
+	}
+
+	for name, cache := range caches {
+		t.Run(name, func(t *testing.T) {
+			hits = make(map[string]int)
+
+			h := introspection.Introspection(ts.URL, introspection.WithCache(cache, time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			serveAll := func() {
+				for _, token := range tokens {
+					serveStatus(h, token)
+				}
+			}
+
+			serveAll()
+			serveAll()
+			equals(t, map[string]int{"alice1": 1, "alice2": 1, "alice3": 1, "bob1": 1}, hits)
+
+			ok(t, introspection.InvalidateSubject(context.Background(), cache, "alice"))
+
+			serveAll()
+			equals(t, map[string]int{"alice1": 2, "alice2": 2, "alice3": 2, "bob1": 1}, hits)
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		err := introspection.InvalidateSubject(context.Background(), struct{ introspection.Cache }{}, "alice")
+		equals(t, introspection.ErrInvalidationUnsupported, err)
+	})
+}
+
+func TestNoCachePredicate(t *testing.T) {
+	calls := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.PostFormValue("token")
+		calls[token]++
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "admin": token == "admin"})
+	}))
+	defer ts.Close()
+
+	h := introspection.Introspection(ts.URL,
+		introspection.WithCache(introspection.NewInMemoryCache(), time.Minute),
+		introspection.WithNoCachePredicate(func(res *introspection.Result) bool {
+			return string(res.Optionals["admin"]) == "true"
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		serveStatus(h, "admin")
+		serveStatus(h, "user")
+	}
+
+	equals(t, map[string]int{"admin": 3, "user": 1}, calls)
+}
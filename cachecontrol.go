@@ -0,0 +1,68 @@
+package introspection
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithRespectCacheControl lets the Cache-Control header of introspection responses shorten how long their results are cached:
+// max-age=N caches the result for at most N seconds, no-store and no-cache keep it out of the cache. The expiry passed to WithCache,
+// or the limits of WithSlidingCacheExpiration, and the token's expiry still cap the lifetime, responses without the header are
+// cached as usual.
+func WithRespectCacheControl() Option {
+	return func(opt *Options) {
+		opt.respectCacheControl = true
+	}
+}
+
+// cacheControl holds the Cache-Control directives of an introspection response relevant to caching its result
+type cacheControl struct {
+	noStore bool
+	// maxAge is only meaningful when hasMaxAge is set
+	maxAge    time.Duration
+	hasMaxAge bool
+}
+
+// parseCacheControl parses the directives of a Cache-Control header value, as per rfc9111 section 5.2
+func parseCacheControl(v string) cacheControl {
+	var cc cacheControl
+
+	for _, directive := range strings.Split(v, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			cc.noStore = true
+		case "max-age":
+			sec, err := strconv.ParseUint(strings.Trim(arg, `"`), 10, 32)
+			if err != nil {
+				// an invalid max-age is to be treated as stale, see rfc9111 section 4.2.1
+				cc.noStore = true
+				continue
+			}
+
+			if d := time.Duration(sec) * time.Second; !cc.hasMaxAge || d < cc.maxAge {
+				cc.maxAge, cc.hasMaxAge = d, true
+			}
+		}
+	}
+
+	return cc
+}
+
+// capCacheControl caps exp, the time res may remain cached from now, by the Cache-Control header of its response
+func capCacheControl(res *Result, exp time.Duration, now time.Time) time.Duration {
+	cc := res.cacheControl
+	if cc.noStore {
+		return 0
+	}
+
+	if cc.hasMaxAge {
+		if left := res.RetrievedAt.Add(cc.maxAge).Sub(now); left < exp {
+			return left
+		}
+	}
+
+	return exp
+}
@@ -0,0 +1,88 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestRespectCacheControl(t *testing.T) {
+	tt := []struct {
+		name   string
+		header string
+		// cached is how long the result is expected to be served from the cache
+		cached time.Duration
+	}{
+		{name: "Max Age", header: "max-age=10", cached: 10 * time.Second},
+		{name: "Max Age With Other Directives", header: "private, max-age=20, must-revalidate", cached: 20 * time.Second},
+		{name: "Max Age Capped By Configured TTL", header: "max-age=3600", cached: time.Minute},
+		{name: "No Store", header: "no-store"},
+		{name: "No Cache", header: "no-cache"},
+		{name: "Invalid Max Age", header: "max-age=soon"},
+		{name: "Absent", cached: time.Minute},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var hits int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+
+				if tc.header != "" {
+					w.Header().Set("Cache-Control", tc.header)
+				}
+				w.Header().Add("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+			}))
+			defer ts.Close()
+
+			clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+			h := intro.Introspection(ts.URL,
+				intro.WithClock(clock),
+				intro.WithCache(intro.NewInMemoryCache(intro.CacheClock(clock)), time.Minute),
+				intro.WithRespectCacheControl(),
+			)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			serveStatus(h, "token")
+
+			if tc.cached == 0 {
+				serveStatus(h, "token")
+				equals(t, 2, hits)
+				return
+			}
+
+			clock.Advance(tc.cached - time.Second)
+			serveStatus(h, "token")
+			equals(t, 1, hits)
+
+			clock.Advance(time.Second)
+			serveStatus(h, "token")
+			equals(t, 2, hits)
+		})
+	}
+}
+
+func TestCacheControlIgnoredByDefault(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	h := intro.Introspection(ts.URL, intro.WithCache(intro.NewInMemoryCache(), time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serveStatus(h, "token")
+	serveStatus(h, "token")
+
+	equals(t, 1, hits)
+}
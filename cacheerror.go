@@ -0,0 +1,132 @@
+package introspection
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FallibleCache is implemented by caches whose operations can fail, e.g. those backed by a network service like Redis. The
+// middleware uses its methods instead of Get and Store. Cache failures never fail requests: a failed lookup is a cache miss and a
+// failed store is skipped, both are reported to Hooks.OnCacheError. Panics of any Cache are handled the same way.
+type FallibleCache interface {
+	Cache
+
+	// GetContext is Get reporting failures, a missing entry is not one
+	GetContext(ctx context.Context, key string) (*Result, error)
+	// StoreContext is Store reporting failures
+	StoreContext(ctx context.Context, key string, res *Result, exp time.Duration) error
+}
+
+// WithCacheCircuitBreaker stops using the cache for cooldown once failures of its operations failed in a row, see FallibleCache,
+// so that requests don't keep waiting on a broken cache. Tokens are then introspected on every request. After the cooldown the
+// cache is tried again, a single failure starts another cooldown.
+func WithCacheCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(opt *Options) {
+		opt.cacheBreaker = &cacheBreaker{threshold: failures, cooldown: cooldown}
+	}
+}
+
+// cacheBreaker counts consecutive cache failures, see WithCacheCircuitBreaker
+type cacheBreaker struct {
+	sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether the cache may be used at now
+func (b *cacheBreaker) allow(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return !now.Before(b.openUntil)
+}
+
+// record counts the outcome of a cache operation at now
+func (b *cacheBreaker) record(err error, now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+		// the next failure after the cooldown opens the breaker again
+		b.failures = b.threshold - 1
+	}
+}
+
+// cacheOp runs the operation op of the cache on key with fn, turning panics into errors. It reports whether fn succeeded, failures
+// are reported to Hooks.OnCacheError. It doesn't run fn while the circuit breaker is open.
+func cacheOp(ctx context.Context, op, key string, opt *Options, fn func() error) bool {
+	if opt.cacheBreaker != nil && !opt.cacheBreaker.allow(opt.clock.Now()) {
+		return false
+	}
+
+	err := func() (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("introspection: cache %s panicked: %v", op, v)
+			}
+		}()
+
+		return fn()
+	}()
+
+	if opt.cacheBreaker != nil {
+		opt.cacheBreaker.record(err, opt.clock.Now())
+	}
+
+	if err != nil {
+		opt.hooks.cacheError(ctx, op, fingerprint(key), err)
+		return false
+	}
+
+	return true
+}
+
+// cachedResult returns the result cached under key, with the metadata of its entry when the cache is an EntryInspector, or nil
+// when there is none or the cache failed
+func cachedResult(ctx context.Context, key string, opt *Options) (res *Result, entry *EntryInfo) {
+	cacheOp(ctx, "get", key, opt, func() (err error) {
+		switch c := opt.cache.(type) {
+		case FallibleCache:
+			res, err = c.GetContext(ctx, key)
+		case EntryInspector:
+			var info EntryInfo
+			res, info = c.GetEntry(key)
+			entry = &info
+		default:
+			res = opt.cache.Get(key)
+		}
+
+		return err
+	})
+
+	if res == nil {
+		return nil, nil
+	}
+
+	return res, entry
+}
+
+// storeResult caches res under key for exp, unless the cache fails
+func storeResult(ctx context.Context, key string, res *Result, exp time.Duration, opt *Options) {
+	cacheOp(ctx, "store", key, opt, func() error {
+		if c, ok := opt.cache.(FallibleCache); ok {
+			return c.StoreContext(ctx, key, res, exp)
+		}
+
+		opt.cache.Store(key, res, exp)
+		return nil
+	})
+}
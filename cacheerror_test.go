@@ -0,0 +1,123 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+var errCacheDown = errors.New("cache is down")
+
+// failingCache is a FallibleCache whose every operation fails, counting the calls it gets
+type failingCache struct {
+	calls int
+}
+
+func (c *failingCache) Get(key string) *intro.Result {
+	panic("Get should not be called")
+}
+
+func (c *failingCache) Store(key string, res *intro.Result, exp time.Duration) {
+	panic("Store should not be called")
+}
+
+func (c *failingCache) GetContext(context.Context, string) (*intro.Result, error) {
+	c.calls++
+	return nil, errCacheDown
+}
+
+func (c *failingCache) StoreContext(context.Context, string, *intro.Result, time.Duration) error {
+	c.calls++
+	return errCacheDown
+}
+
+// panickingCache is a Cache whose every operation panics
+type panickingCache struct{}
+
+func (panickingCache) Get(key string) *intro.Result                           { panic("boom") }
+func (panickingCache) Store(key string, res *intro.Result, exp time.Duration) { panic("boom") }
+
+func TestCacheErrors(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	type cacheError struct {
+		op  string
+		err error
+	}
+
+	setup := func(cache intro.Cache, opts ...intro.Option) (http.Handler, *[]cacheError) {
+		hits = 0
+
+		var errs []cacheError
+		hooks := intro.Hooks{OnCacheError: func(_ context.Context, op, key string, err error) {
+			assert(t, key != "token", "the key should not reveal the token")
+			errs = append(errs, cacheError{op, err})
+		}}
+
+		opts = append([]intro.Option{intro.WithCache(cache, time.Minute), intro.WithHooks(hooks), intro.WithEnforcement()}, opts...)
+		h := intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		return h, &errs
+	}
+
+	t.Run("Failing", func(t *testing.T) {
+		h, errs := setup(&failingCache{})
+
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+
+		equals(t, 2, hits)
+		equals(t, []cacheError{{"get", errCacheDown}, {"store", errCacheDown}, {"get", errCacheDown}, {"store", errCacheDown}}, *errs)
+	})
+
+	t.Run("Panicking", func(t *testing.T) {
+		h, errs := setup(panickingCache{})
+
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+
+		equals(t, 1, hits)
+		equals(t, 2, len(*errs))
+		equals(t, "get", (*errs)[0].op)
+		equals(t, "store", (*errs)[1].op)
+	})
+
+	t.Run("Circuit Breaker", func(t *testing.T) {
+		clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+		cache := &failingCache{}
+
+		h, errs := setup(cache, intro.WithClock(clock), intro.WithCacheCircuitBreaker(3, time.Minute))
+
+		// get and store fail for the first request, get for the second which opens the breaker
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+		equals(t, 3, cache.calls)
+
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+		equals(t, 3, cache.calls)
+		equals(t, 3, len(*errs))
+
+		clock.Advance(time.Minute)
+
+		// a single failure after the cooldown opens the breaker again
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+		equals(t, 4, cache.calls)
+		equals(t, http.StatusOK, serveStatus(h, "token"))
+		equals(t, 4, cache.calls)
+
+		equals(t, 5, hits)
+	})
+}
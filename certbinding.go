@@ -0,0 +1,84 @@
+package introspection
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ErrCertificateMismatch is returned by FromContext when a certificate bound token was not presented over mutual TLS with the
+// certificate it is bound to, see WithCertificateBinding
+var ErrCertificateMismatch = errors.New("token is not bound to the client certificate")
+
+const peerCertificateKey = resKeyType(5)
+
+// WithCertificateBinding enforces rfc8705 certificate bound tokens: active results whose cnf claim has an x5t#S256 member are
+// only accepted from clients that authenticated with the certificate of that SHA-256 thumbprint over mutual TLS, otherwise they
+// fail with ErrCertificateMismatch, which WithEnforcement rejects with 401 or codes.Unauthenticated. The HTTP middleware reads
+// the client certificate from the request's TLS connection state, the gRPC AuthFunc from the credentials.TLSInfo of the peer.
+// Requests over plaintext connections carrying bound tokens are rejected too. Tokens that are not bound are accepted as usual.
+func WithCertificateBinding() Option {
+	return func(opt *Options) {
+		opt.certificateBinding = true
+	}
+}
+
+// certificateContext returns ctx carrying the client certificate of r, if WithCertificateBinding is used
+func certificateContext(ctx context.Context, r *http.Request, opt *Options) context.Context {
+	if !opt.certificateBinding {
+		return ctx
+	}
+
+	var cert *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert = r.TLS.PeerCertificates[0]
+	}
+
+	return context.WithValue(ctx, peerCertificateKey, cert)
+}
+
+// peerCertificate returns the client certificate of the request or call ctx belongs to, or nil
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	if cert, ok := ctx.Value(peerCertificateKey).(*x509.Certificate); ok {
+		return cert
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return info.State.PeerCertificates[0]
+}
+
+// checkCertificateBinding fails with ErrCertificateMismatch if res is bound to a certificate other than the client's
+func checkCertificateBinding(ctx context.Context, res *Result) error {
+	cnf, ok := res.Cnf()
+	if !ok || cnf.X5tS256 == "" {
+		return nil
+	}
+
+	cert := peerCertificate(ctx)
+	if cert == nil || certificateThumbprint(cert) != cnf.X5tS256 {
+		return ErrCertificateMismatch
+	}
+
+	return nil
+}
+
+// certificateThumbprint returns the x5t#S256 confirmation method value for cert, see rfc8705 section 3.1
+func certificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,235 @@
+package introspection_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	intro "github.com/srikrsna/oauth-introspection"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestCertificateBindingGRPC(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, "bufnet")
+	boundCert := ca.issue(t, "bound-client")
+	otherCert := ca.issue(t, "other-client")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		data := map[string]interface{}{"active": true}
+		if r.PostFormValue("token") == "bound" {
+			data["cnf"] = map[string]string{"x5t#S256": thumbprint(boundCert)}
+		}
+
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer ts.Close()
+
+	auth := intro.AuthFunc(ts.URL, intro.WithCertificateBinding(), intro.WithEnforcement())
+
+	tlsServer := echoGRPCServer(t, auth, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	})))
+	plainServer := echoGRPCServer(t, auth)
+
+	withCert := func(cert *tls.Certificate) grpc.DialOption {
+		cfg := &tls.Config{RootCAs: ca.pool, ServerName: "bufnet"}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
+
+		return grpc.WithTransportCredentials(credentials.NewTLS(cfg))
+	}
+
+	tt := []struct {
+		name   string
+		lis    *bufconn.Listener
+		dial   grpc.DialOption
+		token  string
+		expect codes.Code
+	}{
+		{name: "Match", lis: tlsServer, dial: withCert(&boundCert), token: "bound", expect: codes.OK},
+		{name: "Mismatch", lis: tlsServer, dial: withCert(&otherCert), token: "bound", expect: codes.Unauthenticated},
+		{name: "No Client Certificate", lis: tlsServer, dial: withCert(nil), token: "bound", expect: codes.Unauthenticated},
+		{name: "Plaintext", lis: plainServer, dial: grpc.WithInsecure(), token: "bound", expect: codes.Unauthenticated},
+		{name: "Unbound Without Certificate", lis: tlsServer, dial: withCert(nil), token: "unbound", expect: codes.OK},
+		{name: "Unbound Plaintext", lis: plainServer, dial: grpc.WithInsecure(), token: "unbound", expect: codes.OK},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			lis := tc.lis
+			conn, err := grpc.Dial("bufnet", tc.dial, grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+				return lis.Dial()
+			}))
+			ok(t, err)
+			defer conn.Close()
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tc.token)
+			err = conn.Invoke(ctx, "/test.Echo/Echo", &wrappers.StringValue{Value: "ping"}, &wrappers.StringValue{})
+
+			equals(t, tc.expect, status.Code(err))
+		})
+	}
+}
+
+func TestCertificateBindingHTTP(t *testing.T) {
+	ca := newTestCA(t)
+	boundCert := ca.issue(t, "bound-client")
+	otherCert := ca.issue(t, "other-client")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+			"cnf":    map[string]string{"x5t#S256": thumbprint(boundCert)},
+		})
+	}))
+	defer ts.Close()
+
+	h := intro.Introspection(ts.URL, intro.WithCertificateBinding(), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(state *tls.ConnectionState) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+		req.TLS = state
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	equals(t, http.StatusOK, serve(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{boundCert.Leaf}}))
+	equals(t, http.StatusUnauthorized, serve(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{otherCert.Leaf}}))
+	equals(t, http.StatusUnauthorized, serve(&tls.ConnectionState{}))
+	equals(t, http.StatusUnauthorized, serve(nil))
+}
+
+// echoGRPCServer serves a test.Echo service guarded by auth, returning the listener to dial
+func echoGRPCServer(t *testing.T, auth grpc_auth.AuthFunc, opts ...grpc.ServerOption) *bufconn.Listener {
+	return testGRPCServer(t, auth, func(ctx context.Context, in *wrappers.StringValue) (interface{}, error) { return in, nil }, opts...)
+}
+
+// testGRPCServer serves a test.Echo service guarded by auth whose Echo method is handle, returning the listener to dial
+func testGRPCServer(t *testing.T, auth grpc_auth.AuthFunc, handle func(ctx context.Context, in *wrappers.StringValue) (interface{}, error), opts ...grpc.ServerOption) *bufconn.Listener {
+	lis := bufconn.Listen(1 << 20)
+
+	srv := grpc.NewServer(append(opts, grpc.UnaryInterceptor(grpc_auth.UnaryServerInterceptor(auth)))...)
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Echo",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				var in wrappers.StringValue
+				if err := dec(&in); err != nil {
+					return nil, err
+				}
+
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return handle(ctx, req.(*wrappers.StringValue))
+				}
+				return interceptor(ctx, &in, &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Echo"}, handler)
+			},
+		}},
+	}, struct{}{})
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	return lis
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	ok(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	ok(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for name, a host name or IP address, usable by both servers and clients
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	ok(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if ip := net.ParseIP(name); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	ok(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	ok(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func thumbprint(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Certificate[0])
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoIntrospection is returned when building a Chain that has no endpoint and no Introspector, its requirements could never pass
+var ErrNoIntrospection = errors.New("introspection: chain has neither an endpoint nor an Introspector")
+
+// Chain builds the introspection middleware together with requirement middlewares, such as RequireActive, in the right order:
+// introspection first, then the requirements in the order they were added. The same chain can be built for net/http and gRPC.
+type Chain struct {
+	endpoint string
+	opts     []Option
+
+	checks []func(context.Context) error
+	// audience is the index in checks of the check added by RequireAudience plus one, zero without one
+	audience int
+}
+
+// NewChain returns a Chain introspecting tokens against endpoint with opts
+func NewChain(endpoint string, opts ...Option) *Chain {
+	return &Chain{endpoint: endpoint, opts: opts}
+}
+
+// Derive returns a new Chain for another group of routes, introspecting like c with opts added to its options and requiring
+// what c requires. Changes to either chain don't affect the other. The middlewares built from both share the cache passed with
+// WithCache, and the connection pool unless a Client is configured, while a RequireAudience on the derived chain replaces the
+// audience c requires, e.g.
+//
+//	api := introspection.NewChain(endpoint, introspection.WithCache(cache, time.Minute)).RequireActive()
+//	orders, _ := api.Derive().RequireAudience("https://orders.example.com", true).Handler(ordersHandler)
+//	billing, _ := api.Derive().RequireAudience("https://billing.example.com", true).Handler(billingHandler)
+func (c *Chain) Derive(opts ...Option) *Chain {
+	return &Chain{
+		endpoint: c.endpoint,
+		opts:     append(append([]Option(nil), c.opts...), opts...),
+		checks:   append([]func(context.Context) error(nil), c.checks...),
+		audience: c.audience,
+	}
+}
+
+// RequireActive adds the check performed by RequireActive
+func (c *Chain) RequireActive() *Chain {
+	c.checks = append(c.checks, requireActive)
+	return c
+}
+
+// RequireScopes adds the check performed by RequireScopes
+func (c *Chain) RequireScopes(scopes ...string) *Chain {
+	c.checks = append(c.checks, requireScopes(scopes))
+	return c
+}
+
+// RequireAllScopes adds the check performed by RequireAllScopes
+func (c *Chain) RequireAllScopes(scopes ...string) *Chain {
+	return c.RequireScopes(scopes...)
+}
+
+// RequireAnyScope adds the check performed by RequireAnyScope
+func (c *Chain) RequireAnyScope(scopes ...string) *Chain {
+	c.checks = append(c.checks, requireAnyScope(scopes))
+	return c
+}
+
+// RequireAudience adds the check performed by RequireAudience, replacing the one added before, if any
+func (c *Chain) RequireAudience(aud string, normalized bool) *Chain {
+	check := requireAudience(aud, normalized)
+	if c.audience > 0 {
+		c.checks[c.audience-1] = check
+		return c
+	}
+
+	c.checks = append(c.checks, check)
+	c.audience = len(c.checks)
+	return c
+}
+
+// RequireMaxTokenAge adds the check performed by RequireMaxTokenAge
+func (c *Chain) RequireMaxTokenAge(d time.Duration, allowMissingIat bool) *Chain {
+	c.checks = append(c.checks, requireMaxTokenAge(d, allowMissingIat))
+	return c
+}
+
+// RequirePermission adds the check performed by RequirePermission
+func (c *Chain) RequirePermission(resource string, scopes ...string) *Chain {
+	c.checks = append(c.checks, requirePermission(resource, scopes))
+	return c
+}
+
+// Handler returns next wrapped by the introspection middleware and the requirements
+func (c *Chain) Handler(next http.Handler) (http.Handler, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	for i := len(c.checks) - 1; i >= 0; i-- {
+		next = requirement(c.checks[i])(next)
+	}
+
+	return Introspection(c.endpoint, c.opts...)(next), nil
+}
+
+// AuthFunc returns an AuthFunc that introspects like the one returned by AuthFunc and then applies the requirements,
+// failing calls that don't meet them with a status error
+func (c *Chain) AuthFunc() (grpc_auth.AuthFunc, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	authenticate := AuthFunc(c.endpoint, c.opts...)
+	checks := append([]func(context.Context) error(nil), c.checks...)
+
+	return func(ctx context.Context) (context.Context, error) {
+		ctx, err := authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, check := range checks {
+			if _, err := challengeScopes(check(ctx)); err != nil && !shadowed(ctx, err) {
+				return nil, status.Error(grpcCode(err), err.Error())
+			}
+		}
+
+		return ctx, nil
+	}, nil
+}
+
+// UnaryServerInterceptor returns a unary server interceptor applying the chain's AuthFunc
+func (c *Chain) UnaryServerInterceptor() (grpc.UnaryServerInterceptor, error) {
+	fn, err := c.AuthFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc_auth.UnaryServerInterceptor(fn), nil
+}
+
+// StreamServerInterceptor returns a stream server interceptor applying the chain's AuthFunc
+func (c *Chain) StreamServerInterceptor() (grpc.StreamServerInterceptor, error) {
+	fn, err := c.AuthFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc_auth.StreamServerInterceptor(fn), nil
+}
+
+func (c *Chain) validate() error {
+	opt, client := applyOptions(c.endpoint, c.opts)
+	if err := checkConflicts(&opt, client); err != nil {
+		return err
+	}
+
+	if opt.endpoint == "" && opt.introspector == nil && opt.endpointPool == nil {
+		return ErrNoIntrospection
+	}
+
+	return nil
+}
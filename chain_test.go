@@ -0,0 +1,207 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// scopeServer answers with an inactive result for the token "inactive", otherwise with an active result whose scope is the token
+func scopeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		token := r.PostFormValue("token")
+		if token == "inactive" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "scope": token})
+	}))
+}
+
+var chainCases = []struct {
+	name  string
+	token string
+	code  int
+}{
+	{name: "No Token", code: http.StatusUnauthorized},
+	{name: "Inactive", token: "inactive", code: http.StatusUnauthorized},
+	{name: "Missing Scope", token: "read", code: http.StatusForbidden},
+	{name: "Allowed", token: "read write", code: http.StatusOK},
+}
+
+func serveStatus(h http.Handler, token string) int {
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	return rr.Code
+}
+
+func TestChain(t *testing.T) {
+	ts := scopeServer()
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	chained, err := intro.NewChain(ts.URL).RequireActive().RequireScopes("read", "write").Handler(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manual := intro.Introspection(ts.URL)(intro.RequireActive()(intro.RequireScopes("read", "write")(next)))
+
+	for _, tc := range chainCases {
+		t.Run(tc.name, func(t *testing.T) {
+			equals(t, tc.code, serveStatus(chained, tc.token))
+			equals(t, tc.code, serveStatus(manual, tc.token))
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	ts := scopeServer()
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Introspection First", func(t *testing.T) {
+		misordered := intro.RequireActive()(intro.Introspection(ts.URL)(next))
+		chained, err := intro.NewChain(ts.URL).RequireActive().Handler(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		equals(t, http.StatusUnauthorized, serveStatus(misordered, "read"))
+		equals(t, http.StatusOK, serveStatus(chained, "read"))
+	})
+
+	t.Run("Requirements After Introspection", func(t *testing.T) {
+		var order []string
+		check := func(name string) func(context.Context, *intro.Result) error {
+			return func(context.Context, *intro.Result) error {
+				order = append(order, name)
+				return nil
+			}
+		}
+
+		h, err := intro.NewChain(ts.URL, intro.WithResultValidator(check("introspection"))).RequireScopes("write").RequireActive().Handler(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		equals(t, http.StatusForbidden, serveStatus(h, "read"))
+		equals(t, []string{"introspection"}, order)
+	})
+}
+
+func TestChainValidation(t *testing.T) {
+	c := intro.NewChain("").RequireActive()
+
+	_, err := c.Handler(http.NotFoundHandler())
+	equals(t, intro.ErrNoIntrospection, err)
+
+	_, err = c.UnaryServerInterceptor()
+	equals(t, intro.ErrNoIntrospection, err)
+
+	_, err = c.StreamServerInterceptor()
+	equals(t, intro.ErrNoIntrospection, err)
+}
+
+func TestChainUnaryServerInterceptor(t *testing.T) {
+	ts := scopeServer()
+	defer ts.Close()
+
+	interceptor, err := intro.NewChain(ts.URL).RequireActive().RequireScopes("read", "write").UnaryServerInterceptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codesByStatus := map[int]codes.Code{
+		http.StatusUnauthorized: codes.Unauthenticated,
+		http.StatusForbidden:    codes.PermissionDenied,
+		http.StatusOK:           codes.OK,
+	}
+
+	for _, tc := range chainCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tc.token))
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				_, err := intro.Authorize(ctx, "read", "write")
+				return nil, err
+			})
+
+			equals(t, codesByStatus[tc.code], status.Code(err))
+		})
+	}
+}
+
+func TestChainDerive(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Add("Content-Type", "application/json")
+
+		// tokens are named after their audience
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "aud": "https://" + r.PostFormValue("token") + ".example.com/"})
+	}))
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	api := intro.NewChain(ts.URL, intro.WithCache(intro.NewInMemoryCache(), time.Minute)).RequireActive().RequireAudience("https://default.example.com", true)
+
+	orders, err := api.Derive().RequireAudience("https://orders.example.com", true).Handler(next)
+	ok(t, err)
+
+	billing, err := api.Derive().RequireAudience("https://billing.example.com", true).Handler(next)
+	ok(t, err)
+
+	parent, err := api.Handler(next)
+	ok(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/orders", orders)
+	mux.Handle("/billing", billing)
+	mux.Handle("/", parent)
+
+	serve := func(path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	equals(t, http.StatusOK, serve("/orders", "orders"))
+	equals(t, http.StatusUnauthorized, serve("/orders", "billing"))
+	equals(t, http.StatusOK, serve("/billing", "billing"))
+	equals(t, http.StatusUnauthorized, serve("/billing", "orders"))
+	equals(t, http.StatusOK, serve("/", "default"))
+	equals(t, http.StatusUnauthorized, serve("/", "orders"))
+	equals(t, http.StatusUnauthorized, serve("/orders", "inventory"))
+
+	// the cache is shared by the route groups
+	equals(t, 4, calls)
+}
@@ -0,0 +1,368 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EffectiveExpiry returns the time at which the token expires. The exp claim is preferred, when it is absent the non standard
+// expires_in claim, taken as seconds relative to now, is used. ok is false when neither claim is present or parsable.
+func (r *Result) EffectiveExpiry(now time.Time) (exp time.Time, ok bool) {
+	if raw, ok := r.Optionals["exp"]; ok {
+		if sec, err := parseNumericDate("exp", raw); err == nil {
+			return time.Unix(sec, 0), true
+		}
+	}
+
+	if raw, ok := r.Optionals["expires_in"]; ok {
+		if sec, err := parseSeconds("expires_in", raw); err == nil {
+			return now.Add(time.Duration(sec) * time.Second), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// IsExpired reports whether the exp claim of the token is present and not after now.
+// See EffectiveExpiry for tokens that may only have expires_in, and WithDerivedExp.
+func (r *Result) IsExpired(now time.Time) bool {
+	sec, ok := numericDateClaim(r, "exp")
+	return ok && !now.Before(time.Unix(sec, 0))
+}
+
+// WithDerivedExp sets the exp claim of introspection responses that lack it but have the non standard expires_in claim to the
+// time of the response plus expires_in, so that the cache lifetime and the local expiry checks of WithClockSkew apply to them.
+// A zero or negative expires_in yields a token that is already expired. Since the derived exp is only approximate, such results
+// have ExpDerived set.
+func WithDerivedExp() Option {
+	return func(opt *Options) {
+		opt.deriveExp = true
+	}
+}
+
+// deriveExp sets the exp claim of res from expires_in relative to now, if exp is absent
+func deriveExp(res *Result, now time.Time) {
+	if _, ok := res.Optionals["exp"]; ok {
+		return
+	}
+
+	raw, ok := res.Optionals["expires_in"]
+	if !ok {
+		return
+	}
+
+	sec, err := parseSeconds("expires_in", raw)
+	if err != nil {
+		return
+	}
+
+	if sec < 0 {
+		sec = 0
+	}
+
+	exp := now.Unix() + sec
+	if exp > maxNumericDate {
+		exp = maxNumericDate
+	}
+
+	res.Optionals["exp"] = json.RawMessage(strconv.FormatInt(exp, 10))
+	res.Exp = exp
+	res.ExpDerived = true
+}
+
+var (
+	// ErrExpired is returned by FromContext when the exp claim of an active result has passed
+	ErrExpired = errors.New("token is expired")
+	// ErrNotYetValid is returned by FromContext when the nbf or iat claim of an active result is in the future
+	ErrNotYetValid = errors.New("token is not valid yet")
+)
+
+// checkTimeClaims compares the exp, nbf and iat claims of res against now, tolerating a clock difference of skew in either direction.
+// Claims that are absent or malformed are ignored.
+func checkTimeClaims(res *Result, now time.Time, skew time.Duration) error {
+	if sec, ok := numericDateClaim(res, "exp"); ok && !now.Before(time.Unix(sec, 0).Add(skew)) {
+		return ErrExpired
+	}
+
+	for _, name := range []string{"nbf", "iat"} {
+		if sec, ok := numericDateClaim(res, name); ok && now.Before(time.Unix(sec, 0).Add(-skew)) {
+			return ErrNotYetValid
+		}
+	}
+
+	return nil
+}
+
+// MissingClaimError is returned by FromContext when an active result lacks a claim required by WithRequireClaims
+type MissingClaimError struct {
+	// Name is the first required claim found missing
+	Name string
+}
+
+func (e *MissingClaimError) Error() string {
+	return fmt.Sprintf("token lacks required claim %q", e.Name)
+}
+
+// WithRequireClaims rejects active results lacking any of the claims names, e.g. sub, exp and client_id, with a MissingClaimError.
+// A claim whose value is null counts as missing.
+func WithRequireClaims(names ...string) Option {
+	names = append([]string(nil), names...)
+
+	return WithResultValidator(func(_ context.Context, res *Result) error {
+		for _, name := range names {
+			if val, ok := res.Optionals[name]; !ok || string(val) == "null" {
+				return &MissingClaimError{Name: name}
+			}
+		}
+
+		return nil
+	})
+}
+
+func numericDateClaim(res *Result, name string) (int64, bool) {
+	raw, ok := res.Optionals[name]
+	if !ok {
+		return 0, false
+	}
+
+	sec, err := parseNumericDate(name, raw)
+	return sec, err == nil
+}
+
+// numericDateClaims are the standard claims holding a NumericDate
+var numericDateClaims = []string{"exp", "iat", "nbf"}
+
+const (
+	// maxNumericDate is the last second of year 9999, later dates are rejected to keep time arithmetic from overflowing
+	maxNumericDate = 253402300799
+	// maxSeconds is the largest number of seconds representable as a time.Duration
+	maxSeconds = math.MaxInt64 / int64(time.Second)
+)
+
+// parseNumericDate parses a NumericDate claim, seconds since the epoch, rejecting values that don't fit in the supported range.
+// Fractional seconds are rounded conservatively: down for exp, so the token expires earlier, and for iat, so the token is older,
+// and up for nbf.
+func parseNumericDate(name string, raw json.RawMessage) (int64, error) {
+	v, err := parseInt64(name, raw, name == "nbf")
+	if err != nil {
+		return 0, err
+	}
+
+	if v < 0 || v > maxNumericDate {
+		return 0, fmt.Errorf("invalid %s claim: %d is out of range", name, v)
+	}
+
+	return v, nil
+}
+
+// parseSeconds parses a claim holding a relative number of seconds, rejecting values that overflow a time.Duration
+func parseSeconds(name string, raw json.RawMessage) (int64, error) {
+	v, err := parseInt64(name, raw, false)
+	if err != nil {
+		return 0, err
+	}
+
+	if v > maxSeconds || v < -maxSeconds {
+		return 0, fmt.Errorf("invalid %s claim: %d is out of range", name, v)
+	}
+
+	return v, nil
+}
+
+// parseInt64 parses a JSON number, or a JSON string holding one as some servers send, into an integer.
+// Fractions are rounded up when ceil is set and down otherwise.
+func parseInt64(name string, raw json.RawMessage, ceil bool) (int64, error) {
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, fmt.Errorf("invalid %s claim: not a number", name)
+		}
+
+		raw = json.RawMessage(strings.TrimSpace(s))
+	}
+
+	var n json.Number
+	if len(raw) == 0 || raw[0] == '"' || json.Unmarshal(raw, &n) != nil {
+		return 0, fmt.Errorf("invalid %s claim: not a number", name)
+	}
+
+	if v, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return v, nil
+	}
+
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s claim: %v", name, err)
+	}
+
+	if ceil {
+		f = math.Ceil(f)
+	} else {
+		f = math.Floor(f)
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, which doesn't fit in an int64
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("invalid %s claim: %s is out of range", name, n)
+	}
+
+	return int64(f), nil
+}
+
+// Scopes returns the token's scopes. They are read from the scope claim or, when it is absent, from the scp claim used by some
+// servers such as Okta and Azure AD. Either may be a space delimited string or an array of strings. See WithScopeClaim.
+func (r *Result) Scopes() []string {
+	names := []string{"scope", "scp"}
+	if r.scopeClaim != "" {
+		names = []string{r.scopeClaim}
+	}
+
+	for _, name := range names {
+		if raw, ok := r.Optionals[name]; ok {
+			return parseScopes(raw)
+		}
+	}
+
+	return nil
+}
+
+// parseScopes parses a space delimited string or an array of strings
+func parseScopes(raw json.RawMessage) []string {
+	var scope string
+	if err := json.Unmarshal(raw, &scope); err == nil {
+		return strings.Fields(scope)
+	}
+
+	var scopes []string
+	if err := json.Unmarshal(raw, &scopes); err != nil {
+		return nil
+	}
+
+	return strings.Fields(strings.Join(scopes, " "))
+}
+
+// WithScopeClaim makes Result.Scopes, and the scope checks built on it, read the token's scopes from the claim name only,
+// for servers that use neither scope nor scp. The claim may be a space delimited string or an array of strings.
+func WithScopeClaim(name string) Option {
+	return func(opt *Options) {
+		opt.scopeClaim = name
+	}
+}
+
+// WithScopeMatcher makes HasScope, and the scope checks built on it, decide whether a scope the token has satisfies a wanted one by
+// calling match instead of comparing them for equality, e.g. for wildcard (read:* matching read:users) or hierarchical scopes.
+func WithScopeMatcher(match func(have, want string) bool) Option {
+	return func(opt *Options) {
+		opt.scopeMatcher = match
+	}
+}
+
+// HasScope reports whether scope is one of the token's scopes, or is matched by one of them with WithScopeMatcher
+func (r *Result) HasScope(scope string) bool {
+	for _, s := range r.Scopes() {
+		if s == scope || r.scopeMatcher != nil && r.scopeMatcher(s, scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasAnyScope reports whether the token has at least one of scopes, see HasScope
+func (r *Result) HasAnyScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		if r.HasScope(scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// useScopeOptions makes res read and match scopes as configured by WithScopeClaim and WithScopeMatcher
+func useScopeOptions(res *Result, opt *Options) {
+	res.scopeClaim = opt.scopeClaim
+	res.scopeMatcher = opt.scopeMatcher
+}
+
+// applyAliases renames the members of optionals named after a key of aliases to its value, unless a member by that name exists,
+// in which case conflict, if not nil, is called
+func applyAliases(optionals map[string]json.RawMessage, aliases map[string]string, conflict func(alias, name string)) {
+	for alias, name := range aliases {
+		val, ok := optionals[alias]
+		if !ok {
+			continue
+		}
+
+		if _, ok := optionals[name]; ok {
+			if conflict != nil {
+				conflict(alias, name)
+			}
+			continue
+		}
+
+		optionals[name] = val
+		delete(optionals, alias)
+	}
+}
+
+// decodeStandardClaims sets the typed fields of res from the standard claims in its Optionals
+func decodeStandardClaims(res *Result) {
+	res.Scope = res.stringClaim("scope")
+	res.ClientID = res.stringClaim("client_id")
+	res.Username = res.stringClaim("username")
+	res.TokenType = res.stringClaim("token_type")
+	res.Sub = res.stringClaim("sub")
+	res.Iss = res.stringClaim("iss")
+	res.Jti = res.stringClaim("jti")
+	res.Aud = res.Audiences()
+
+	res.Exp, _ = numericDateClaim(res, "exp")
+	res.Iat, _ = numericDateClaim(res, "iat")
+	res.Nbf, _ = numericDateClaim(res, "nbf")
+}
+
+func (r *Result) stringClaim(name string) string {
+	var v string
+	json.Unmarshal(r.Optionals[name], &v)
+	return v
+}
+
+// Claims decodes the claims of the active introspection result in ctx, the members of its Optionals, into a T, usually a struct
+// with json tags, e.g.
+//
+//	type claims struct {
+//		Sub    string   `json:"sub"`
+//		Tenant string   `json:"tenant_id"`
+//		Roles  []string `json:"roles"`
+//	}
+//
+//	c, err := introspection.Claims[claims](r.Context())
+//
+// It fails with the error of FromContext, ErrInactive for inactive tokens, or the error decoding the claims.
+func Claims[T any](ctx context.Context) (T, error) {
+	var claims T
+
+	res, err := FromContext(ctx)
+	if err != nil {
+		return claims, err
+	}
+
+	if !res.Active {
+		return claims, ErrInactive
+	}
+
+	data, err := json.Marshal(res.Optionals)
+	if err != nil {
+		return claims, err
+	}
+
+	err = json.Unmarshal(data, &claims)
+	return claims, err
+}
@@ -0,0 +1,582 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestEffectiveExpiry(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	tt := []struct {
+		name   string
+		claims map[string]json.RawMessage
+		exp    time.Time
+		ok     bool
+	}{
+		{
+			name:   "Exp Only",
+			claims: map[string]json.RawMessage{"exp": json.RawMessage("1500000600")},
+			exp:    time.Unix(1500000600, 0),
+			ok:     true,
+		},
+		{
+			name:   "Expires In Only",
+			claims: map[string]json.RawMessage{"expires_in": json.RawMessage("300")},
+			exp:    now.Add(300 * time.Second),
+			ok:     true,
+		},
+		{
+			name:   "Both Prefers Exp",
+			claims: map[string]json.RawMessage{"exp": json.RawMessage("1500000600"), "expires_in": json.RawMessage("300")},
+			exp:    time.Unix(1500000600, 0),
+			ok:     true,
+		},
+		{
+			name:   "Neither",
+			claims: map[string]json.RawMessage{"sub": json.RawMessage(`"user"`)},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := intro.Result{Active: true, Optionals: tc.claims}
+
+			exp, ok := res.EffectiveExpiry(now)
+
+			equals(t, tc.ok, ok)
+			equals(t, tc.exp, exp)
+		})
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	const claim = 1500000000
+	at := time.Unix(claim, 0)
+
+	tt := []struct {
+		name  string
+		claim string
+		skew  time.Duration
+		now   time.Time
+		err   error
+	}{
+		{name: "Exp No Skew Before", claim: "exp", now: at.Add(-time.Millisecond)},
+		{name: "Exp No Skew At", claim: "exp", now: at, err: intro.ErrExpired},
+		{name: "Exp Before Skew", claim: "exp", skew: 5 * time.Second, now: at.Add(5*time.Second - time.Millisecond)},
+		{name: "Exp At Skew", claim: "exp", skew: 5 * time.Second, now: at.Add(5 * time.Second), err: intro.ErrExpired},
+		{name: "Exp After Skew", claim: "exp", skew: 5 * time.Second, now: at.Add(5*time.Second + time.Millisecond), err: intro.ErrExpired},
+		{name: "Nbf No Skew Before", claim: "nbf", now: at.Add(-time.Millisecond), err: intro.ErrNotYetValid},
+		{name: "Nbf No Skew At", claim: "nbf", now: at},
+		{name: "Nbf Before Skew", claim: "nbf", skew: 5 * time.Second, now: at.Add(-5*time.Second - time.Millisecond), err: intro.ErrNotYetValid},
+		{name: "Nbf At Skew", claim: "nbf", skew: 5 * time.Second, now: at.Add(-5 * time.Second)},
+		{name: "Nbf After Skew", claim: "nbf", skew: 5 * time.Second, now: at.Add(-5*time.Second + time.Millisecond)},
+		{name: "Iat No Skew Before", claim: "iat", now: at.Add(-time.Millisecond), err: intro.ErrNotYetValid},
+		{name: "Iat No Skew At", claim: "iat", now: at},
+		{name: "Iat Before Skew", claim: "iat", skew: 5 * time.Second, now: at.Add(-5*time.Second - time.Millisecond), err: intro.ErrNotYetValid},
+		{name: "Iat At Skew", claim: "iat", skew: 5 * time.Second, now: at.Add(-5 * time.Second)},
+		{name: "Iat After Skew", claim: "iat", skew: 5 * time.Second, now: at.Add(-5*time.Second + time.Millisecond)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := introspectedContext(t, map[string]interface{}{"active": true, tc.claim: claim},
+				intro.WithClock(introspectiontest.NewClock(tc.now)),
+				intro.WithClockSkew(tc.skew),
+			)
+
+			_, err := intro.FromContext(ctx)
+
+			equals(t, tc.err, err)
+		})
+	}
+
+	t.Run("Inactive", func(t *testing.T) {
+		ctx := introspectedContext(t, map[string]interface{}{"active": false, "exp": claim},
+			intro.WithClock(introspectiontest.NewClock(at.Add(time.Hour))),
+		)
+
+		res, err := intro.FromContext(ctx)
+
+		ok(t, err)
+		equals(t, false, res.Active)
+	})
+
+	t.Run("Unchecked Without Skew", func(t *testing.T) {
+		for _, name := range []string{"exp", "nbf", "iat"} {
+			now := at.Add(time.Hour)
+			if name != "exp" {
+				now = at.Add(-time.Hour)
+			}
+
+			ctx := introspectedContext(t, map[string]interface{}{"active": true, name: claim},
+				intro.WithClock(introspectiontest.NewClock(now)),
+			)
+
+			_, err := intro.FromContext(ctx)
+			ok(t, err)
+		}
+	})
+}
+
+func TestClockSkewCacheTTL(t *testing.T) {
+	const claim = 1500000000
+	at := time.Unix(claim, 0)
+
+	tt := []struct {
+		name   string
+		skew   time.Duration
+		now    time.Time
+		stored bool
+	}{
+		{name: "No Skew Before Exp", now: at.Add(-time.Millisecond), stored: true},
+		{name: "No Skew At Exp", now: at},
+		{name: "Within Skew", skew: 5 * time.Second, now: at.Add(5*time.Second - time.Millisecond), stored: true},
+		{name: "At Skew", skew: 5 * time.Second, now: at.Add(5 * time.Second)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := introspectiontest.NewClock(tc.now)
+			cache := intro.NewInMemoryCache(intro.CacheClock(clock))
+
+			introspectedContext(t, map[string]interface{}{"active": true, "exp": claim},
+				intro.WithClock(clock),
+				intro.WithClockSkew(tc.skew),
+				intro.WithCache(cache, time.Hour),
+			)
+
+			equals(t, tc.stored, cache.Get("token") != nil)
+
+			if tc.stored {
+				clock.Advance(at.Add(tc.skew).Sub(tc.now))
+				assert(t, cache.Get("token") == nil, "entry should expire at exp plus skew")
+			}
+		})
+	}
+}
+
+func TestFieldAliases(t *testing.T) {
+	aliases := map[string]string{"user_name": "username", "cid": "client_id", "expires_at": "exp"}
+
+	serve := func(response map[string]interface{}) (*intro.Result, [][2]string, error) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+		}))
+		defer ts.Close()
+
+		var (
+			res       *intro.Result
+			err       error
+			conflicts [][2]string
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		intro.Introspection(ts.URL,
+			intro.WithFieldAliases(aliases),
+			intro.WithHooks(intro.Hooks{OnFieldAliasConflict: func(ctx context.Context, alias, name string) {
+				conflicts = append(conflicts, [2]string{alias, name})
+			}}),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err = intro.FromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res, conflicts, err
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	t.Run("Aliased", func(t *testing.T) {
+		res, conflicts, err := serve(map[string]interface{}{"active": true, "user_name": "alice", "cid": "app", "expires_at": exp})
+		ok(t, err)
+
+		equals(t, "alice", res.Username)
+		equals(t, "app", res.ClientID)
+		equals(t, exp, res.Exp)
+
+		equals(t, json.RawMessage(`"alice"`), res.Optionals["username"])
+		_, present := res.Optionals["user_name"]
+		assert(t, !present, "aliased member should be renamed")
+
+		until, found := res.EffectiveExpiry(time.Now())
+		assert(t, found, "aliased expiry should be used")
+		equals(t, time.Unix(exp, 0), until)
+
+		equals(t, 0, len(conflicts))
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		res, conflicts, err := serve(map[string]interface{}{"active": true, "user_name": "alias", "username": "standard"})
+		ok(t, err)
+
+		equals(t, "standard", res.Username)
+		equals(t, json.RawMessage(`"alias"`), res.Optionals["user_name"])
+		equals(t, [][2]string{{"user_name", "username"}}, conflicts)
+	})
+
+	t.Run("Invalid Aliased Date", func(t *testing.T) {
+		_, _, err := serve(map[string]interface{}{"active": true, "expires_at": "tomorrow"})
+		assert(t, err != nil, "aliased date claims should be validated")
+	})
+}
+
+func TestScopes(t *testing.T) {
+	tt := []struct {
+		name     string
+		response string
+		opts     []intro.Option
+		scopes   []string
+	}{
+		{name: "RFC", response: `{"active":true,"scope":"read write"}`, scopes: []string{"read", "write"}},
+		{name: "Scope Array", response: `{"active":true,"scope":["read","write"]}`, scopes: []string{"read", "write"}},
+		{name: "Okta", response: `{"active":true,"scp":["openid","profile"],"uid":"00u1","client_id":"0oa1"}`, scopes: []string{"openid", "profile"}},
+		{name: "Azure AD", response: `{"active":true,"scp":"User.Read Mail.Send","oid":"a1b2","tid":"c3d4"}`, scopes: []string{"User.Read", "Mail.Send"}},
+		{name: "Scope Wins Over Scp", response: `{"active":true,"scope":"read","scp":["admin"]}`, scopes: []string{"read"}},
+		{name: "Malformed Scope Does Not Fall Back", response: `{"active":true,"scope":1,"scp":["admin"]}`},
+		{name: "None", response: `{"active":true}`},
+		{name: "Custom Claim", response: `{"active":true,"scope":"read","permissions":["admin","audit"]}`, opts: []intro.Option{intro.WithScopeClaim("permissions")}, scopes: []string{"admin", "audit"}},
+		{name: "Custom Claim Absent", response: `{"active":true,"scope":"read"}`, opts: []intro.Option{intro.WithScopeClaim("permissions")}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				w.Write([]byte(tc.response))
+			}))
+			defer ts.Close()
+
+			opts := append(tc.opts, intro.WithCache(intro.NewInMemoryCache(), time.Minute))
+
+			h := intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
+				ok(t, err)
+
+				equals(t, tc.scopes, res.Scopes())
+
+				for _, scope := range tc.scopes {
+					assert(t, res.HasScope(scope), "token should have scope %q", scope)
+				}
+			}))
+
+			// the second request is served from the cache
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Add("Authorization", "Bearer token")
+				h.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
+
+func TestDerivedExp(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+
+	t.Run("Drives Cache TTL And Expiry", func(t *testing.T) {
+		clock := introspectiontest.NewClock(now)
+		cache := intro.NewInMemoryCache(intro.CacheClock(clock))
+
+		ctx := introspectedContext(t, map[string]interface{}{"active": true, "expires_in": 60},
+			intro.WithClock(clock),
+			intro.WithDerivedExp(),
+			intro.WithCache(cache, time.Hour),
+		)
+
+		res, err := intro.FromContext(ctx)
+		ok(t, err)
+
+		assert(t, res.ExpDerived, "exp should be marked as derived")
+		equals(t, now.Add(time.Minute).Unix(), res.Exp)
+		equals(t, json.RawMessage("1500000060"), res.Optionals["exp"])
+		assert(t, !res.IsExpired(now.Add(time.Minute-time.Millisecond)), "token should not be expired before the derived exp")
+		assert(t, res.IsExpired(now.Add(time.Minute)), "token should be expired at the derived exp")
+
+		clock.Advance(time.Minute - time.Millisecond)
+		assert(t, cache.Get("token") != nil, "entry should be cached until the derived exp")
+
+		clock.Advance(time.Millisecond)
+		assert(t, cache.Get("token") == nil, "entry should expire at the derived exp")
+	})
+
+	t.Run("Exp Present", func(t *testing.T) {
+		ctx := introspectedContext(t, map[string]interface{}{"active": true, "exp": 1500000030, "expires_in": 60},
+			intro.WithClock(introspectiontest.NewClock(now)),
+			intro.WithDerivedExp(),
+		)
+
+		res, err := intro.FromContext(ctx)
+		ok(t, err)
+
+		assert(t, !res.ExpDerived, "exp should not be derived when present")
+		equals(t, int64(1500000030), res.Exp)
+	})
+
+	for _, expiresIn := range []int{0, -10} {
+		t.Run(fmt.Sprint("Expires In ", expiresIn), func(t *testing.T) {
+			ctx := introspectedContext(t, map[string]interface{}{"active": true, "expires_in": expiresIn},
+				intro.WithClock(introspectiontest.NewClock(now)),
+				intro.WithClockSkew(0),
+				intro.WithDerivedExp(),
+			)
+
+			_, err := intro.FromContext(ctx)
+			equals(t, intro.ErrExpired, err)
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		ctx := introspectedContext(t, map[string]interface{}{"active": true, "expires_in": 0},
+			intro.WithClock(introspectiontest.NewClock(now)),
+		)
+
+		res, err := intro.FromContext(ctx)
+		ok(t, err)
+
+		_, present := res.Optionals["exp"]
+		assert(t, !present && !res.ExpDerived, "exp should only be derived with WithDerivedExp")
+	})
+}
+
+func TestNumericDateRepresentations(t *testing.T) {
+	tt := []struct {
+		name  string
+		value json.RawMessage
+		floor int64
+		ceil  int64
+		err   bool
+	}{
+		{name: "Integer", value: json.RawMessage(`1714000000`), floor: 1714000000, ceil: 1714000000},
+		{name: "Float", value: json.RawMessage(`1714000000.25`), floor: 1714000000, ceil: 1714000001},
+		{name: "Whole Float", value: json.RawMessage(`1714000000.0`), floor: 1714000000, ceil: 1714000000},
+		{name: "Exponent", value: json.RawMessage(`1.714e9`), floor: 1714000000, ceil: 1714000000},
+		{name: "Numeric String", value: json.RawMessage(`"1714000000"`), floor: 1714000000, ceil: 1714000000},
+		{name: "Float String", value: json.RawMessage(`" 1714000000.75 "`), floor: 1714000000, ceil: 1714000001},
+		{name: "Non Numeric String", value: json.RawMessage(`"tomorrow"`), err: true},
+		{name: "Empty String", value: json.RawMessage(`""`), err: true},
+		{name: "Boolean", value: json.RawMessage(`true`), err: true},
+		{name: "Object", value: json.RawMessage(`{"seconds":1714000000}`), err: true},
+		{name: "Negative", value: json.RawMessage(`-1.5`), err: true},
+		{name: "Huge Float", value: json.RawMessage(`1e300`), err: true},
+	}
+
+	for _, claim := range []string{"exp", "nbf", "iat"} {
+		for _, tc := range tt {
+			t.Run(claim+"/"+tc.name, func(t *testing.T) {
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Add("Content-Type", "application/json")
+					fmt.Fprintf(w, `{"active":true,%q:%s}`, claim, tc.value)
+				}))
+				defer ts.Close()
+
+				// far from any of the dates so that time checks pass
+				clock := introspectiontest.NewClock(time.Unix(1800000000, 0))
+				if claim == "exp" {
+					clock = introspectiontest.NewClock(time.Unix(1000000000, 0))
+				}
+
+				ctx := introspectedContextAt(t, ts.URL, intro.WithClock(clock))
+
+				res, err := intro.FromContext(ctx)
+				if tc.err {
+					assert(t, err != nil, "expected an error")
+					assert(t, strings.Contains(err.Error(), "invalid "+claim+" claim"), "error should identify the claim: %v", err)
+					return
+				}
+
+				ok(t, err)
+
+				want, got := tc.floor, res.Exp
+				switch claim {
+				case "nbf":
+					want, got = tc.ceil, res.Nbf
+				case "iat":
+					got = res.Iat
+				}
+
+				equals(t, want, got)
+			})
+		}
+	}
+}
+
+// introspectedContextAt is introspectedContext against the introspection endpoint at url
+func introspectedContextAt(t *testing.T, url string, opts ...intro.Option) context.Context {
+	var ctx context.Context
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	intro.Introspection(url, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	return ctx
+}
+
+func TestRequireClaims(t *testing.T) {
+	opt := intro.WithRequireClaims("sub", "exp", "client_id")
+
+	tt := []struct {
+		name string
+		data map[string]interface{}
+		err  error
+	}{
+		{name: "All Present", data: map[string]interface{}{"active": true, "sub": "alice", "exp": 4102444800, "client_id": "app"}},
+		{name: "Missing Sub", data: map[string]interface{}{"active": true, "exp": 4102444800, "client_id": "app"}, err: &intro.MissingClaimError{Name: "sub"}},
+		{name: "Null Client ID", data: map[string]interface{}{"active": true, "sub": "alice", "exp": 4102444800, "client_id": nil}, err: &intro.MissingClaimError{Name: "client_id"}},
+		{name: "Inactive", data: map[string]interface{}{"active": false}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := intro.FromContext(introspectedContext(t, tc.data, opt))
+
+			equals(t, tc.err, err)
+			if tc.err == nil {
+				equals(t, tc.data["active"], res.Active)
+			}
+		})
+	}
+
+	t.Run("Enforced", func(t *testing.T) {
+		ctx := introspectedContext(t, map[string]interface{}{"active": true, "exp": 4102444800, "client_id": "app"}, opt, intro.WithEnforcement())
+
+		assert(t, ctx == nil, "the request should have been rejected")
+	})
+}
+
+func TestClaimsGeneric(t *testing.T) {
+	type custom struct {
+		Sub      string   `json:"sub"`
+		Exp      int64    `json:"exp"`
+		Aud      []string `json:"aud"`
+		TenantID string   `json:"tenant_id"`
+		Roles    []string `json:"roles"`
+		Profile  struct {
+			Email string `json:"email"`
+		} `json:"profile"`
+	}
+
+	ctx := introspectedContext(t, map[string]interface{}{
+		"active":    true,
+		"sub":       "alice",
+		"exp":       32503680000,
+		"aud":       []string{"orders"},
+		"tenant_id": "acme",
+		"roles":     []string{"admin", "billing"},
+		"profile":   map[string]interface{}{"email": "alice@example.com"},
+	})
+
+	c, err := intro.Claims[custom](ctx)
+	ok(t, err)
+
+	equals(t, "alice", c.Sub)
+	equals(t, int64(32503680000), c.Exp)
+	equals(t, []string{"orders"}, c.Aud)
+	equals(t, "acme", c.TenantID)
+	equals(t, []string{"admin", "billing"}, c.Roles)
+	equals(t, "alice@example.com", c.Profile.Email)
+
+	m, err := intro.Claims[map[string]interface{}](ctx)
+	ok(t, err)
+	equals(t, "acme", m["tenant_id"])
+
+	_, err = intro.Claims[custom](introspectedContext(t, map[string]interface{}{"active": false}))
+	equals(t, intro.ErrInactive, err)
+
+	_, err = intro.Claims[struct {
+		Roles string `json:"roles"`
+	}](ctx)
+	assert(t, err != nil, "decoding roles into a string should fail")
+
+	_, err = intro.Claims[custom](context.Background())
+	equals(t, intro.ErrNoMiddleware, err)
+}
+
+func TestClaimWhitelist(t *testing.T) {
+	data := map[string]interface{}{
+		"active":    true,
+		"sub":       "user",
+		"scope":     "read",
+		"exp":       32503680000,
+		"tenant_id": "acme",
+		"groups":    []string{"admin", "dev"},
+		"profile":   map[string]interface{}{"name": "User", "locale": "en"},
+		"user_name": "alias",
+	}
+
+	res, err := intro.FromContext(introspectedContext(t, data,
+		intro.WithClaimWhitelist("sub", "tenant_id", "username"),
+		intro.WithFieldAliases(map[string]string{"user_name": "username"}),
+	))
+	ok(t, err)
+
+	equals(t, true, res.Active)
+	equals(t, "user", res.Sub)
+	equals(t, "alias", res.Username)
+	equals(t, "", res.Scope)
+	equals(t, int64(0), res.Exp)
+	equals(t, map[string]json.RawMessage{
+		"sub":       json.RawMessage(`"user"`),
+		"tenant_id": json.RawMessage(`"acme"`),
+		"username":  json.RawMessage(`"alias"`),
+	}, res.Optionals)
+
+	t.Run("Malformed Dropped Claim", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(`{"active": true, "sub": "user", "groups": [1, 2`))
+		}))
+		defer ts.Close()
+
+		_, err := intro.FromContext(introspectedContextAt(t, ts.URL, intro.WithClaimWhitelist("sub")))
+		assert(t, err != nil, "a malformed response should fail even if the malformed member is dropped")
+	})
+}
+
+func BenchmarkClaimWhitelist(b *testing.B) {
+	claims := map[string]interface{}{"active": true, "sub": "user", "exp": 32503680000}
+	for i := 0; i < 300; i++ {
+		claims[fmt.Sprintf("claim_%d", i)] = map[string]interface{}{"value": strings.Repeat("x", 32), "index": i}
+	}
+
+	data, err := json.Marshal(claims)
+	ok(b, err)
+
+	run := func(b *testing.B, opts ...intro.Option) {
+		h := intro.Introspection("https://as.example.com/introspect", append(opts, withTransport(staticTransport(string(data))))...)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			h.ServeHTTP(w, req)
+		}
+	}
+
+	b.Run("All Claims", func(b *testing.B) {
+		run(b)
+	})
+
+	b.Run("Whitelist", func(b *testing.B) {
+		run(b, intro.WithClaimWhitelist("sub", "exp"))
+	})
+}
@@ -0,0 +1,29 @@
+package introspection
+
+import "context"
+
+// TokenClass is the kind of a token as determined by the function passed to WithTokenClassifier
+type TokenClass int
+
+const (
+	// Opaque tokens are introspected, this is the default for all tokens
+	Opaque TokenClass = iota
+	// JWT tokens are validated by the function passed to WithJWTValidator, or introspected when there is none
+	JWT
+	// Skip tokens are neither introspected nor validated, e.g. API keys handled elsewhere. They get a synthetic inactive Result.
+	Skip
+)
+
+// WithTokenClassifier routes each token according to the class returned by classify
+func WithTokenClassifier(classify func(token string) TokenClass) Option {
+	return func(opt *Options) {
+		opt.classify = classify
+	}
+}
+
+// WithJWTValidator sets the function used to validate tokens classified as JWT locally instead of introspecting them
+func WithJWTValidator(validate func(ctx context.Context, token string) (*Result, error)) Option {
+	return func(opt *Options) {
+		opt.validateJWT = validate
+	}
+}
@@ -0,0 +1,160 @@
+package introspection
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const clientParamsKey = resKeyType(3)
+
+// maxClientParamLength caps the length of a client context parameter value
+const maxClientParamLength = 256
+
+// WithClientContextParams adds parameters derived from the incoming request to the introspection request body, e.g. to let the
+// authorization server factor the client's user agent into its decision. Each function in params is called with the request and
+// its result, stripped of control characters and capped at 256 bytes, is sent under the key. Empty values are not sent, nor are
+// parameters that would replace token.
+//
+// Parameters are only sent by the HTTP middleware. Cached results are reused regardless of the parameters they were introspected with.
+func WithClientContextParams(params map[string]func(*http.Request) string) Option {
+	return func(opt *Options) {
+		if opt.clientParams == nil {
+			opt.clientParams = make(map[string]func(*http.Request) string, len(params))
+		}
+
+		for k, f := range params {
+			if k != "token" {
+				opt.clientParams[k] = f
+			}
+		}
+	}
+}
+
+// WithForwardClientIP sends the client's IP address as the x_forwarded_for introspection parameter. Requests from the addresses
+// or CIDR ranges in trustedProxies are attributed to the address their X-Forwarded-For header names, see ClientIP.
+// It panics if an entry of trustedProxies is neither an IP address nor a CIDR range.
+func WithForwardClientIP(trustedProxies ...string) Option {
+	trusted := parseTrustedProxies(trustedProxies)
+
+	return WithClientContextParams(map[string]func(*http.Request) string{
+		"x_forwarded_for": func(r *http.Request) string {
+			return clientIP(r, trusted)
+		},
+	})
+}
+
+// ClientIP returns the address of the client that sent r. When the peer is one of trustedProxies, addresses or CIDR ranges,
+// the X-Forwarded-For header is walked from the right, skipping trusted proxies, and the first untrusted address is returned.
+// An empty string is returned when no address can be determined. It panics if an entry of trustedProxies is invalid.
+func ClientIP(r *http.Request, trustedProxies ...string) string {
+	return clientIP(r, parseTrustedProxies(trustedProxies))
+}
+
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+
+	var hops []string
+	for _, v := range r.Header["X-Forwarded-For"] {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0 && isTrusted(ip, trusted); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+
+		ip = hop
+	}
+
+	return ip.String()
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(proxies))
+
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				panic("introspection: invalid trusted proxy " + p)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			panic("introspection: invalid trusted proxy " + p)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets
+}
+
+// clientParamsContext returns the context of r carrying the client context parameters derived from r
+func clientParamsContext(r *http.Request, opt *Options) context.Context {
+	if len(opt.clientParams) == 0 {
+		return r.Context()
+	}
+
+	params := make(url.Values, len(opt.clientParams))
+	for k, f := range opt.clientParams {
+		if v := sanitizeParam(f(r)); v != "" {
+			params.Set(k, v)
+		}
+	}
+
+	return context.WithValue(r.Context(), clientParamsKey, params)
+}
+
+// sanitizeParam removes control characters from v and caps its length
+func sanitizeParam(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+
+		return r
+	}, v)
+
+	if len(v) > maxClientParamLength {
+		v = strings.ToValidUTF8(v[:maxClientParamLength], "")
+	}
+
+	return strings.TrimSpace(v)
+}
+
+func clientParamsFromContext(ctx context.Context) url.Values {
+	params, _ := ctx.Value(clientParamsKey).(url.Values)
+	return params
+}
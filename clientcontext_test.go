@@ -0,0 +1,124 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.1"}
+
+	tt := []struct {
+		name   string
+		remote string
+		xff    []string
+		ip     string
+	}{
+		{name: "Direct", remote: "203.0.113.7:5000", ip: "203.0.113.7"},
+		{name: "Direct Ignores XFF", remote: "203.0.113.7:5000", xff: []string{"198.51.100.1"}, ip: "203.0.113.7"},
+		{name: "One Proxy", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1"}, ip: "198.51.100.1"},
+		{name: "Multiple Hops", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1, 203.0.113.9, 192.168.1.1"}, ip: "203.0.113.9"},
+		{name: "Multiple Headers", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1", "203.0.113.9", "10.1.2.3"}, ip: "203.0.113.9"},
+		{name: "Spoofed Left Hop", remote: "10.0.0.1:5000", xff: []string{"1.2.3.4, 198.51.100.1"}, ip: "198.51.100.1"},
+		{name: "All Trusted", remote: "10.0.0.1:5000", xff: []string{"10.0.0.2, 10.0.0.3"}, ip: "10.0.0.2"},
+		{name: "Garbage Hop", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1, garbage"}, ip: "10.0.0.1"},
+		{name: "Trusted Without XFF", remote: "10.0.0.1:5000", ip: "10.0.0.1"},
+		{name: "IPv6", remote: "[2001:db8::1]:5000", ip: "2001:db8::1"},
+		{name: "Invalid Remote", remote: "pipe"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tc.remote
+			for _, v := range tc.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+
+			equals(t, tc.ip, intro.ClientIP(req, trusted...))
+		})
+	}
+}
+
+func TestClientContextParams(t *testing.T) {
+	var body url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		body = r.PostForm
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	h := intro.Introspection(ts.URL,
+		intro.WithForwardClientIP("10.0.0.0/8"),
+		intro.WithClientContextParams(map[string]func(*http.Request) string{
+			"x_user_agent": func(r *http.Request) string { return r.UserAgent() },
+			"token":        func(r *http.Request) string { return "replaced" },
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(remote, xff, ua string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		req.Header.Add("Authorization", "Bearer token")
+		req.Header.Set("User-Agent", ua)
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Direct", func(t *testing.T) {
+		serve("203.0.113.7:5000", "198.51.100.1", "agent/1.0")
+
+		equals(t, "token", body.Get("token"))
+		equals(t, "203.0.113.7", body.Get("x_forwarded_for"))
+		equals(t, "agent/1.0", body.Get("x_user_agent"))
+	})
+
+	t.Run("Proxied", func(t *testing.T) {
+		serve("10.0.0.1:5000", "198.51.100.1, 10.0.0.2", "agent/1.0")
+
+		equals(t, "198.51.100.1", body.Get("x_forwarded_for"))
+	})
+
+	t.Run("Injection", func(t *testing.T) {
+		serve("203.0.113.7:5000", "", "agent\r\nX-Injected: 1&token=forged\x00")
+
+		equals(t, "token", body.Get("token"))
+		equals(t, []string{"token"}, body["token"])
+		equals(t, "agentX-Injected: 1&token=forged", body.Get("x_user_agent"))
+		_, injected := body["X-Injected"]
+		assert(t, !injected, "control characters should be stripped")
+	})
+
+	t.Run("Length", func(t *testing.T) {
+		serve("203.0.113.7:5000", "", strings.Repeat("a", 1000))
+
+		equals(t, 256, len(body.Get("x_user_agent")))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		serve("203.0.113.7:5000", "", "")
+
+		_, ok := body["x_user_agent"]
+		assert(t, !ok, "empty parameters should not be sent")
+	})
+}
+
+func TestForwardClientIPInvalidProxy(t *testing.T) {
+	defer func() {
+		assert(t, recover() != nil, "invalid trusted proxy should panic")
+	}()
+
+	intro.WithForwardClientIP("not an ip")
+}
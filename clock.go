@@ -0,0 +1,64 @@
+package introspection
+
+import "time"
+
+// Clock is the source of time used by the middleware and the in memory cache. Replacing it makes time dependent behaviour,
+// such as cache expiry, testable without sleeping. See the introspectiontest package for a fake implementation.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// AfterFunc calls f once d has elapsed, it behaves like time.AfterFunc
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call created by Clock.AfterFunc
+type Timer interface {
+	// Stop prevents the call from happening, it reports whether the call was still pending
+	Stop() bool
+}
+
+// SystemClock is the Clock backed by the time package, it is used unless another one is configured
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// ClockFunc adapts a function returning the current time, such as time.Now, to a Clock. AfterFunc uses real timers, so
+// with a fake time function cache entries still expire in real time, only the checks made against Now are affected.
+type ClockFunc func() time.Time
+
+// Now calls f
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// AfterFunc calls time.AfterFunc
+func (f ClockFunc) AfterFunc(d time.Duration, fn func()) Timer {
+	return time.AfterFunc(d, fn)
+}
+
+// WithClock sets the clock used for retrieval times, cache expiry derivation and latency measurements, defaults to SystemClock.
+// Caches have their own clock, see CacheClock. A plain time function can be used via ClockFunc, e.g. WithClock(ClockFunc(now)).
+func WithClock(c Clock) Option {
+	return func(opt *Options) {
+		opt.clock = c
+	}
+}
+
+// WithClockSkew checks the exp, nbf and iat claims of active results locally, tolerating a difference of up to d between the
+// local clock and the authorization server's: exp is extended by d, nbf and iat are moved back by d. Results failing the checks
+// are rejected with ErrExpired or ErrNotYetValid, and are cached until exp plus d. Without it the time claims are left to the
+// authorization server, as is the default.
+func WithClockSkew(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.clockSkew = d
+		opt.checkTimeClaims = true
+	}
+}
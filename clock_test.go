@@ -0,0 +1,79 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestClockFunc(t *testing.T) {
+	const exp = 1500000000
+
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "exp": exp})
+	}))
+	defer ts.Close()
+
+	now := time.Unix(exp, 0).Add(-time.Minute)
+
+	h := intro.Introspection(ts.URL,
+		intro.WithClock(intro.ClockFunc(func() time.Time { return now })),
+		intro.WithClockSkew(0),
+		intro.WithCache(intro.NewInMemoryCache(), time.Hour),
+	)
+
+	introspect := func() (*intro.Result, error) {
+		var (
+			res *intro.Result
+			err error
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err = intro.FromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res, err
+	}
+
+	res, err := introspect()
+	ok(t, err)
+	equals(t, now, res.RetrievedAt)
+
+	now = time.Unix(exp, 0).Add(-time.Nanosecond)
+
+	res, err = introspect()
+	ok(t, err)
+	assert(t, res.FromCache, "result should be served from the cache")
+
+	now = time.Unix(exp, 0)
+
+	_, err = introspect()
+	equals(t, intro.ErrExpired, err)
+	equals(t, 1, hits)
+}
+
+func TestClockFuncAfterFunc(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	intro.ClockFunc(time.Now).AfterFunc(time.Millisecond, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("AfterFunc did not fire")
+	}
+}
@@ -0,0 +1,177 @@
+package introspection
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Config declares the usual middleware settings, e.g. as loaded from the environment, see Config.Options
+type Config struct {
+	// Endpoint is the introspection endpoint, exclusive with Issuer
+	Endpoint string
+	// Issuer is resolved to the introspection endpoint with EndpointFromDiscovery by Options, exclusive with Endpoint
+	Issuer string
+
+	// ClientID identifies the resource server to the authorization server, it is required by ClientSecret and ClientCertFile.
+	// Without either it is sent as the client_id parameter of unauthenticated requests.
+	ClientID string
+	// ClientSecret authenticates introspection requests with HTTP Basic, exclusive with ClientCertFile
+	ClientSecret string
+	// ClientCertFile and ClientKeyFile are the PEM encoded certificate and key authenticating introspection requests with mutual
+	// TLS, see WithClientCertificate. Both or neither must be set, they are exclusive with ClientSecret.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// Timeout bounds introspection requests, the default of 2s is used when zero
+	Timeout time.Duration
+	// CacheTTL caches results in memory for at most CacheTTL, see WithCache. Caching is disabled when zero.
+	CacheTTL time.Duration
+	// ErrorCacheTTL remembers failed introspections, see WithErrorCacheTTL. They are not remembered when zero.
+	ErrorCacheTTL time.Duration
+
+	// RequiredAudience rejects tokens for other audiences, compared as by HasNormalizedAudience, see WithRequiredAudience
+	RequiredAudience string
+	// RequiredScopes rejects tokens missing any of the scopes with ErrInsufficientScope
+	RequiredScopes []string
+	// Enforce rejects requests in the middleware, see WithEnforcement
+	Enforce bool
+}
+
+// ConfigError lists every problem found in a Config
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "introspection: invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Options validates c and returns the options it declares. The introspection endpoint is set by the returned options, so the
+// endpoint passed along with them to Introspection, AuthFunc or NewChain should be empty, e.g.
+//
+//	opts, err := cfg.Options()
+//	if err != nil {
+//		return err
+//	}
+//	mw := introspection.Introspection("", opts...)
+//
+// Invalid combinations, e.g. both a client secret and a client certificate, yield a *ConfigError listing every problem.
+func (c Config) Options() ([]Option, error) {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case c.Endpoint == "" && c.Issuer == "":
+		problem("one of Endpoint and Issuer is required")
+	case c.Endpoint != "" && c.Issuer != "":
+		problem("Endpoint and Issuer are exclusive")
+	case c.Endpoint != "":
+		if u, err := url.Parse(c.Endpoint); err != nil || !u.IsAbs() {
+			problem("Endpoint %q is not an absolute URL", c.Endpoint)
+		}
+	}
+
+	hasCert := c.ClientCertFile != "" || c.ClientKeyFile != ""
+	if c.ClientSecret != "" && hasCert {
+		problem("ClientSecret and ClientCertFile are exclusive")
+	}
+
+	if hasCert && (c.ClientCertFile == "" || c.ClientKeyFile == "") {
+		problem("ClientCertFile and ClientKeyFile must be set together")
+	}
+
+	if (c.ClientSecret != "" || hasCert) && c.ClientID == "" {
+		problem("ClientID is required to authenticate the client")
+	}
+
+	if c.Timeout < 0 {
+		problem("Timeout is negative")
+	}
+
+	if c.CacheTTL < 0 {
+		problem("CacheTTL is negative")
+	}
+
+	if c.ErrorCacheTTL < 0 {
+		problem("ErrorCacheTTL is negative")
+	}
+
+	for _, scope := range c.RequiredScopes {
+		if scope == "" || strings.ContainsAny(scope, " \t") {
+			problem("RequiredScopes has invalid scope %q", scope)
+		}
+	}
+
+	var cert tls.Certificate
+	if c.ClientCertFile != "" && c.ClientKeyFile != "" {
+		var err error
+		if cert, err = tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile); err != nil {
+			problem("loading the client certificate: %v", err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+
+	endpoint := c.Endpoint
+	if c.Issuer != "" {
+		var err error
+		if endpoint, err = EndpointFromDiscovery(c.Issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := []Option{func(opt *Options) { opt.endpoint = endpoint }}
+
+	if c.Timeout > 0 {
+		opts = append(opts, func(opt *Options) { opt.Client.Timeout = c.Timeout })
+	}
+
+	switch {
+	case c.ClientSecret != "":
+		id, secret := c.ClientID, c.ClientSecret
+		opts = append(opts, WithCredentials(BasicCredentials(func(context.Context) (string, string, error) { return id, secret, nil })))
+	case hasCert:
+		opts = append(opts, WithClientCertificate(cert), WithAddedBody(url.Values{"client_id": {c.ClientID}}))
+	case c.ClientID != "":
+		opts = append(opts, WithAddedBody(url.Values{"client_id": {c.ClientID}}))
+	}
+
+	if c.CacheTTL > 0 {
+		opts = append(opts, WithCache(NewInMemoryCache(), c.CacheTTL))
+	}
+
+	if c.ErrorCacheTTL > 0 {
+		opts = append(opts, WithErrorCacheTTL(c.ErrorCacheTTL))
+	}
+
+	if c.RequiredAudience != "" {
+		opts = append(opts, WithRequiredAudience(c.RequiredAudience, true))
+	}
+
+	if len(c.RequiredScopes) > 0 {
+		scopes := append([]string(nil), c.RequiredScopes...)
+		opts = append(opts, WithResultValidator(func(_ context.Context, res *Result) error {
+			for _, scope := range scopes {
+				if !res.HasScope(scope) {
+					return ErrInsufficientScope
+				}
+			}
+
+			return nil
+		}))
+	}
+
+	if c.Enforce {
+		opts = append(opts, WithEnforcement())
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,179 @@
+package introspection_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestConfigOptions(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(nil)
+	defer ts.Close()
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.URL.Path == "/.well-known/openid-configuration" {
+			w.Write([]byte(`{"introspection_endpoint": "` + ts.URL + `/introspect"}`))
+			return
+		}
+
+		hits++
+		equals(t, "/introspect", r.URL.Path)
+
+		if id, secret, ok := r.BasicAuth(); !ok || id != "api" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client"}`))
+			return
+		}
+
+		token := r.PostFormValue("token")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+			"aud":    "https://api.example.com/" + token,
+			"scope":  "read " + token,
+		})
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("Endpoint", func(t *testing.T) {
+		hits = 0
+
+		opts, err := intro.Config{
+			Endpoint:         ts.URL + "/introspect",
+			ClientID:         "api",
+			ClientSecret:     "s3cret",
+			Timeout:          time.Second,
+			CacheTTL:         time.Minute,
+			RequiredAudience: "https://api.example.com/orders",
+			RequiredScopes:   []string{"read", "orders"},
+			Enforce:          true,
+		}.Options()
+		ok(t, err)
+
+		h := intro.Introspection("", opts...)(next)
+
+		equals(t, http.StatusOK, serveStatus(h, "orders"))
+		equals(t, http.StatusOK, serveStatus(h, "orders"))
+		equals(t, 1, hits)
+
+		equals(t, http.StatusUnauthorized, serveStatus(h, "billing"))
+		equals(t, http.StatusUnauthorized, serveStatus(h, ""))
+	})
+
+	t.Run("Issuer", func(t *testing.T) {
+		hits = 0
+
+		opts, err := intro.Config{Issuer: ts.URL, ClientID: "api", ClientSecret: "s3cret", RequiredScopes: []string{"write"}}.Options()
+		ok(t, err)
+
+		_, err = intro.FromContext(introspectedContextAt(t, "", opts...))
+		equals(t, intro.ErrInsufficientScope, err)
+		equals(t, 1, hits)
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		opts, err := intro.Config{Endpoint: ts.URL + "/introspect", ClientID: "api", ClientSecret: "s3cret"}.Options()
+		ok(t, err)
+
+		h, err := intro.NewChain("", opts...).RequireScopes("orders").Handler(next)
+		ok(t, err)
+
+		equals(t, http.StatusOK, serveStatus(h, "orders"))
+		equals(t, http.StatusForbidden, serveStatus(h, "billing"))
+	})
+}
+
+func TestConfigClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, "127.0.0.1")
+	clientCert := ca.issue(t, "api")
+
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}
+	defer func() { http.DefaultTransport = defaultTransport }()
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "api", r.TLS.PeerCertificates[0].Subject.CommonName)
+		equals(t, "api", r.PostFormValue("client_id"))
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true}`))
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: ca.pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+
+	key, err := x509.MarshalPKCS8PrivateKey(clientCert.PrivateKey)
+	ok(t, err)
+	ok(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Certificate[0]}), 0600))
+	ok(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600))
+
+	opts, err := intro.Config{Endpoint: ts.URL, ClientID: "api", ClientCertFile: certFile, ClientKeyFile: keyFile}.Options()
+	ok(t, err)
+
+	res, err := intro.FromContext(introspectedContextAt(t, "", opts...))
+	ok(t, err)
+	equals(t, true, res.Active)
+}
+
+func TestConfigValidation(t *testing.T) {
+	tt := []struct {
+		name     string
+		config   intro.Config
+		problems []string
+	}{
+		{
+			name:     "Empty",
+			problems: []string{"one of Endpoint and Issuer is required"},
+		},
+		{
+			name:     "Relative Endpoint",
+			config:   intro.Config{Endpoint: "/introspect"},
+			problems: []string{`Endpoint "/introspect" is not an absolute URL`},
+		},
+		{
+			name:   "Every Problem",
+			config: intro.Config{Endpoint: "https://as.example.com/introspect", Issuer: "https://as.example.com", ClientSecret: "s3cret", ClientCertFile: "client.crt", Timeout: -time.Second, RequiredScopes: []string{"read write"}},
+			problems: []string{
+				"Endpoint and Issuer are exclusive",
+				"ClientSecret and ClientCertFile are exclusive",
+				"ClientCertFile and ClientKeyFile must be set together",
+				"ClientID is required to authenticate the client",
+				"Timeout is negative",
+				`RequiredScopes has invalid scope "read write"`,
+			},
+		},
+		{
+			name:     "Missing Certificate",
+			config:   intro.Config{Endpoint: "https://as.example.com/introspect", ClientID: "api", ClientCertFile: "missing.crt", ClientKeyFile: "missing.key"},
+			problems: []string{"loading the client certificate: open missing.crt: no such file or directory"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, err := tc.config.Options()
+
+			equals(t, 0, len(opts))
+			cfgErr, isConfigError := err.(*intro.ConfigError)
+			assert(t, isConfigError, "expected a ConfigError, got %v", err)
+			equals(t, tc.problems, cfgErr.Problems)
+		})
+	}
+}
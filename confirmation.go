@@ -0,0 +1,30 @@
+package introspection
+
+import "encoding/json"
+
+// Confirmation is the cnf claim of a sender constrained token, naming the key the token is bound to, see rfc7800
+type Confirmation struct {
+	// JKT is the base64url encoded SHA-256 JWK thumbprint of a DPoP proof key, see rfc9449 section 6.1
+	JKT string `json:"jkt,omitempty"`
+	// X5tS256 is the base64url encoded SHA-256 thumbprint of a mutual TLS client certificate, see rfc8705 section 3.1
+	X5tS256 string `json:"x5t#S256,omitempty"`
+	// Kid is the identifier of the proof of possession key, see rfc7800 section 3.4
+	Kid string `json:"kid,omitempty"`
+	// JWK is the proof of possession key as a JSON Web Key, see rfc7800 section 3.2
+	JWK json.RawMessage `json:"jwk,omitempty"`
+}
+
+// Cnf decodes the cnf claim, ok is false when it is absent or not an object
+func (r *Result) Cnf() (*Confirmation, bool) {
+	raw, ok := r.Optionals["cnf"]
+	if !ok {
+		return nil, false
+	}
+
+	var cnf Confirmation
+	if err := json.Unmarshal(raw, &cnf); err != nil || string(raw) == "null" {
+		return nil, false
+	}
+
+	return &cnf, true
+}
@@ -0,0 +1,45 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestCnf(t *testing.T) {
+	jwk := `{"kty":"EC","crv":"P-256","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}`
+
+	tt := []struct {
+		name string
+		cnf  string
+		exp  *intro.Confirmation
+	}{
+		{name: "JKT", cnf: `{"jkt":"0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"}`, exp: &intro.Confirmation{JKT: "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"}},
+		{name: "X5tS256", cnf: `{"x5t#S256":"bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"}`, exp: &intro.Confirmation{X5tS256: "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"}},
+		{name: "Kid", cnf: `{"kid":"dfd1aa97-6d8d-4575-a0fe-34b96de2bfad"}`, exp: &intro.Confirmation{Kid: "dfd1aa97-6d8d-4575-a0fe-34b96de2bfad"}},
+		{name: "JWK", cnf: `{"jwk":` + jwk + `}`, exp: &intro.Confirmation{JWK: json.RawMessage(jwk)}},
+		{
+			name: "Combined",
+			cnf:  `{"jkt":"jkt","x5t#S256":"x5t","kid":"kid","jwk":` + jwk + `,"osc":"ignored"}`,
+			exp:  &intro.Confirmation{JKT: "jkt", X5tS256: "x5t", Kid: "kid", JWK: json.RawMessage(jwk)},
+		},
+		{name: "Absent"},
+		{name: "Null", cnf: `null`},
+		{name: "Not An Object", cnf: `"jkt"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &intro.Result{Optionals: map[string]json.RawMessage{}}
+			if tc.cnf != "" {
+				res.Optionals["cnf"] = json.RawMessage(tc.cnf)
+			}
+
+			cnf, found := res.Cnf()
+
+			equals(t, tc.exp != nil, found)
+			equals(t, tc.exp, cnf)
+		})
+	}
+}
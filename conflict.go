@@ -0,0 +1,51 @@
+package introspection
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OptionConflictError reports options that can't be used together, see Option
+type OptionConflictError struct {
+	// Options names the conflicting options, e.g. WithCredentials and WithAddedHeaders(Authorization)
+	Options []string
+	// Reason explains why they conflict
+	Reason string
+}
+
+func (e *OptionConflictError) Error() string {
+	return fmt.Sprintf("introspection: conflicting options %s: %s", strings.Join(e.Options, " and "), e.Reason)
+}
+
+// checkConflicts returns an *OptionConflictError if opt was built from options that can't be combined. client is the package
+// built client, opt.Client differs from it when the caller supplied their own.
+func checkConflicts(opt *Options, client *http.Client) error {
+	if len(opt.clientAuth) > 1 {
+		return &OptionConflictError{Options: opt.clientAuth, Reason: "introspection requests can only be authenticated one way"}
+	}
+
+	if opt.h2c && opt.Client != client {
+		return &OptionConflictError{Options: []string{"WithH2C", "Options.Client"}, Reason: "h2c is only configured on the package built client"}
+	}
+
+	if opt.introspector == nil {
+		return nil
+	}
+
+	ignored := append([]string(nil), opt.clientAuth...)
+
+	if opt.endpointPool != nil {
+		ignored = append(ignored, "WithEndpointPool")
+	}
+
+	if opt.messageSignature != nil {
+		ignored = append(ignored, "WithMessageSignature")
+	}
+
+	if len(ignored) > 0 {
+		return &OptionConflictError{Options: append([]string{"WithIntrospector"}, ignored...), Reason: "the Introspector sends the requests these options configure"}
+	}
+
+	return nil
+}
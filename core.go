@@ -1,32 +1,257 @@
 package introspection
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func introspectionResult(token string, opt Options) (*Result, error) {
+// maxResponseDepth is the maximum nesting of objects and arrays accepted in an introspection response
+const maxResponseDepth = 32
+
+var (
+	errNotObject    = errors.New("introspection response is not a JSON object")
+	errTrailingData = errors.New("unexpected data after introspection response")
+	errTooDeep      = errors.New("introspection response is nested too deeply")
+	errNotModified  = errors.New("introspection response not modified")
+)
+
+// checkResult applies the checks of opt to res, the result looked up for token, returning the result the request gets
+func checkResult(ctx context.Context, token string, res *Result, src Source, opt *Options) (*Result, error) {
+	if opt.bind != nil {
+		if err := checkBinding(ctx, res, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkDenyList(ctx, token, res, opt); err != nil {
+		return nil, err
+	}
+
+	res = revoked(res, opt)
+
+	if src != SourceLocal && hasUncachedEnrichers(opt) {
+		res = copyResult(res)
+		if err := enrichResult(ctx, res, false, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateResult(ctx, res, opt); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// validateResult runs the local checks, time claims and validators, an active result must pass
+func validateResult(ctx context.Context, res *Result, opt *Options) error {
+	if !res.Active {
+		return nil
+	}
+
+	if opt.checkTimeClaims {
+		if err := checkTimeClaims(res, opt.clock.Now(), opt.clockSkew); err != nil {
+			return err
+		}
+	}
+
+	if opt.certificateBinding {
+		if err := checkCertificateBinding(ctx, res); err != nil {
+			return err
+		}
+	}
+
+	if err := checkIssuer(res, opt.expectedIssuer); err != nil {
+		return err
+	}
+
+	if opt.tokenAge != nil {
+		if err := opt.tokenAge.check(res, opt.clock.Now(), opt.clockSkew); err != nil {
+			return err
+		}
+	}
+
+	for _, validate := range opt.validators {
+		if err := validate(ctx, res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookupResult returns the result for token from the cache, the JWT validator or the introspection endpoint, along with where it came from
+func lookupResult(ctx context.Context, token string, opt *Options) (*Result, Source, error) {
+	class := Opaque
+	if opt.classify != nil {
+		class = opt.classify(token)
+	}
+
+	switch {
+	case class == Skip:
+		return &Result{Optionals: make(map[string]json.RawMessage)}, SourceLocal, nil
+	case class == JWT && opt.validateJWT != nil:
+		res, err := opt.validateJWT(ctx, token)
+		if err == nil && res != nil {
+			useScopeOptions(res, opt)
+		}
+		return res, SourceLocal, err
+	}
+
+	key := cacheKey(ctx, token)
+
+	var stale *Result
 	if opt.cache != nil {
-		if res := opt.cache.Get(token); res != nil {
-			return res, nil
+		if res, entry := cachedResult(ctx, key, opt); res != nil {
+			if !needsRevalidation(res, opt) {
+				if opt.slidingIdle > 0 {
+					if expires, ok := touch(ctx, key, res, opt); ok && entry != nil {
+						entry.ExpiresAt = expires
+					}
+				}
+
+				cached := *res
+				cached.FromCache = true
+				cached.entry = entry
+				useScopeOptions(&cached, opt)
+				return &cached, SourceCache, nil
+			}
+
+			stale = res
+		}
+	}
+
+	if opt.errCache != nil {
+		if err := opt.errCache.Get(key); err != nil {
+			return nil, SourceCache, err
+		}
+	}
+
+	if opt.sem != nil {
+		select {
+		case opt.sem <- struct{}{}:
+			defer func() { <-opt.sem }()
+		case <-ctx.Done():
+			return nil, SourceEndpoint, ctx.Err()
+		}
+	}
+
+	var res *Result
+	var err error
+	revalidated := false
+	switch {
+	case opt.introspector != nil:
+		res, err = opt.introspector.Do(ctx, token)
+	case stale != nil:
+		res, err = introspect(ctx, token, stale.ETag, opt)
+		if err == errNotModified {
+			// stale was enriched when it was first retrieved
+			cp := *stale
+			res, err, revalidated = &cp, nil, true
+		}
+	default:
+		res, err = introspect(ctx, token, "", opt)
+	}
+
+	if err == nil && !revalidated {
+		if err = enrichResult(ctx, res, true, opt); err != nil {
+			return nil, SourceEndpoint, err
+		}
+	}
+
+	if err != nil {
+		// a cancelled or timed out request context says nothing about the token
+		if opt.errCache != nil && ctx.Err() == nil {
+			opt.errCache.Store(key, err, opt.errCacheTTL)
+		}
+
+		return nil, SourceEndpoint, err
+	}
+
+	res.RetrievedAt = opt.clock.Now()
+	useScopeOptions(res, opt)
+
+	if opt.bind != nil {
+		bindResult(ctx, res)
+	}
+
+	if opt.cache != nil && (opt.noCache == nil || !opt.noCache(res)) {
+		exp := cacheTTL(res, opt)
+		if opt.slidingIdle > 0 {
+			exp = slidingTTL(res, res.RetrievedAt, opt)
 		}
+
+		if exp > 0 {
+			if opt.revalidationWindow > 0 && res.ETag != "" {
+				exp += opt.revalidationWindow
+			}
+
+			storeResult(ctx, key, res, exp, opt)
+		}
+	}
+
+	return res, SourceEndpoint, nil
+}
+
+const discriminatorKey = resKeyType(4)
+
+// cacheKey returns the key the result for token is cached under, token itself unless WithCacheDiscriminator is used
+func cacheKey(ctx context.Context, token string) string {
+	disc, ok := ctx.Value(discriminatorKey).(string)
+	if !ok {
+		return token
 	}
 
-	res, err := introspect(token, &opt)
+	// the length prefix keeps discriminator and token boundaries unambiguous
+	return strconv.Itoa(len(disc)) + ":" + disc + token
+}
 
-	if err == nil && opt.cache != nil {
-		opt.cache.Store(token, res, opt.cacheExp)
+// discriminatorContext returns ctx carrying the cache discriminator derived from r, if WithCacheDiscriminator is used
+func discriminatorContext(ctx context.Context, r *http.Request, opt *Options) context.Context {
+	if opt.cacheDiscriminator == nil {
+		return ctx
 	}
 
-	return res, err
+	return context.WithValue(ctx, discriminatorKey, opt.cacheDiscriminator(r))
+}
+
+// needsRevalidation reports whether the cached res outlived its cache lifetime and is only kept to be revalidated, see WithETagRevalidation
+func needsRevalidation(res *Result, opt *Options) bool {
+	return opt.revalidationWindow > 0 && res.ETag != "" && opt.clock.Now().Sub(res.RetrievedAt) >= cacheTTL(res, opt)
 }
 
-func introspect(token string, opt *Options) (*Result, error) {
+// cacheTTL returns the duration for which res can be cached, the configured expiry capped by the token's own expiry
+func cacheTTL(res *Result, opt *Options) time.Duration {
+	exp := opt.cacheExp
+	if opt.slidingIdle > 0 {
+		exp = opt.slidingMax
+	}
+
+	if until, ok := res.EffectiveExpiry(res.RetrievedAt); ok {
+		if d := until.Add(opt.clockSkew).Sub(res.RetrievedAt); d < exp {
+			exp = d
+		}
+	}
+
+	if opt.respectCacheControl {
+		exp = capCacheControl(res, exp, res.RetrievedAt)
+	}
+
+	return exp
+}
+
+// introspect posts token to the introspection endpoint. A non empty etag is sent as If-None-Match, a 304 response then yields errNotModified.
+func introspect(ctx context.Context, token, etag string, opt *Options) (*Result, error) {
 
 	body := make(url.Values, len(opt.body))
 
@@ -34,52 +259,428 @@ func introspect(token string, opt *Options) (*Result, error) {
 		body[k] = v
 	}
 
+	for k, v := range clientParamsFromContext(ctx) {
+		body[k] = v
+	}
+
 	body.Set("token", token)
 
-	req, err := http.NewRequest("POST", opt.endpoint, strings.NewReader(body.Encode()))
+	if opt.tokenTypeHint != nil {
+		if hint := opt.tokenTypeHint(token); hint != "" {
+			body.Set("token_type_hint", hint)
+			return post(ctx, body, etag, opt)
+		}
+	}
+
+	if opt.probe != nil && len(opt.probe.hints) > 0 {
+		return opt.probe.introspect(ctx, token, body, etag, opt)
+	}
+
+	return post(ctx, body, etag, opt)
+}
+
+// post posts body to the introspection endpoint, or the endpoints of the pool
+func post(ctx context.Context, body url.Values, etag string, opt *Options) (*Result, error) {
+	if opt.endpointPool != nil {
+		return opt.endpointPool.do(ctx, func(endpoint string) (*Result, error) {
+			return introspectAt(ctx, endpoint, body, etag, opt)
+		})
+	}
+
+	return introspectAt(ctx, opt.endpoint, body, etag, opt)
+}
+
+// introspectAt posts body to endpoint and decodes the response
+func introspectAt(ctx context.Context, endpoint string, body url.Values, etag string, opt *Options) (*Result, error) {
+	res, err := send(ctx, endpoint, body, etag, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(res.Body)
+
+	if etag != "" && res.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+
+	if !opt.successStatus(res.StatusCode) {
+		if err := overloadedError(res.StatusCode, res.Header.Get("Retry-After"), opt.clock.Now()); err != nil {
+			return nil, err
+		}
+
+		return nil, statusError(res.StatusCode, res.Body)
+	}
+
+	if res.StatusCode == http.StatusNoContent {
+		return nil, ErrNoContent
+	}
+
+	data, err := readBody(res.Body, opt.maxResponseBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newResult(opt)
+	if err := decodeResult(data, result, opt.fieldAliases, opt.claimWhitelist, func(alias, name string) { opt.hooks.fieldAliasConflict(ctx, alias, name) }); err != nil {
+		releaseResult(opt, result)
+		return nil, &malformedResponseError{err: err}
+	}
+
+	result.ETag = res.Header.Get("ETag")
+
+	if opt.respectCacheControl {
+		result.cacheControl = parseCacheControl(res.Header.Get("Cache-Control"))
+	}
+
+	if opt.deriveExp {
+		deriveExp(result, opt.clock.Now())
+	}
+
+	return result, nil
+}
+
+// send posts body to endpoint. With WithCredentials a 401 response makes it refresh the credentials and
+// send the request once more, signed anew with WithMessageSignature.
+func send(ctx context.Context, endpoint string, body url.Values, etag string, opt *Options) (*http.Response, error) {
+	for retried := false; ; retried = true {
+		req, err := newIntrospectionRequest(ctx, endpoint, body, etag, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		var gen uint64
+		if opt.credentials != nil {
+			if gen, err = opt.credentials.apply(req); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, modify := range opt.requestModifiers {
+			modify(req)
+		}
+
+		if opt.messageSignature != nil {
+			if err := opt.messageSignature.sign(req, opt.clock.Now()); err != nil {
+				return nil, err
+			}
+		}
+
+		if opt.capturedBody != nil {
+			if err := captureBody(req, opt); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := opt.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if opt.credentials == nil || retried || res.StatusCode != http.StatusUnauthorized {
+			return res, nil
+		}
+
+		drainAndClose(res.Body)
+
+		if err := opt.credentials.refresh(ctx, gen); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// captureBody passes the form values of the body req is about to send, with its secrets redacted, to the WithCapturedRequestBody
+// function. The body is read through GetBody, or read and replaced by an identical one when a modifier left GetBody unset.
+func captureBody(req *http.Request, opt *Options) error {
+	var body io.Reader
+	switch {
+	case req.GetBody != nil:
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		body = rc
+	case req.Body != nil && req.Body != http.NoBody:
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		body = bytes.NewReader(data)
+	default:
+		body = strings.NewReader("")
+	}
+
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+
+		body = zr
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	opt.capturedBody(req.Context(), redactedValues(values))
+	return nil
+}
+
+func newIntrospectionRequest(ctx context.Context, endpoint string, body url.Values, etag string, opt *Options) (*http.Request, error) {
+	reqBody, err := encodeBody(body, opt)
 	if err != nil {
 		return nil, err
 	}
-	req.Header = opt.header
 
-	res, err := opt.Client.Do(req)
+	req, err := http.NewRequest("POST", endpoint, reqBody)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
+	req = req.WithContext(ctx)
+	req.Header = opt.header.Clone()
+
+	if opt.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("status does not indicate success: code: %d, body: %v", res.StatusCode, res.Body)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
 
-	return extractIntrospectResult(res.Body)
+	return req, nil
 }
 
-func extractIntrospectResult(r io.Reader) (*Result, error) {
-	res := Result{
+func copyValues(v url.Values) url.Values {
+	cp := make(url.Values, len(v))
+	for k, vals := range v {
+		cp[k] = append([]string(nil), vals...)
+	}
+
+	return cp
+}
+
+// redactedValues returns a copy of v with its secret members replaced by RedactedValue
+func redactedValues(v url.Values) url.Values {
+	cp := copyValues(v)
+	for _, k := range []string{"token", "client_secret", "client_assertion"} {
+		if vals, ok := cp[k]; ok {
+			for i := range vals {
+				vals[i] = RedactedValue
+			}
+		}
+	}
+
+	return cp
+}
+
+// encodeBody form encodes body, gzipping it if WithRequestGzip was used
+func encodeBody(body url.Values, opt *Options) (io.Reader, error) {
+	if !opt.gzip {
+		return strings.NewReader(body.Encode()), nil
+	}
+
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, body.Encode()); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &buf, nil
+}
+
+// readBody reads at most max bytes from r, failing with ErrResponseTooLarge if there is more
+func readBody(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > max {
+		return nil, ErrResponseTooLarge
+	}
+
+	return data, nil
+}
+
+// extractIntrospectResult parses an introspection response. The response must be a single JSON object without duplicate members,
+// nested at most maxResponseDepth levels deep, and its date claims must be valid NumericDates.
+func extractIntrospectResult(data []byte) (*Result, error) {
+	res := &Result{
 		Optionals: make(map[string]json.RawMessage),
 	}
 
-	if err := json.NewDecoder(r).Decode(&res.Optionals); err != nil {
+	if err := decodeResult(data, res, nil, nil, nil); err != nil {
 		return nil, err
 	}
 
+	return res, nil
+}
+
+// decodeResult is extractIntrospectResult decoding into res, whose Optionals must be an empty map. Members named after a key of
+// aliases are renamed to its value, see WithFieldAliases, conflict is called for those that can't be. A non nil keep drops the
+// members other than active that are not in it, or whose alias is not, while they are decoded, see WithClaimWhitelist.
+func decodeResult(data []byte, res *Result, aliases map[string]string, keep map[string]bool, conflict func(alias, name string)) error {
+	if err := checkDepth(data, maxResponseDepth); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return errNotObject
+	}
+
+	// dropped members are decoded into the same buffer, which grows to the largest of them
+	var dropped json.RawMessage
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key := tok.(string)
+		if keep != nil && key != "active" && !keep[key] && !keep[aliases[key]] {
+			if err := dec.Decode(&dropped); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, ok := res.Optionals[key]; ok {
+			return fmt.Errorf("duplicate member %q in introspection response", key)
+		}
+
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return err
+		}
+
+		res.Optionals[key] = val
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+
+	applyAliases(res.Optionals, aliases, conflict)
+
 	if val, ok := res.Optionals["active"]; ok {
 		if err := json.Unmarshal(val, &res.Active); err != nil {
-			return nil, err
+			return errors.New("active member of introspection response is not a boolean")
 		}
 
 		delete(res.Optionals, "active")
 	}
 
-	return &res, nil
+	for _, name := range numericDateClaims {
+		if val, ok := res.Optionals[name]; ok {
+			if _, err := parseNumericDate(name, val); err != nil {
+				return err
+			}
+		}
+	}
+
+	if val, ok := res.Optionals["expires_in"]; ok {
+		if _, err := parseSeconds("expires_in", val); err != nil {
+			return err
+		}
+	}
+
+	decodeStandardClaims(res)
+
+	return nil
+}
+
+// checkDepth fails if the JSON in data nests objects and arrays deeper than max. data is not validated otherwise.
+func checkDepth(data []byte, max int) error {
+	depth, inString, escaped := 0, false, false
+
+	for _, c := range data {
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > max {
+				return errTooDeep
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+
+	return nil
 }
 
 // Result is the OAuth2 Introspection Result
 type Result struct {
 	Active bool
 
+	// The standard claims of rfc7662 section 2.2, left empty when absent or of an unexpected type. They are copies, the claims
+	// remain in Optionals as well.
+	Scope     string
+	ClientID  string
+	Username  string
+	TokenType string
+	Exp       int64
+	Iat       int64
+	Nbf       int64
+	Sub       string
+	Aud       []string
+	Iss       string
+	Jti       string
+
 	Optionals map[string]json.RawMessage
+
+	// RetrievedAt is the time at which the result was received from the introspection endpoint. It is preserved by the cache.
+	RetrievedAt time.Time
+	// FromCache is true when the result was served from the cache rather than a live introspection call
+	FromCache bool
+	// ETag is the entity tag the introspection endpoint sent with the result, if any. See WithETagRevalidation.
+	ETag string
+	// Binding is the binding of the request the result was introspected for, see WithBindTo. It is preserved by the cache.
+	Binding string
+	// ExpDerived is true when the exp claim was not sent by the introspection endpoint but derived from expires_in, see WithDerivedExp
+	ExpDerived bool
+
+	// entry describes the cache entry the result was served from, when the cache is an EntryInspector
+	entry *EntryInfo
+	// cacheControl holds the Cache-Control directives of the response, see WithRespectCacheControl
+	cacheControl cacheControl
+	// scopeClaim is the claim Scopes reads, see WithScopeClaim
+	scopeClaim string
+	// scopeMatcher is used by HasScope, see WithScopeMatcher
+	scopeMatcher func(have, want string) bool
 }
 
 type resKeyType int
@@ -89,6 +690,114 @@ const resKey = resKeyType(1)
 type result struct {
 	Result *Result
 	Err    error
+
+	// token and endpoint identify the introspection that produced the result
+	token    string
+	endpoint string
+
+	meta Meta
+
+	// metadata is derived from Result, see WithMetadataDeriver
+	metadata map[string]interface{}
+
+	// clock and clockSkew are those of the middleware, for checks made behind it
+	clock     Clock
+	clockSkew time.Duration
+
+	// shadowHooks are the hooks of a middleware in shadow mode, see WithShadowMode
+	shadowHooks *Hooks
+
+	// proxy is set behind a middleware using WithProxyAuthorization, for the rejections of requirements made behind it
+	proxy bool
+
+	// actor is the result of the actor token, see WithActorToken, actorRequired tells whether it had to be present
+	actor         *result
+	actorRequired bool
+
+	// denied is set when Err was returned by an authorizer, see WithAuthorizer
+	denied bool
+
+	// lookup is the result looked up for token before the checks of the middleware, lookupErr the error of a failed lookup.
+	// Nested middlewares reuse them, see resolve.
+	lookup    *Result
+	lookupErr error
+
+	// pooled is set when Result came from the pool of the middleware that resolved it, see WithResultPool
+	pooled bool
+}
+
+// resolve introspects token. When an enclosing middleware instance already looked up the same token against the same endpoint,
+// e.g. because the middleware was applied at both the router and the route level, its lookup is reused and only the checks of
+// opt are applied again.
+func resolve(ctx context.Context, token string, opt *Options) *result {
+	if prev, ok := ctx.Value(resKey).(*result); ok && prev.token == token && prev.endpoint == opt.endpoint {
+		if prev.lookupErr != nil {
+			// a copy, so that the nested middleware's state, e.g. a shadow denial, doesn't leak into the enclosing one's
+			return &result{Err: prev.lookupErr, token: prev.token, endpoint: prev.endpoint, meta: prev.meta, lookupErr: prev.lookupErr, clock: opt.clock, clockSkew: opt.clockSkew}
+		}
+
+		if prev.lookup != nil {
+			return recheck(ctx, prev, opt)
+		}
+	}
+
+	start := opt.clock.Now()
+
+	o := *opt
+	deadlineCtx, expired, stop := introspectionDeadline(ctx, &o)
+
+	var res, looked *Result
+	var lookupErr error
+	src := SourceLocal
+	err := checkDenyList(deadlineCtx, token, nil, &o)
+	if err == nil {
+		looked, src, lookupErr = softLookupResult(deadlineCtx, token, &o)
+		if err = lookupErr; err == nil {
+			res, err = checkResult(deadlineCtx, token, looked, src, &o)
+		}
+	}
+	stop()
+
+	if err != nil && expired() {
+		err = ErrIntrospectionDeadline
+		if lookupErr != nil {
+			lookupErr = err
+		}
+	}
+
+	meta := Meta{Source: src, Latency: opt.clock.Now().Sub(start)}
+	if src == SourceCache {
+		meta.CacheHit = true
+		if res != nil {
+			meta.EntryAge = start.Sub(res.RetrievedAt)
+			if res.entry != nil {
+				meta.EntryAge = start.Sub(res.entry.StoredAt)
+				meta.EntryExpiresAt = res.entry.ExpiresAt
+			}
+		}
+	}
+
+	pooled := opt.resultPool != nil && opt.introspector == nil && src == SourceEndpoint && res != nil
+
+	return deriveMetadata(&result{Result: res, Err: err, token: token, endpoint: opt.endpoint, meta: meta, lookup: looked, lookupErr: lookupErr, pooled: pooled, clock: opt.clock, clockSkew: opt.clockSkew}, opt)
+}
+
+// recheck returns the result of prev's lookup for a nested middleware with opt, which may check it differently than the
+// middleware that resolved prev did. The lookup remains owned by that middleware, the returned result is not pooled.
+func recheck(ctx context.Context, prev *result, opt *Options) *result {
+	res, err := (*Result)(nil), checkDenyList(ctx, prev.token, nil, opt)
+	if err == nil {
+		res, err = checkResult(ctx, prev.token, prev.lookup, prev.meta.Source, opt)
+	}
+
+	rechecked := &result{Result: res, Err: err, token: prev.token, endpoint: prev.endpoint, meta: prev.meta, lookup: prev.lookup, clock: opt.clock, clockSkew: opt.clockSkew}
+	if err == nil && res == prev.Result && prev.metadata != nil {
+		// the checks left the result as it was, so is the metadata derived from it
+		rechecked.metadata = prev.metadata
+		return rechecked
+	}
+
+	return deriveMetadata(rechecked, opt)
 }
 
 // FromContext ...
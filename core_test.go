@@ -0,0 +1,172 @@
+package introspection
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzExtractIntrospectResult(f *testing.F) {
+	for _, seed := range []string{
+		`{"active":true}`,
+		`{"active":false}`,
+		`{"active":true,"scope":"read write","exp":1500000000,"iat":1400000000,"nbf":1400000000,"sub":"user"}`,
+		`{"active":true,"expires_in":300,"additional":{"role":["admin"]}}`,
+		`{"active":true,"exp":1e300}`,
+		`{"active":true,"active":false}`,
+		`[{"active":true}]`,
+		`null`,
+		`{"active":"true"}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, err := extractIntrospectResult(data)
+		if err != nil {
+			if res != nil {
+				t.Fatal("result should be nil when err is non-nil")
+			}
+			return
+		}
+
+		if first := firstJSONByte(data); first != '{' && first != 0 {
+			t.Fatalf("non-object response %q should be rejected", data)
+		}
+
+		if _, ok := res.Optionals["active"]; ok {
+			t.Fatal("active should not be present in optionals")
+		}
+
+		for name, raw := range res.Optionals {
+			if !json.Valid(raw) {
+				t.Fatalf("optional %q is not valid JSON: %s", name, raw)
+			}
+		}
+
+		for _, name := range numericDateClaims {
+			if raw, ok := res.Optionals[name]; ok {
+				if _, err := parseNumericDate(name, raw); err != nil {
+					t.Fatalf("accepted result has invalid %s: %v", name, err)
+				}
+			}
+		}
+
+		res.EffectiveExpiry(time.Now())
+	})
+}
+
+// firstJSONByte returns the first byte of data that is not JSON whitespace, or 0
+func firstJSONByte(data []byte) byte {
+	for _, c := range data {
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func TestExtractIntrospectResultNotObject(t *testing.T) {
+	for _, data := range []string{`[{"active":true}]`, `[]`, `"active"`, `true`, `1`, `null`, ` [] `} {
+		res, err := extractIntrospectResult([]byte(data))
+		if err != errNotObject {
+			t.Fatalf("%s: expected errNotObject, got: %v, %#v", data, err, res)
+		}
+	}
+}
+
+func TestExtractIntrospectResultRejects(t *testing.T) {
+	tt := []struct {
+		name string
+		data string
+	}{
+		{name: "Deeply Nested", data: `{"active":true,"x":` + strings.Repeat("[", 33) + strings.Repeat("]", 33) + `}`},
+		{name: "Overflowing Exp", data: `{"active":true,"exp":92233720368547758070}`},
+		{name: "Exp Beyond Year 9999", data: `{"active":true,"exp":9223372036854775807}`},
+		{name: "Negative Exp", data: `{"active":true,"exp":-1}`},
+		{name: "Overflowing Expires In", data: `{"active":true,"expires_in":9223372036854775807}`},
+		{name: "Duplicate Member", data: `{"active":false,"active":true}`},
+		{name: "Array", data: `[{"active":true}]`},
+		{name: "Trailing Data", data: `{"active":true}{"active":false}`},
+		{name: "Active Not A Boolean", data: `{"active":"true"}`},
+		{name: "Truncated", data: `{"active":true,"sub":`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := extractIntrospectResult([]byte(tc.data))
+			if err == nil {
+				t.Fatalf("expected an error, got: %#v", res)
+			}
+		})
+	}
+
+	t.Run("Nested Strings Do Not Count", func(t *testing.T) {
+		_, err := extractIntrospectResult([]byte(`{"active":true,"x":"` + strings.Repeat("[", 100) + `"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestExtractIntrospectResultStandardClaims(t *testing.T) {
+	data := `{"active":true,"scope":"read write","client_id":"app","username":"alice","token_type":"Bearer",` +
+		`"exp":1500000000,"iat":1400000000,"nbf":1400000001,"sub":"u-1","aud":["api","web"],"iss":"https://as.example.com",` +
+		`"jti":"t-1","role":"admin"}`
+
+	res, err := extractIntrospectResult([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Result{
+		Active:    true,
+		Scope:     "read write",
+		ClientID:  "app",
+		Username:  "alice",
+		TokenType: "Bearer",
+		Exp:       1500000000,
+		Iat:       1400000000,
+		Nbf:       1400000001,
+		Sub:       "u-1",
+		Aud:       []string{"api", "web"},
+		Iss:       "https://as.example.com",
+		Jti:       "t-1",
+		Optionals: res.Optionals,
+	}
+
+	if !reflect.DeepEqual(want, *res) {
+		t.Fatalf("typed fields mismatch:\n\twant: %#v\n\tgot:  %#v", want, *res)
+	}
+
+	for _, name := range []string{"scope", "client_id", "username", "token_type", "exp", "iat", "nbf", "sub", "aud", "iss", "jti", "role"} {
+		if _, ok := res.Optionals[name]; !ok {
+			t.Errorf("%s should remain in optionals", name)
+		}
+	}
+
+	t.Run("Single Audience", func(t *testing.T) {
+		res, err := extractIntrospectResult([]byte(`{"active":true,"aud":"api"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual([]string{"api"}, res.Aud) {
+			t.Fatalf("unexpected aud: %v", res.Aud)
+		}
+	})
+
+	t.Run("Unexpected Types", func(t *testing.T) {
+		res, err := extractIntrospectResult([]byte(`{"active":true,"scope":["read"],"sub":1,"aud":{}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Scope != "" || res.Sub != "" || res.Aud != nil {
+			t.Fatalf("claims of unexpected types should be left empty: %#v", res)
+		}
+	})
+}
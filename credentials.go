@@ -0,0 +1,156 @@
+package introspection
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sync"
+)
+
+// Credentials authenticate the introspection requests of the middleware to the authorization server
+type Credentials interface {
+	// Apply authenticates req, e.g. by setting its Authorization header
+	Apply(req *http.Request) error
+	// Refresh is called when the introspection endpoint rejected the credentials Apply added with 401 Unauthorized. It should
+	// discard them and obtain new ones, e.g. fetch a new access token or reload a rotated client secret.
+	Refresh(ctx context.Context) error
+}
+
+// WithCredentials authenticates introspection requests with creds. When the introspection endpoint responds with 401 Unauthorized
+// the credentials are refreshed and the introspection is retried once before failing. Concurrent requests rejected with the same
+// credentials share a single refresh.
+func WithCredentials(creds Credentials) Option {
+	return func(opt *Options) {
+		opt.credentials = &credentialState{creds: creds}
+		opt.clientAuth = append(opt.clientAuth, "WithCredentials")
+	}
+}
+
+// WithClientCertificate authenticates introspection requests with mutual TLS, presenting cert as per rfc8705. The authorization
+// server usually also expects the client_id parameter, see WithAddedBody. It panics when used with a caller supplied Client.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(opt *Options) {
+		opt.clientCertificate = &cert
+		opt.clientAuth = append(opt.clientAuth, "WithClientCertificate")
+	}
+}
+
+// TokenSourceCredentials returns Credentials sending the access token fetch returns as a Bearer token, e.g. one obtained with the
+// client credentials grant. The token is fetched on first use and then reused until the introspection endpoint rejects it.
+func TokenSourceCredentials(fetch func(ctx context.Context) (string, error)) Credentials {
+	return &tokenSourceCredentials{fetch: fetch}
+}
+
+// BasicCredentials returns Credentials sending the client id and secret load returns with HTTP Basic authentication. They are loaded
+// on first use and reloaded when the introspection endpoint rejects them, e.g. after the secret was rotated.
+func BasicCredentials(load func(ctx context.Context) (clientID, clientSecret string, err error)) Credentials {
+	return &basicCredentials{load: load}
+}
+
+type tokenSourceCredentials struct {
+	fetch func(context.Context) (string, error)
+
+	mu    sync.Mutex
+	token string
+}
+
+func (c *tokenSourceCredentials) Apply(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" {
+		token, err := c.fetch(req.Context())
+		if err != nil {
+			return err
+		}
+
+		c.token = token
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+func (c *tokenSourceCredentials) Refresh(ctx context.Context) error {
+	token, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+
+	return nil
+}
+
+type basicCredentials struct {
+	load func(context.Context) (string, string, error)
+
+	mu         sync.Mutex
+	loaded     bool
+	id, secret string
+}
+
+func (c *basicCredentials) Apply(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loaded {
+		id, secret, err := c.load(req.Context())
+		if err != nil {
+			return err
+		}
+
+		c.id, c.secret, c.loaded = id, secret, true
+	}
+
+	req.SetBasicAuth(c.id, c.secret)
+	return nil
+}
+
+func (c *basicCredentials) Refresh(ctx context.Context) error {
+	id, secret, err := c.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.id, c.secret, c.loaded = id, secret, true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// credentialState tracks refreshes of Credentials so that requests rejected with the same credentials refresh them only once
+type credentialState struct {
+	creds Credentials
+
+	mu         sync.Mutex
+	generation uint64
+}
+
+// apply authenticates req, returning the generation of the credentials used
+func (s *credentialState) apply(req *http.Request) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generation, s.creds.Apply(req)
+}
+
+// refresh refreshes the credentials of generation gen, unless another request already did
+func (s *credentialState) refresh(ctx context.Context, gen uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.generation != gen {
+		return nil
+	}
+
+	if err := s.creds.Refresh(ctx); err != nil {
+		return err
+	}
+
+	s.generation++
+	return nil
+}
@@ -0,0 +1,103 @@
+package introspection_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestCredentialsRefresh(t *testing.T) {
+	var valid atomic.Value
+	valid.Store("caller-1")
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		if r.Header.Get("Authorization") != "Bearer "+valid.Load().(string) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true}`))
+	}))
+	defer ts.Close()
+
+	var fetches int32
+	creds := intro.TokenSourceCredentials(func(ctx context.Context) (string, error) {
+		return "caller-" + strconv.Itoa(int(atomic.AddInt32(&fetches, 1))), nil
+	})
+
+	h := intro.Introspection(ts.URL, intro.WithCredentials(creds), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, int32(1), atomic.LoadInt32(&fetches))
+	equals(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the caller credential expires
+	valid.Store("caller-2")
+
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, int32(2), atomic.LoadInt32(&fetches))
+	equals(t, int32(3), atomic.LoadInt32(&calls))
+
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, int32(2), atomic.LoadInt32(&fetches))
+	equals(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestCredentialsRefreshOnce(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid_client"}`))
+	}))
+	defer ts.Close()
+
+	var loads int32
+	creds := intro.BasicCredentials(func(ctx context.Context) (string, string, error) {
+		atomic.AddInt32(&loads, 1)
+		return "client", "secret", nil
+	})
+
+	_, err := intro.FromContext(introspectedContextAt(t, ts.URL, intro.WithCredentials(creds)))
+
+	asErr, isASError := err.(*intro.ASError)
+	assert(t, isASError, "error should be an ASError: %v", err)
+	equals(t, "invalid_client", asErr.Code)
+	equals(t, int32(2), atomic.LoadInt32(&loads))
+	equals(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestCredentialsRefreshError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	errRotation := errors.New("secret store unavailable")
+
+	loaded := false
+	creds := intro.BasicCredentials(func(ctx context.Context) (string, string, error) {
+		if loaded {
+			return "", "", errRotation
+		}
+
+		loaded = true
+		return "client", "secret", nil
+	})
+
+	_, err := intro.FromContext(introspectedContextAt(t, ts.URL, intro.WithCredentials(creds)))
+
+	equals(t, errRotation, err)
+}
@@ -0,0 +1,45 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIntrospectionDeadline is returned by FromContext when the introspection did not complete within the deadline set by
+// WithIntrospectionDeadline
+var ErrIntrospectionDeadline = errors.New("introspection did not complete within the deadline")
+
+// WithIntrospectionDeadline bounds the whole introspection of a request to d from the moment it starts: cache lookups, waits for a
+// slot of WithMaxConcurrency or for a concurrent request with the same token, and the call to the introspection endpoint,
+// however longer the timeout of the Client is. Introspections taking longer fail with ErrIntrospectionDeadline, they are not
+// remembered by WithErrorCacheTTL.
+func WithIntrospectionDeadline(d time.Duration) Option {
+	return func(opt *Options) {
+		opt.introspectionDeadline = d
+	}
+}
+
+// introspectionDeadline returns ctx cancelled once the deadline of WithIntrospectionDeadline elapses, a function reporting whether
+// it did, and one releasing the resources of the deadline
+func introspectionDeadline(ctx context.Context, opt *Options) (context.Context, func() bool, func()) {
+	if opt.introspectionDeadline <= 0 {
+		return ctx, func() bool { return false }, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var expired int32
+	timer := opt.clock.AfterFunc(opt.introspectionDeadline, func() {
+		atomic.StoreInt32(&expired, 1)
+		cancel()
+	})
+
+	stop := func() {
+		timer.Stop()
+		cancel()
+	}
+
+	return ctx, func() bool { return atomic.LoadInt32(&expired) == 1 }, stop
+}
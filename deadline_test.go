@@ -0,0 +1,81 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestIntrospectionDeadline(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" || r.PostFormValue("token") == "slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	// the client timeout is far longer than the deadline
+	setClient := func(opt *intro.Options) { opt.Client = &http.Client{Timeout: time.Minute} }
+
+	t.Run("Endpoint", func(t *testing.T) {
+		start := time.Now()
+
+		_, err := intro.FromContext(introspectedContextAt(t, ts.URL+"/slow", setClient, intro.WithIntrospectionDeadline(50*time.Millisecond)))
+
+		equals(t, intro.ErrIntrospectionDeadline, err)
+		assert(t, time.Since(start) < 5*time.Second, "the deadline should cut the introspection short")
+	})
+
+	t.Run("Within Deadline", func(t *testing.T) {
+		res, err := intro.FromContext(introspectedContextAt(t, ts.URL, setClient, intro.WithIntrospectionDeadline(5*time.Second)))
+
+		ok(t, err)
+		equals(t, true, res.Active)
+	})
+
+	t.Run("Slow Cache", func(t *testing.T) {
+		cache := blockingCache{release}
+
+		_, err := intro.FromContext(introspectedContextAt(t, ts.URL, setClient, intro.WithCache(cache, time.Minute), intro.WithIntrospectionDeadline(50*time.Millisecond)))
+
+		equals(t, intro.ErrIntrospectionDeadline, err)
+	})
+}
+
+// blockingCache is a FallibleCache whose lookups block until release is closed or their context is done
+type blockingCache struct {
+	release chan struct{}
+}
+
+func (c blockingCache) Get(key string) *intro.Result {
+	return nil
+}
+
+func (c blockingCache) Store(key string, res *intro.Result, exp time.Duration) {}
+
+func (c blockingCache) GetContext(ctx context.Context, key string) (*intro.Result, error) {
+	select {
+	case <-c.release:
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c blockingCache) StoreContext(ctx context.Context, key string, res *intro.Result, exp time.Duration) error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package introspection
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DebugHandler returns a handler that introspects the token posted in the token form field with the same options the middleware
+// would use and responds with the result as indented JSON, along with whether it came from the cache, how old its entry is and,
+// for caches implementing EntryInspector, when the entry expires.
+// Setting the bypass_cache form field to true skips the cache, and the error cache, for that request without updating them.
+//
+// Every request must pass authz, others are rejected with 403. The token is never logged.
+// The handler is meant for operators, don't expose it without an authorization gate you trust.
+func DebugHandler(endpoint string, authz func(*http.Request) bool, opts ...Option) http.Handler {
+	opt := makeOptions(endpoint, opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authz(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := strings.TrimSpace(r.PostFormValue("token"))
+		if token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+
+		o := opt
+		if bypass, _ := strconv.ParseBool(r.PostFormValue("bypass_cache")); bypass {
+			o.cache, o.errCache = nil, nil
+		}
+
+		res, _, err := lookupResult(r.Context(), token, &o)
+		if err == nil {
+			err = validateResult(r.Context(), res, &o)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(newDebugResponse(res, err, o.clock.Now()))
+	})
+}
+
+type debugResponse struct {
+	Active      bool                       `json:"active"`
+	Claims      map[string]json.RawMessage `json:"claims,omitempty"`
+	RetrievedAt *time.Time                 `json:"retrieved_at,omitempty"`
+	Cache       debugCache                 `json:"cache"`
+	Error       string                     `json:"error,omitempty"`
+}
+
+type debugCache struct {
+	Hit bool `json:"hit"`
+	// Age is the age of the cache entry in seconds
+	Age float64 `json:"age,omitempty"`
+	// ExpiresAt is when the cache entry expires, if the cache is an EntryInspector
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func newDebugResponse(res *Result, err error, now time.Time) debugResponse {
+	var dr debugResponse
+
+	if err != nil {
+		dr.Error = err.Error()
+	}
+
+	if res == nil {
+		return dr
+	}
+
+	dr.Active, dr.Claims = res.Active, res.Optionals
+
+	if !res.RetrievedAt.IsZero() {
+		dr.RetrievedAt = &res.RetrievedAt
+	}
+
+	if res.FromCache {
+		dr.Cache = debugCache{Hit: true, Age: now.Sub(res.RetrievedAt).Seconds()}
+		if res.entry != nil {
+			dr.Cache.Age, dr.Cache.ExpiresAt = now.Sub(res.entry.StoredAt).Seconds(), &res.entry.ExpiresAt
+		}
+	}
+
+	return dr
+}
@@ -0,0 +1,148 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func debugRequest(h http.Handler, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/debug", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestDebugHandler(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "user"})
+	}))
+	defer ts.Close()
+
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+	cache := intro.NewInMemoryCache(intro.CacheClock(clock))
+
+	allow := true
+	h := intro.DebugHandler(ts.URL, func(*http.Request) bool { return allow },
+		intro.WithClock(clock),
+		intro.WithCache(cache, time.Minute),
+	)
+
+	t.Run("Gate", func(t *testing.T) {
+		allow = false
+		defer func() { allow = true }()
+
+		rr := debugRequest(h, url.Values{"token": {"token"}})
+
+		equals(t, http.StatusForbidden, rr.Code)
+		equals(t, 0, hits)
+	})
+
+	t.Run("No Token", func(t *testing.T) {
+		rr := debugRequest(h, url.Values{})
+
+		equals(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Method", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", "/debug?token=token", nil))
+
+		equals(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("Miss", func(t *testing.T) {
+		rr := debugRequest(h, url.Values{"token": {"token"}})
+
+		equals(t, http.StatusOK, rr.Code)
+		equals(t, "application/json", rr.Header().Get("Content-Type"))
+		assert(t, !strings.Contains(rr.Body.String(), `"token"`), "response should not contain the token")
+
+		var got map[string]interface{}
+		ok(t, json.Unmarshal(rr.Body.Bytes(), &got))
+
+		equals(t, map[string]interface{}{
+			"active":       true,
+			"claims":       map[string]interface{}{"sub": "user"},
+			"retrieved_at": "2017-07-14T02:40:00Z",
+			"cache":        map[string]interface{}{"hit": false},
+		}, normalizeTimes(got))
+		equals(t, 1, hits)
+	})
+
+	t.Run("Hit", func(t *testing.T) {
+		clock.Advance(1500 * time.Millisecond)
+
+		rr := debugRequest(h, url.Values{"token": {"token"}})
+
+		var got struct {
+			Cache struct {
+				Hit       bool
+				Age       float64
+				ExpiresAt time.Time `json:"expires_at"`
+			}
+		}
+		ok(t, json.Unmarshal(rr.Body.Bytes(), &got))
+
+		equals(t, true, got.Cache.Hit)
+		equals(t, 1.5, got.Cache.Age)
+		assert(t, got.Cache.ExpiresAt.After(clock.Now()), "entry expiry %v should be reported", got.Cache.ExpiresAt)
+		equals(t, 1, hits)
+	})
+
+	t.Run("Bypass Cache", func(t *testing.T) {
+		rr := debugRequest(h, url.Values{"token": {"token"}, "bypass_cache": {"true"}})
+
+		var got struct {
+			Cache struct {
+				Hit bool
+			}
+		}
+		ok(t, json.Unmarshal(rr.Body.Bytes(), &got))
+
+		equals(t, false, got.Cache.Hit)
+		equals(t, 2, hits)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		h := intro.DebugHandler(ts.URL, func(*http.Request) bool { return true },
+			intro.WithRequiredAudience("api", false),
+		)
+
+		rr := debugRequest(h, url.Values{"token": {"token"}})
+
+		var got struct {
+			Active bool
+			Error  string
+		}
+		ok(t, json.Unmarshal(rr.Body.Bytes(), &got))
+
+		equals(t, true, got.Active)
+		equals(t, intro.ErrInvalidAudience.Error(), got.Error)
+	})
+}
+
+// normalizeTimes rewrites retrieved_at in UTC so the comparison doesn't depend on the local time zone
+func normalizeTimes(m map[string]interface{}) map[string]interface{} {
+	if s, ok := m["retrieved_at"].(string); ok {
+		if at, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			m["retrieved_at"] = at.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,134 @@
+package introspection
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTokenDenied is returned by FromContext when the token is on the deny list, see WithDenyList
+var ErrTokenDenied = errors.New("token is denied")
+
+// DenyList holds tokens known to be compromised, see WithDenyList. Keys are jti claims, or token hashes for tokens without
+// one, see DenyListKey.
+type DenyList interface {
+	// Contains reports whether key is on the list
+	Contains(ctx context.Context, key string) (bool, error)
+	// Add puts key on the list until the given time, forever if it is zero
+	Add(ctx context.Context, key string, until time.Time) error
+}
+
+// WithDenyList rejects tokens on list with ErrTokenDenied, whether their result would be fresh or served from the cache.
+// The hash of the token is looked up before the cache and the introspection endpoint are consulted, the jti claim of active
+// results once it is known. Failing to consult the list fails the request with the list's error.
+func WithDenyList(list DenyList) Option {
+	return func(opt *Options) {
+		opt.denyList = list
+	}
+}
+
+// DenyListKey returns the key a token is denied under: its jti claim if res is non nil and has one, otherwise the hash of token
+func DenyListKey(token string, res *Result) string {
+	if res != nil {
+		if jti := res.stringClaim("jti"); jti != "" {
+			return jti
+		}
+	}
+
+	return tokenHashKey(token)
+}
+
+// DenyToken puts token, whose introspection result is res, on list until it expires, see DenyListKey. res may be nil,
+// the token is then denied by its hash and forever.
+func DenyToken(ctx context.Context, list DenyList, token string, res *Result) error {
+	var until time.Time
+	if res != nil {
+		if sec, ok := numericDateClaim(res, "exp"); ok {
+			until = time.Unix(sec, 0)
+		}
+	}
+
+	return list.Add(ctx, DenyListKey(token, res), until)
+}
+
+func tokenHashKey(token string) string {
+	return "sha256:" + hex.EncodeToString(hashToken(token))
+}
+
+// checkDenyList fails with ErrTokenDenied if token, or the jti of res when res is non nil, is on the deny list
+func checkDenyList(ctx context.Context, token string, res *Result, opt *Options) error {
+	if opt.denyList == nil {
+		return nil
+	}
+
+	key := tokenHashKey(token)
+	if res != nil {
+		if !res.Active {
+			return nil
+		}
+
+		if key = res.stringClaim("jti"); key == "" {
+			return nil
+		}
+	}
+
+	denied, err := opt.denyList.Contains(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if denied {
+		return ErrTokenDenied
+	}
+
+	return nil
+}
+
+// NewInMemoryDenyList returns an in memory implementation of DenyList whose entries are removed once they expire.
+// Only CacheClock applies to it.
+func NewInMemoryDenyList(opts ...CacheOption) DenyList {
+	opt := makeCacheOptions(opts)
+
+	return &inMemoryDenyList{clock: opt.clock, entries: make(map[string]time.Time)}
+}
+
+type inMemoryDenyList struct {
+	sync.Mutex
+
+	clock   Clock
+	entries map[string]time.Time
+}
+
+func (dl *inMemoryDenyList) Contains(_ context.Context, key string) (bool, error) {
+	dl.Lock()
+	defer dl.Unlock()
+
+	until, ok := dl.entries[key]
+	return ok && (until.IsZero() || dl.clock.Now().Before(until)), nil
+}
+
+func (dl *inMemoryDenyList) Add(_ context.Context, key string, until time.Time) error {
+	dl.Lock()
+	defer dl.Unlock()
+
+	if prev, ok := dl.entries[key]; ok && (prev.IsZero() || !until.IsZero() && prev.After(until)) {
+		return nil
+	}
+
+	dl.entries[key] = until
+
+	if !until.IsZero() {
+		dl.clock.AfterFunc(until.Sub(dl.clock.Now()), func() {
+			dl.Lock()
+			defer dl.Unlock()
+
+			if dl.entries[key].Equal(until) {
+				delete(dl.entries, key)
+			}
+		})
+	}
+
+	return nil
+}
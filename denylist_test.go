@@ -0,0 +1,104 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestDenyList(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	clock := introspectiontest.NewClock(now)
+
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.PostFormValue("token") == "with-jti" {
+			w.Write([]byte(`{"active": true, "jti": "abc", "exp": 1500000060}`))
+			return
+		}
+
+		w.Write([]byte(`{"active": true}`))
+	}))
+	defer ts.Close()
+
+	list := intro.NewInMemoryDenyList(intro.CacheClock(clock))
+
+	var res *intro.Result
+	h := intro.Introspection(ts.URL, intro.WithDenyList(list), intro.WithCache(intro.NewInMemoryCache(intro.CacheClock(clock)), time.Hour), intro.WithClock(clock), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, _ = intro.FromContext(r.Context())
+	}))
+
+	t.Run("JTI", func(t *testing.T) {
+		calls = 0
+
+		equals(t, http.StatusOK, serveStatus(h, "with-jti"))
+		equals(t, 1, calls)
+
+		ok(t, intro.DenyToken(context.Background(), list, "with-jti", res))
+
+		equals(t, http.StatusUnauthorized, serveStatus(h, "with-jti"))
+		equals(t, 1, calls)
+
+		_, err := intro.FromContext(introspectedContextAt(t, ts.URL, intro.WithDenyList(list), intro.WithClock(clock)))
+		ok(t, err)
+
+		// the entry expires along with the token
+		clock.Advance(time.Minute)
+		denied, err := list.Contains(context.Background(), "abc")
+		ok(t, err)
+		assert(t, !denied, "the entry should have expired")
+	})
+
+	t.Run("Token Hash", func(t *testing.T) {
+		calls = 0
+
+		equals(t, http.StatusOK, serveStatus(h, "without-jti"))
+		equals(t, 1, calls)
+
+		ok(t, intro.DenyToken(context.Background(), list, "without-jti", res))
+
+		equals(t, http.StatusUnauthorized, serveStatus(h, "without-jti"))
+		equals(t, http.StatusOK, serveStatus(h, "other"))
+		equals(t, 2, calls)
+
+		clock.Advance(24 * time.Hour)
+		equals(t, http.StatusUnauthorized, serveStatus(h, "without-jti"))
+	})
+}
+
+type failingDenyList struct{ err error }
+
+func (l failingDenyList) Contains(context.Context, string) (bool, error) { return false, l.err }
+
+func (l failingDenyList) Add(context.Context, string, time.Time) error { return l.err }
+
+func TestDenyListError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the introspection endpoint should not be called")
+	}))
+	defer ts.Close()
+
+	errUnavailable := errors.New("deny list unavailable")
+
+	_, err := intro.FromContext(introspectedContextAt(t, ts.URL, intro.WithDenyList(failingDenyList{errUnavailable})))
+
+	equals(t, errUnavailable, err)
+}
+
+func TestDenyListKey(t *testing.T) {
+	res := &intro.Result{Optionals: map[string]json.RawMessage{"jti": json.RawMessage(`"abc"`)}}
+
+	equals(t, "abc", intro.DenyListKey("token", res))
+	equals(t, intro.DenyListKey("token", nil), intro.DenyListKey("token", &intro.Result{}))
+	assert(t, intro.DenyListKey("token", nil) != intro.DenyListKey("other", nil), "keys of different tokens should differ")
+}
@@ -0,0 +1,105 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultEndpointCooldown is how long a failed endpoint is demoted unless EndpointPolicy.Cooldown is set
+const defaultEndpointCooldown = 30 * time.Second
+
+// errNoEndpoints is returned by an endpoint pool without endpoints
+var errNoEndpoints = errors.New("introspection: endpoint pool is empty")
+
+// EndpointPolicy configures WithEndpointPool
+type EndpointPolicy struct {
+	// Cooldown is how long an endpoint is demoted after it failed, defaults to 30 seconds. The next introspection after
+	// that probes it again in its configured place.
+	Cooldown time.Duration
+}
+
+// WithEndpointPool introspects tokens against endpoints, replicas of the same authorization server, instead of the endpoint
+// the middleware was created with, which is then only used to recognise nested middlewares. Endpoints are tried in order until
+// one answers. An endpoint that fails, e.g. with a network error or an unexpected status, is demoted for the policy's cooldown
+// and the next one is tried, demoted endpoints are only tried when the others failed too, least recently failed first.
+// An answer, even for an inactive token, is authoritative and ends the attempt. Cancelled requests demote no endpoint.
+func WithEndpointPool(endpoints []string, policy EndpointPolicy) Option {
+	endpoints = append([]string(nil), endpoints...)
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = defaultEndpointCooldown
+	}
+
+	return func(opt *Options) {
+		opt.endpointPool = &endpointPool{endpoints: endpoints, policy: policy, failedAt: make([]time.Time, len(endpoints))}
+	}
+}
+
+// endpointPool tracks the health of the endpoints of WithEndpointPool
+type endpointPool struct {
+	endpoints []string
+	policy    EndpointPolicy
+
+	clock Clock
+
+	mu sync.Mutex
+	// failedAt holds when each endpoint last failed, zero while it is healthy
+	failedAt []time.Time
+}
+
+// order returns the indices of the endpoints in the order they should be tried
+func (p *endpointPool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.clock.Now()
+
+	healthy := make([]int, 0, len(p.endpoints))
+	var demoted []int
+	for i, at := range p.failedAt {
+		if at.IsZero() || !now.Before(at.Add(p.policy.Cooldown)) {
+			healthy = append(healthy, i)
+		} else {
+			demoted = append(demoted, i)
+		}
+	}
+
+	sort.SliceStable(demoted, func(a, b int) bool { return p.failedAt[demoted[a]].Before(p.failedAt[demoted[b]]) })
+
+	return append(healthy, demoted...)
+}
+
+func (p *endpointPool) mark(i int, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if failed {
+		p.failedAt[i] = p.clock.Now()
+	} else {
+		p.failedAt[i] = time.Time{}
+	}
+}
+
+// do calls introspect with the endpoints in order until one answers, returning the last error if none does
+func (p *endpointPool) do(ctx context.Context, introspect func(endpoint string) (*Result, error)) (*Result, error) {
+	err := errNoEndpoints
+
+	for _, i := range p.order() {
+		var res *Result
+		res, err = introspect(p.endpoints[i])
+
+		switch {
+		case err == nil || err == errNotModified:
+			p.mark(i, false)
+			return res, err
+		case ctx.Err() != nil:
+			return nil, err
+		}
+
+		p.mark(i, true)
+	}
+
+	return nil, err
+}
@@ -0,0 +1,115 @@
+package introspection_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+// replica is an introspection endpoint that can be made to fail
+type replica struct {
+	*httptest.Server
+
+	calls   int
+	failing bool
+}
+
+func newReplica(active bool) *replica {
+	r := &replica{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.calls++
+
+		if r.failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		if active {
+			w.Write([]byte(`{"active": true}`))
+		} else {
+			w.Write([]byte(`{"active": false}`))
+		}
+	}))
+
+	return r
+}
+
+func TestEndpointPool(t *testing.T) {
+	primary, secondary := newReplica(true), newReplica(true)
+	defer primary.Close()
+	defer secondary.Close()
+
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	h := intro.Introspection("pool", intro.WithEndpointPool([]string{primary.URL, secondary.URL}, intro.EndpointPolicy{Cooldown: time.Minute}), intro.WithClock(clock), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	calls := func() []int { return []int{primary.calls, secondary.calls} }
+
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{1, 0}, calls())
+
+	// failover
+	primary.failing = true
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{2, 1}, calls())
+
+	// the demoted primary is skipped
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{2, 2}, calls())
+
+	// once the cooldown elapsed the primary is probed, and demoted again while it fails
+	clock.Advance(time.Minute)
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{3, 3}, calls())
+
+	// recovery
+	primary.failing = false
+	clock.Advance(time.Minute)
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{4, 3}, calls())
+
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{5, 3}, calls())
+}
+
+func TestEndpointPoolAllFailing(t *testing.T) {
+	primary, secondary := newReplica(true), newReplica(true)
+	defer primary.Close()
+	defer secondary.Close()
+
+	primary.failing, secondary.failing = true, true
+
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	h := intro.Introspection("pool", intro.WithEndpointPool([]string{primary.URL, secondary.URL}, intro.EndpointPolicy{}), intro.WithClock(clock), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	equals(t, http.StatusServiceUnavailable, serveStatus(h, "token"))
+	equals(t, []int{1, 1}, []int{primary.calls, secondary.calls})
+
+	// demoted endpoints are still tried, the least recently failed first
+	clock.Advance(time.Second)
+	secondary.failing = false
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{2, 2}, []int{primary.calls, secondary.calls})
+
+	// the recovered secondary is now preferred over the demoted primary
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, []int{2, 3}, []int{primary.calls, secondary.calls})
+}
+
+func TestEndpointPoolInactiveIsAuthoritative(t *testing.T) {
+	primary, secondary := newReplica(false), newReplica(true)
+	defer primary.Close()
+	defer secondary.Close()
+
+	h := intro.Introspection("pool", intro.WithEndpointPool([]string{primary.URL, secondary.URL}, intro.EndpointPolicy{}), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	equals(t, http.StatusUnauthorized, serveStatus(h, "token"))
+	equals(t, http.StatusUnauthorized, serveStatus(h, "token"))
+	equals(t, []int{2, 0}, []int{primary.calls, secondary.calls})
+}
@@ -0,0 +1,166 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/status"
+)
+
+// WithEnforcement makes the middleware reject requests itself instead of always calling the next handler.
+// Requests without a token or with an inactive token get a 401, malformed ones a 400, along with a WWW-Authenticate header as per rfc6750.
+// Requests whose token could not be introspected, e.g. because the introspection endpoint is unreachable or failing, get a 503
+// without a challenge, so that clients keep their tokens.
+func WithEnforcement() Option {
+	return func(opt *Options) {
+		opt.enforce = true
+	}
+}
+
+// enforcementError returns the reason why the request should be rejected, if any
+func (r *result) enforcementError() error {
+	if r.denied {
+		return &authorizationError{err: r.Err}
+	}
+
+	if r.Err != nil {
+		return r.Err
+	}
+
+	if !r.Result.Active {
+		return ErrInactive
+	}
+
+	return r.actorError()
+}
+
+// quotedStringEscaper escapes a value for an auth-param quoted-string, see rfc9110 section 5.6.4
+var quotedStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// insufficientScope is ErrInsufficientScope as returned by the checks of the scope requirements, along with the scopes they
+// require for the challenge
+type insufficientScope struct {
+	scopes []string
+}
+
+func (e *insufficientScope) Error() string {
+	return ErrInsufficientScope.Error()
+}
+
+// challengeScopes unwraps an insufficientScope into its scopes and ErrInsufficientScope, other errors are returned as is
+func challengeScopes(err error) ([]string, error) {
+	if e, ok := err.(*insufficientScope); ok {
+		return e.scopes, ErrInsufficientScope
+	}
+
+	return nil, err
+}
+
+// errorStatus maps an error to the HTTP status code and the rfc6750 error code that should be used to reject a request
+func errorStatus(err error) (int, string) {
+	if e, ok := err.(*authorizationError); ok {
+		return e.status()
+	}
+
+	if introspectionFailure(err) {
+		return http.StatusServiceUnavailable, ""
+	}
+
+	switch err {
+	case ErrNoBearer:
+		return http.StatusUnauthorized, ""
+	case ErrTokenTooLarge, ErrAmbiguousBearer:
+		return http.StatusBadRequest, "invalid_request"
+	case ErrInsufficientScope, ErrPermissionDenied:
+		return http.StatusForbidden, "insufficient_scope"
+	default:
+		return http.StatusUnauthorized, "invalid_token"
+	}
+}
+
+// malformedResponseError is returned for introspection responses that can't be decoded
+type malformedResponseError struct {
+	err error
+}
+
+func (e *malformedResponseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *malformedResponseError) Unwrap() error {
+	return e.err
+}
+
+// introspectionFailure reports whether err tells that the token could not be introspected rather than that it was rejected
+func introspectionFailure(err error) bool {
+	switch err {
+	case ErrResponseTooLarge, ErrNoContent, ErrIntrospectionDeadline, context.DeadlineExceeded, context.Canceled:
+		return true
+	}
+
+	var (
+		statusErr  *StatusError
+		asErr      *ASError
+		overloaded *OverloadedError
+		malformed  *malformedResponseError
+		netErr     net.Error
+		syntaxErr  *json.SyntaxError
+	)
+
+	switch {
+	case errors.As(err, &statusErr), errors.As(err, &asErr), errors.As(err, &overloaded), errors.As(err, &malformed),
+		errors.As(err, &netErr), errors.As(err, &syntaxErr):
+		return true
+	}
+
+	// failures of a gRPC Introspector
+	_, isStatus := status.FromError(err)
+	return isStatus
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+	writeChallenge(w, status, "WWW-Authenticate", code, nil)
+}
+
+// writeScopeError is writeError for a request lacking scopes, which the challenge lists in its scope parameter as per rfc6750
+// section 3
+func writeScopeError(w http.ResponseWriter, scopes []string) {
+	status, code := errorStatus(ErrInsufficientScope)
+	writeChallenge(w, status, "WWW-Authenticate", code, scopes)
+}
+
+// writeProxyError is writeError for a proxy, see WithProxyAuthorization. 401 becomes 407 with a Proxy-Authenticate challenge,
+// which lists scopes like writeScopeError does.
+func writeProxyError(w http.ResponseWriter, err error, scopes []string) {
+	status, code := errorStatus(err)
+	if status == http.StatusUnauthorized {
+		status = http.StatusProxyAuthRequired
+	}
+
+	writeChallenge(w, status, "Proxy-Authenticate", code, scopes)
+}
+
+func writeChallenge(w http.ResponseWriter, status int, header, code string, scopes []string) {
+	if code == "" && status != http.StatusUnauthorized && status != http.StatusProxyAuthRequired {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	challenge := "Bearer"
+	if code != "" {
+		challenge += fmt.Sprintf(` error="%s"`, code)
+	}
+
+	if len(scopes) > 0 {
+		challenge += fmt.Sprintf(`, scope="%s"`, quotedStringEscaper.Replace(strings.Join(scopes, " ")))
+	}
+
+	w.Header().Set(header, challenge)
+	http.Error(w, http.StatusText(status), status)
+}
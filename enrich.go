@@ -0,0 +1,71 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type enricher struct {
+	enrich func(context.Context, *Result) error
+	cached bool
+}
+
+// WithEnricher registers a function that augments active results, e.g. by adding roles looked up by sub to Optionals.
+// It runs once per introspection call, before the result is cached, so the enrichment is cached along with the result and
+// served from the cache afterwards. Results validated locally by the JWT validator are not enriched.
+// A non nil error fails the request like a validator error does, it is not remembered by WithErrorCacheTTL.
+// Enrichers run in the order they were added, before validators.
+func WithEnricher(enrich func(ctx context.Context, res *Result) error) Option {
+	return func(opt *Options) {
+		opt.enrichers = append(opt.enrichers, enricher{enrich: enrich, cached: true})
+	}
+}
+
+// WithUncachedEnricher is WithEnricher for enrichment that must not be cached, e.g. because its source changes more often than
+// tokens are cached. It runs on every request, whether the result is fresh or served from the cache, on a copy of the result.
+func WithUncachedEnricher(enrich func(ctx context.Context, res *Result) error) Option {
+	return func(opt *Options) {
+		opt.enrichers = append(opt.enrichers, enricher{enrich: enrich})
+	}
+}
+
+// enrichResult runs the enrichers whose cached field equals cached on res, if it is active
+func enrichResult(ctx context.Context, res *Result, cached bool, opt *Options) error {
+	if !res.Active {
+		return nil
+	}
+
+	for _, e := range opt.enrichers {
+		if e.cached != cached {
+			continue
+		}
+
+		if err := e.enrich(ctx, res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasUncachedEnrichers reports whether WithUncachedEnricher was used
+func hasUncachedEnrichers(opt *Options) bool {
+	for _, e := range opt.enrichers {
+		if !e.cached {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyResult returns a copy of res not sharing its Optionals, so it can be enriched without affecting a cached entry
+func copyResult(res *Result) *Result {
+	cp := *res
+	cp.Optionals = make(map[string]json.RawMessage, len(res.Optionals))
+	for k, v := range res.Optionals {
+		cp.Optionals[k] = v
+	}
+
+	return &cp
+}
@@ -0,0 +1,124 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestEnricher(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": r.PostFormValue("token") != "inactive", "sub": "alice"})
+	}))
+	defer ts.Close()
+
+	roles := map[string]string{"alice": `["admin"]`}
+	lookups, uncachedLookups := 0, 0
+
+	errLookup := errors.New("role lookup failed")
+
+	h := intro.Introspection(ts.URL,
+		intro.WithCache(intro.NewInMemoryCache(), time.Minute),
+		intro.WithEnricher(func(ctx context.Context, res *intro.Result) error {
+			lookups++
+
+			var sub string
+			if err := json.Unmarshal(res.Optionals["sub"], &sub); err != nil {
+				return err
+			}
+
+			if sub == "" {
+				return errLookup
+			}
+
+			res.Optionals["roles"] = json.RawMessage(roles[sub])
+			return nil
+		}),
+		intro.WithUncachedEnricher(func(ctx context.Context, res *intro.Result) error {
+			uncachedLookups++
+
+			res.Optionals["request_id"] = json.RawMessage(`"` + ctx.Value(requestIDKey{}).(string) + `"`)
+			return nil
+		}),
+	)
+
+	serve := func(token, requestID string) (*intro.Result, error) {
+		var (
+			res *intro.Result
+			err error
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, requestID))
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err = intro.FromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res, err
+	}
+
+	res, err := serve("token", "1")
+	ok(t, err)
+	equals(t, json.RawMessage(`["admin"]`), res.Optionals["roles"])
+	equals(t, json.RawMessage(`"1"`), res.Optionals["request_id"])
+
+	res, err = serve("token", "2")
+	ok(t, err)
+	assert(t, res.FromCache, "second request should be served from the cache")
+	equals(t, json.RawMessage(`["admin"]`), res.Optionals["roles"])
+	equals(t, json.RawMessage(`"2"`), res.Optionals["request_id"])
+
+	equals(t, 1, calls)
+	equals(t, 1, lookups)
+	equals(t, 2, uncachedLookups)
+
+	res, err = serve("inactive", "3")
+	ok(t, err)
+	assert(t, !res.Active, "token should be inactive")
+	_, enriched := res.Optionals["roles"]
+	assert(t, !enriched, "inactive results should not be enriched")
+	equals(t, 1, lookups)
+}
+
+func TestEnricherError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	errLookup := errors.New("role lookup failed")
+
+	cache := intro.NewInMemoryCache()
+	h := intro.Introspection(ts.URL,
+		intro.WithCache(cache, time.Minute),
+		intro.WithEnricher(func(ctx context.Context, res *intro.Result) error {
+			return errLookup
+		}),
+	)
+
+	var err error
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err = intro.FromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, errLookup, err)
+	assert(t, cache.Get("token") == nil, "results failing enrichment should not be cached")
+}
+
+type requestIDKey struct{}
@@ -0,0 +1,144 @@
+package introspection
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Outcome classifies the introspection outcome of a request
+type Outcome int
+
+const (
+	// OutcomeActive is a request with an active token
+	OutcomeActive Outcome = iota + 1
+	// OutcomeInactive is a request with an inactive token
+	OutcomeInactive
+	// OutcomeNoToken is a request that carried no token
+	OutcomeNoToken
+	// OutcomeError is a request whose token was rejected locally or failed introspection or validation
+	OutcomeError
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeActive:
+		return "active"
+	case OutcomeInactive:
+		return "inactive"
+	case OutcomeNoToken:
+		return "no_token"
+	case OutcomeError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// DecisionEvent is a compact record of the authorization decision for a single request, see WithEventStream.
+// It never holds the token nor the error, whose message may quote responses of the authorization server.
+type DecisionEvent struct {
+	Time time.Time
+	// TokenFingerprint identifies the token without revealing it, it is empty when the request carried no usable token
+	TokenFingerprint string
+	Subject          string
+	ClientID         string
+	Outcome          Outcome
+	// Latency is the time spent obtaining the introspection result, including cache lookups
+	Latency time.Duration
+	Method  string
+	Path    string
+	// ShadowDenied is set when the request would have been rejected, see WithShadowMode
+	ShadowDenied bool
+}
+
+// DropPolicy decides which event is dropped when the channel of an EventStream is full
+type DropPolicy int
+
+const (
+	// DropNewest drops the event being published
+	DropNewest DropPolicy = iota
+	// DropOldest takes the oldest event out of the channel to make room for the one being published
+	DropOldest
+)
+
+// EventStream publishes a DecisionEvent per request to a channel without ever blocking the request, see WithEventStream
+type EventStream struct {
+	ch      chan DecisionEvent
+	policy  DropPolicy
+	dropped uint64
+}
+
+// NewEventStream returns an EventStream publishing to ch, dropping events according to policy when ch is full.
+// ch should be buffered and drained by a single consumer, such as an audit log shipper.
+func NewEventStream(ch chan DecisionEvent, policy DropPolicy) *EventStream {
+	return &EventStream{ch: ch, policy: policy}
+}
+
+// Dropped returns the number of events dropped so far because the channel was full
+func (s *EventStream) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// WithEventStream publishes a DecisionEvent to s for every request the middleware handles, once the rest of the chain has run
+func WithEventStream(s *EventStream) Option {
+	return func(opt *Options) {
+		opt.events = s
+	}
+}
+
+func (s *EventStream) publish(ev DecisionEvent) {
+	select {
+	case s.ch <- ev:
+		return
+	default:
+	}
+
+	if s.policy == DropOldest {
+		select {
+		case <-s.ch:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+
+		select {
+		case s.ch <- ev:
+			return
+		default:
+		}
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+}
+
+func newDecisionEvent(token string, res *result, latency time.Duration, method, path string, now time.Time) DecisionEvent {
+	ev := DecisionEvent{
+		Time:    now,
+		Latency: latency,
+		Method:  method,
+		Path:    path,
+	}
+
+	if token != "" {
+		ev.TokenFingerprint = fingerprint(token)
+	}
+
+	switch {
+	case res.Err == ErrNoBearer:
+		ev.Outcome = OutcomeNoToken
+	case res.Err != nil:
+		ev.Outcome = OutcomeError
+	case res.Result.Active:
+		ev.Outcome = OutcomeActive
+	default:
+		ev.Outcome = OutcomeInactive
+	}
+
+	ev.ShadowDenied = res.meta.ShadowDenial != nil
+
+	if res.Result != nil {
+		ev.Subject = res.Result.stringClaim("sub")
+		ev.ClientID = res.Result.stringClaim("client_id")
+	}
+
+	return ev
+}
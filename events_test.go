@@ -0,0 +1,121 @@
+package introspection_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func eventServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.PostFormValue("token") {
+		case "active-token":
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(`{"active": true, "sub": "alice", "client_id": "app"}`))
+		case "inactive-token":
+			w.Header().Add("Content-Type", "application/json")
+			w.Write([]byte(`{"active": false}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+}
+
+func TestEventStream(t *testing.T) {
+	ts := eventServer()
+	defer ts.Close()
+
+	now := time.Date(2024, 4, 25, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name    string
+		token   string
+		outcome intro.Outcome
+		sub     string
+		client  string
+	}{
+		{name: "Active", token: "active-token", outcome: intro.OutcomeActive, sub: "alice", client: "app"},
+		{name: "Inactive", token: "inactive-token", outcome: intro.OutcomeInactive},
+		{name: "No Token", outcome: intro.OutcomeNoToken},
+		{name: "Error", token: "failing-token", outcome: intro.OutcomeError},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan intro.DecisionEvent, 1)
+			stream := intro.NewEventStream(ch, intro.DropNewest)
+
+			called := false
+			h := intro.Introspection(ts.URL, intro.WithEventStream(stream), intro.WithClock(introspectiontest.NewClock(now)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				equals(t, 0, len(ch))
+			}))
+
+			req := httptest.NewRequest("POST", "/orders/42", nil)
+			if tc.token != "" {
+				req.Header.Add("Authorization", "Bearer "+tc.token)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert(t, called, "next should have been called")
+			equals(t, 1, len(ch))
+
+			ev := <-ch
+			equals(t, tc.outcome, ev.Outcome)
+			equals(t, tc.sub, ev.Subject)
+			equals(t, tc.client, ev.ClientID)
+			equals(t, "POST", ev.Method)
+			equals(t, "/orders/42", ev.Path)
+			equals(t, now, ev.Time)
+			equals(t, tc.token == "", ev.TokenFingerprint == "")
+			assert(t, tc.token == "" || !strings.Contains(ev.TokenFingerprint, tc.token), "event should not contain the token")
+			equals(t, uint64(0), stream.Dropped())
+		})
+	}
+}
+
+func TestEventStreamFullChannel(t *testing.T) {
+	ts := eventServer()
+	defer ts.Close()
+
+	tt := []struct {
+		name   string
+		policy intro.DropPolicy
+		kept   intro.Outcome
+	}{
+		{name: "Drop Newest", policy: intro.DropNewest, kept: intro.OutcomeActive},
+		{name: "Drop Oldest", policy: intro.DropOldest, kept: intro.OutcomeNoToken},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan intro.DecisionEvent, 1)
+			stream := intro.NewEventStream(ch, tc.policy)
+
+			h := intro.Introspection(ts.URL, intro.WithEventStream(stream))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+
+				for _, token := range []string{"active-token", "inactive-token", ""} {
+					serveStatus(h, token)
+				}
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("publishing to a full channel blocked the request")
+			}
+
+			equals(t, uint64(2), stream.Dropped())
+			equals(t, tc.kept, (<-ch).Outcome)
+		})
+	}
+}
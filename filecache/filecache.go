@@ -0,0 +1,327 @@
+// Package filecache provides an introspection.Cache persisted to a file, so that cached results survive process restarts
+package filecache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/srikrsna/oauth-introspection"
+)
+
+// defaultCompactInterval is how often the file is compacted unless CompactInterval is used
+const defaultCompactInterval = 10 * time.Minute
+
+// Option configures a Cache
+type Option func(*options)
+
+type options struct {
+	clock           introspection.Clock
+	compactInterval time.Duration
+	serializer      introspection.Serializer
+}
+
+// Clock sets the clock used to expire entries, defaults to introspection.SystemClock
+func Clock(c introspection.Clock) Option {
+	return func(opt *options) {
+		opt.clock = c
+	}
+}
+
+// CompactInterval sets how often the file is rewritten without expired and overwritten entries, defaults to ten minutes
+func CompactInterval(d time.Duration) Option {
+	return func(opt *options) {
+		opt.compactInterval = d
+	}
+}
+
+// Serializer sets how results are encoded in the file, defaults to introspection.JSONSerializer. A file written with another
+// serializer can't be read back and is discarded.
+func Serializer(s introspection.Serializer) Option {
+	return func(opt *options) {
+		opt.serializer = s
+	}
+}
+
+// Cache is an introspection.Cache kept in memory and appended to a file. Entries are keyed by a hash of the token, so tokens
+// are never written to disk, but results are, the file should be protected accordingly.
+//
+// Entries are written without syncing the file, a crash may lose the latest ones. A file that can't be read back, e.g. because
+// it was truncated or altered, is discarded and the cache starts empty.
+type Cache struct {
+	mu sync.Mutex
+
+	clock           introspection.Clock
+	compactInterval time.Duration
+	serializer      introspection.Serializer
+
+	path    string
+	f       *os.File
+	entries map[string]entry
+	// compactor is the pending compaction, nil once the cache is closed
+	compactor introspection.Timer
+}
+
+type entry struct {
+	Key     string
+	Result  *introspection.Result
+	Expires int64
+}
+
+// record is the encoding of an entry in the file. Results serialized as JSON are embedded in Result, others are held by Data.
+type record struct {
+	Key     string          `json:"k"`
+	Result  json.RawMessage `json:"r,omitempty"`
+	Data    []byte          `json:"d,omitempty"`
+	Expires int64           `json:"e"`
+}
+
+// Open returns a Cache persisted to the file at path, loading the entries it already holds. The file is created if necessary.
+func Open(path string, opts ...Option) (*Cache, error) {
+	opt := options{
+		clock:           introspection.SystemClock,
+		compactInterval: defaultCompactInterval,
+		serializer:      introspection.JSONSerializer,
+	}
+
+	for _, apply := range opts {
+		apply(&opt)
+	}
+
+	c := &Cache{
+		clock:           opt.clock,
+		compactInterval: opt.compactInterval,
+		serializer:      opt.serializer,
+		path:            path,
+		entries:         make(map[string]entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := c.load(data); err != nil {
+		// a corrupted file is discarded rather than failing, the cache only saves introspection calls
+		c.entries = make(map[string]entry)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+
+	c.compactor = c.clock.AfterFunc(c.compactInterval, c.scheduledCompact)
+
+	return c, nil
+}
+
+// Get returns the result stored for key, nil if there is none or it expired
+func (c *Cache) Get(key string) *introspection.Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[hashKey(key)]
+	if !ok || !c.clock.Now().Before(time.Unix(0, e.Expires)) {
+		return nil
+	}
+
+	return e.Result
+}
+
+// Store stores res for key until exp elapses. Write errors are ignored, the entry is then only kept in memory.
+func (c *Cache) Store(key string, res *introspection.Result, exp time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := entry{Key: hashKey(key), Result: res, Expires: c.clock.Now().Add(exp).UnixNano()}
+	c.entries[e.Key] = e
+
+	if c.f == nil {
+		return
+	}
+
+	if line, err := c.encodeEntry(e); err == nil {
+		c.f.Write(line)
+	}
+}
+
+// Close stops compaction and closes the file, the cache must not be used afterwards
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.compactor != nil {
+		c.compactor.Stop()
+		c.compactor = nil
+	}
+
+	if c.f == nil {
+		return nil
+	}
+
+	err := c.f.Close()
+	c.f = nil
+
+	return err
+}
+
+func (c *Cache) scheduledCompact() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.compactor == nil {
+		return
+	}
+
+	c.compact()
+
+	c.compactor = c.clock.AfterFunc(c.compactInterval, c.scheduledCompact)
+}
+
+// compact drops expired entries and rewrites the file with the remaining ones, replacing it atomically
+func (c *Cache) compact() error {
+	now := c.clock.Now()
+
+	var buf bytes.Buffer
+	for key, e := range c.entries {
+		if !now.Before(time.Unix(0, e.Expires)) {
+			delete(c.entries, key)
+			continue
+		}
+
+		line, err := c.encodeEntry(e)
+		if err != nil {
+			delete(c.entries, key)
+			continue
+		}
+
+		buf.Write(line)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if c.f != nil {
+		c.f.Close()
+	}
+	c.f = f
+
+	return nil
+}
+
+// load reads the entries in data, later entries for a key replace earlier ones
+func (c *Cache) load(data []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+
+	for sc.Scan() {
+		e, err := c.decodeEntry(sc.Bytes())
+		if err != nil {
+			return err
+		}
+
+		c.entries[e.Key] = e
+	}
+
+	if n := len(data); n > 0 && data[n-1] != '\n' {
+		return fmt.Errorf("filecache: truncated entry")
+	}
+
+	return sc.Err()
+}
+
+// encodeEntry encodes e as a line holding the CRC-32 of the JSON encoding of its record followed by the encoding
+func (c *Cache) encodeEntry(e entry) ([]byte, error) {
+	res, err := c.serializer.Marshal(e.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	r := record{Key: e.Key, Expires: e.Expires}
+	if json.Valid(res) {
+		r.Result = res
+	} else {
+		r.Data = res
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)), nil
+}
+
+func (c *Cache) decodeEntry(line []byte) (entry, error) {
+	var e entry
+
+	if len(line) < 10 || line[8] != ' ' {
+		return e, fmt.Errorf("filecache: malformed entry")
+	}
+
+	var sum uint32
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &sum); err != nil {
+		return e, fmt.Errorf("filecache: malformed checksum")
+	}
+
+	data := line[9:]
+	if crc32.ChecksumIEEE(data) != sum {
+		return e, fmt.Errorf("filecache: checksum mismatch")
+	}
+
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil || r.Key == "" {
+		return e, fmt.Errorf("filecache: malformed entry")
+	}
+
+	res := r.Data
+	if len(r.Result) > 0 {
+		res = r.Result
+	}
+
+	result, err := c.serializer.Unmarshal(res)
+	if err != nil || result == nil {
+		return e, fmt.Errorf("filecache: malformed entry")
+	}
+
+	return entry{Key: r.Key, Result: result, Expires: r.Expires}, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,229 @@
+package filecache_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/filecache"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func result(sub string) *introspection.Result {
+	return &introspection.Result{
+		Active:      true,
+		Optionals:   map[string]json.RawMessage{"sub": json.RawMessage(`"` + sub + `"`)},
+		RetrievedAt: time.Unix(1500000000, 0).UTC(),
+	}
+}
+
+func open(t *testing.T, path string, clock introspection.Clock) *filecache.Cache {
+	t.Helper()
+
+	c, err := filecache.Open(path, filecache.Clock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	c := open(t, path, clock)
+	c.Store("first", result("first"), time.Minute)
+	c.Store("second", result("old"), time.Minute)
+	c.Store("second", result("second"), time.Minute)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c = open(t, path, clock)
+	defer c.Close()
+
+	for _, key := range []string{"first", "second"} {
+		if got := c.Get(key); !reflect.DeepEqual(result(key), got) {
+			t.Fatalf("%s: expected %#v after restart, got %#v", key, result(key), got)
+		}
+	}
+
+	if c.Get("third") != nil {
+		t.Fatal("unknown key should be absent")
+	}
+}
+
+func TestSerializer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	c, err := filecache.Open(path, filecache.Clock(clock), filecache.Serializer(introspection.GobSerializer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Store("key", result("user"), time.Minute)
+	c.Close()
+
+	c, err = filecache.Open(path, filecache.Clock(clock), filecache.Serializer(introspection.GobSerializer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := c.Get("key"); !reflect.DeepEqual(result("user"), got) {
+		t.Fatalf("expected %#v after restart, got %#v", result("user"), got)
+	}
+	c.Close()
+
+	// a file written with another serializer is discarded
+	c = open(t, path, clock)
+	defer c.Close()
+
+	if c.Get("key") != nil {
+		t.Fatal("entries of another serializer should be discarded")
+	}
+}
+
+func TestTokensNotWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+
+	c := open(t, path, introspection.SystemClock)
+	c.Store("secret-token", result("user"), time.Minute)
+	c.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "secret-token") {
+		t.Fatal("the file should not contain tokens")
+	}
+}
+
+func TestExpiryAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	c := open(t, path, clock)
+	c.Store("short", result("short"), time.Minute)
+	c.Store("long", result("long"), time.Hour)
+	c.Close()
+
+	clock.Advance(time.Minute)
+
+	c = open(t, path, clock)
+	defer c.Close()
+
+	if c.Get("short") != nil {
+		t.Fatal("entry should have expired while the process was down")
+	}
+
+	if c.Get("long") == nil {
+		t.Fatal("live entry should survive the restart")
+	}
+
+	clock.Advance(time.Hour)
+
+	if c.Get("long") != nil {
+		t.Fatal("entry should expire after the restart")
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	c, err := filecache.Open(path, filecache.Clock(clock), filecache.CompactInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 10; i++ {
+		c.Store("key", result("user"), time.Hour)
+	}
+	c.Store("short", result("short"), time.Second)
+
+	if n := lines(t, path); n != 11 {
+		t.Fatalf("expected 11 appended entries, got %d", n)
+	}
+
+	clock.Advance(time.Minute)
+
+	if n := lines(t, path); n != 1 {
+		t.Fatalf("expected 1 entry after compaction, got %d", n)
+	}
+
+	c.Store("other", result("other"), time.Hour)
+
+	if n := lines(t, path); n != 2 {
+		t.Fatalf("expected entries to be appended to the compacted file, got %d", n)
+	}
+}
+
+func TestCorruptionRecovery(t *testing.T) {
+	tt := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{name: "Garbage", corrupt: func([]byte) []byte { return []byte("not a cache file\n") }},
+		{name: "Truncated", corrupt: func(data []byte) []byte { return data[:len(data)-10] }},
+		{name: "Flipped Byte", corrupt: func(data []byte) []byte {
+			i := strings.Index(string(data), "user")
+			data[i] = 'x'
+			return data
+		}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cache")
+			clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+			c := open(t, path, clock)
+			c.Store("key", result("user"), time.Hour)
+			c.Close()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(path, tc.corrupt(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			c = open(t, path, clock)
+			defer c.Close()
+
+			if c.Get("key") != nil {
+				t.Fatal("a corrupted file should be discarded")
+			}
+
+			c.Store("key", result("user"), time.Hour)
+			c.Close()
+
+			c = open(t, path, clock)
+			defer c.Close()
+
+			if c.Get("key") == nil {
+				t.Fatal("the cache should be usable after recovering")
+			}
+		})
+	}
+}
+
+func lines(t *testing.T, path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Count(string(data), "\n")
+}
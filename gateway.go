@@ -0,0 +1,205 @@
+package introspection
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// forwardedResultMD is the gRPC metadata key carrying a signed introspection result
+	forwardedResultMD = "x-introspection-result"
+	// forwardedResultHeader is the header grpc-gateway's default header matcher maps to forwardedResultMD
+	forwardedResultHeader = "Grpc-Metadata-X-Introspection-Result"
+)
+
+var errInvalidForwardedResult = errors.New("invalid forwarded introspection result")
+
+// WithForwardedResult enables forwarding of introspection results from a grpc-gateway to the gRPC server behind it.
+//
+// On the HTTP middleware it adds the result, signed with key, to the request passed to the next handler as a header that
+// grpc-gateway forwards as gRPC metadata. On the AuthFunc it makes the server trust such metadata instead of calling the
+// introspection endpoint again. Services calling other gRPC services can forward their results the same way with
+// ForwardResult or ForwardingUnaryClientInterceptor. Results older than maxAge, signed with a different key or issued for a different token
+// are ignored and the token is introspected as usual. Both sides must use the same key and should have reasonably synced clocks.
+func WithForwardedResult(key []byte, maxAge time.Duration) Option {
+	return func(opt *Options) {
+		opt.forwardKey = key
+		opt.forwardMaxAge = maxAge
+	}
+}
+
+type forwardedResult struct {
+	Result    *Result `json:"res"`
+	TokenHash []byte  `json:"tkn"`
+	IssuedAt  int64   `json:"iat"`
+}
+
+// forwardRequest returns a shallow copy of r carrying the signed result in the forwarded result header. Any such header sent by the client is removed.
+func forwardRequest(r *http.Request, token string, res *result, opt *Options) *http.Request {
+	if _, ok := r.Header[forwardedResultHeader]; !ok && (res.Err != nil || token == "") {
+		return r
+	}
+
+	r.Header = r.Header.Clone()
+	r.Header.Del(forwardedResultHeader)
+
+	if res.Err != nil || token == "" {
+		return r
+	}
+
+	payload, err := signResult(res.Result, token, opt.clock.Now(), opt.forwardKey)
+	if err != nil {
+		return r
+	}
+
+	r.Header.Set(forwardedResultHeader, payload)
+
+	return r
+}
+
+// ForwardResult returns ctx with the introspection result of the request or call it belongs to added to its outgoing gRPC
+// metadata, signed with key, so that a downstream server whose AuthFunc uses WithForwardedResult with the same key trusts it
+// instead of introspecting the token again. The token is relayed as the authorization metadata unless ctx already carries one.
+// ctx is returned as is when no result was obtained for it.
+func ForwardResult(ctx context.Context, key []byte) context.Context {
+	res, ok := ctx.Value(resKey).(*result)
+	if !ok || res.Err != nil || res.Result == nil || res.token == "" {
+		return ctx
+	}
+
+	clock := res.clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	payload, err := signResult(res.Result, res.token, clock.Now(), key)
+	if err != nil {
+		return ctx
+	}
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(forwardedResultMD, payload)
+	if len(md.Get("authorization")) == 0 {
+		md.Set("authorization", "Bearer "+res.token)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// ForwardingUnaryClientInterceptor returns an interceptor applying ForwardResult with key to every unary call
+func ForwardingUnaryClientInterceptor(key []byte) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(ForwardResult(ctx, key), method, req, reply, cc, opts...)
+	}
+}
+
+// ForwardingStreamClientInterceptor returns an interceptor applying ForwardResult with key to every streaming call
+func ForwardingStreamClientInterceptor(key []byte) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(ForwardResult(ctx, key), desc, cc, method, opts...)
+	}
+}
+
+// checkForwarded applies the checks of opt to res, a result forwarded for token, as it would to a result it looked up itself.
+// The service that forwarded it may check results less strictly.
+func checkForwarded(ctx context.Context, token string, res *Result, opt *Options) *result {
+	meta := Meta{Source: SourceForwarded}
+
+	err := checkDenyList(ctx, token, nil, opt)
+	if err == nil {
+		res, err = checkResult(ctx, token, res, SourceForwarded, opt)
+	}
+
+	if err != nil {
+		return &result{Err: err, token: token, endpoint: opt.endpoint, meta: meta, clock: opt.clock, clockSkew: opt.clockSkew}
+	}
+
+	return deriveMetadata(&result{Result: res, token: token, endpoint: opt.endpoint, meta: meta, clock: opt.clock, clockSkew: opt.clockSkew}, opt)
+}
+
+// forwardedResultFromMD returns the forwarded result present in the incoming metadata if it is valid for token
+func forwardedResultFromMD(md metadata.MD, token string, opt *Options) (*Result, bool) {
+	vals := md.Get(forwardedResultMD)
+	if len(vals) != 1 {
+		return nil, false
+	}
+
+	res, err := verifyResult(vals[0], token, opt.clock.Now(), opt.forwardKey, opt.forwardMaxAge)
+	if err != nil {
+		return nil, false
+	}
+
+	return res, true
+}
+
+func signResult(res *Result, token string, now time.Time, key []byte) (string, error) {
+	data, err := json.Marshal(forwardedResult{
+		Result:    res,
+		TokenHash: hashToken(token),
+		IssuedAt:  now.UnixNano(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(sign(payload, key)), nil
+}
+
+func verifyResult(v, token string, now time.Time, key []byte, maxAge time.Duration) (*Result, error) {
+	i := strings.IndexByte(v, '.')
+	if i < 0 {
+		return nil, errInvalidForwardedResult
+	}
+
+	payload, sig := v[:i], v[i+1:]
+
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, sign(payload, key)) {
+		return nil, errInvalidForwardedResult
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidForwardedResult
+	}
+
+	var fr forwardedResult
+	if err := json.Unmarshal(data, &fr); err != nil || fr.Result == nil {
+		return nil, errInvalidForwardedResult
+	}
+
+	if !bytes.Equal(fr.TokenHash, hashToken(token)) {
+		return nil, errInvalidForwardedResult
+	}
+
+	if age := now.Sub(time.Unix(0, fr.IssuedAt)); age > maxAge || age < -maxAge {
+		return nil, errInvalidForwardedResult
+	}
+
+	return fr.Result, nil
+}
+
+func sign(payload string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -1,5 +1,17 @@
 module github.com/srikrsna/oauth-introspection
 
-go 1.7
+go 1.18
 
-require github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
+require (
+	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da
+	github.com/golang/protobuf v1.3.3
+	github.com/grpc-ecosystem/go-grpc-middleware v1.3.0
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974
+	google.golang.org/grpc v1.29.1
+)
+
+require (
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f // indirect
+	golang.org/x/text v0.3.3 // indirect
+	google.golang.org/genproto v0.0.0-20200423170343-7949de9c1215 // indirect
+)
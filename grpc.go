@@ -2,8 +2,12 @@ package introspection
 
 import (
 	"context"
+	"net/http"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // AuthFunc ...
@@ -11,13 +15,73 @@ func AuthFunc(endpoint string, opts ...Option) grpc_auth.AuthFunc {
 	opt := makeOptions(endpoint, opts)
 
 	return grpc_auth.AuthFunc(func(ctx context.Context) (context.Context, error) {
-		token, err := grpc_auth.AuthFromMD(ctx, "bearer")
+		token, err := getTokenFromMD(ctx, &opt)
 		if err != nil {
-			return context.WithValue(ctx, resKey, &result{Err: ErrNoBearer}), nil
+			return withResult(ctx, &opt, &result{Err: err})
 		}
 
-		res, err := introspectionResult(token, opt)
+		if opt.forwardKey != nil {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if res, ok := forwardedResultFromMD(md, token, &opt); ok {
+				useScopeOptions(res, &opt)
+				return withResult(ctx, &opt, checkForwarded(ctx, token, res, &opt))
+			}
+		}
+
+		res := resolve(ctx, token, &opt)
+		if opt.actorHeader != "" {
+			resolveActor(ctx, actorMDValues(ctx, &opt), res, &opt)
+		}
 
-		return context.WithValue(ctx, resKey, &result{res, err}), nil
+		return withResult(ctx, &opt, res)
 	})
 }
+
+func getTokenFromMD(ctx context.Context, opt *Options) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	token, err := bearerToken(md.Get("authorization"), opt)
+	if err == ErrNoBearer && opt.basicUsername != nil {
+		token, err = basicPasswordToken(md.Get("authorization"), opt)
+	} else if err == nil && opt.rejectMultipleTokens && hasBasicPasswordToken(md.Get("authorization"), opt) {
+		return "", ErrAmbiguousBearer
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return checkToken(ctx, token, opt)
+}
+
+func withResult(ctx context.Context, opt *Options, res *result) (context.Context, error) {
+	if len(opt.grpcAuthorizers) > 0 {
+		res = authorizeCall(ctx, res, opt)
+	}
+
+	if opt.shadow {
+		res.shadowHooks = &opt.hooks
+	}
+
+	if opt.enforce || opt.shadow {
+		if err := res.enforcementError(); err != nil && !res.shadowDeny(ctx, err) {
+			return nil, status.Error(grpcCode(err), err.Error())
+		}
+	}
+
+	return context.WithValue(ctx, resKey, res), nil
+}
+
+// grpcCode maps an error to the gRPC status code that should be used to reject a call
+func grpcCode(err error) codes.Code {
+	switch code, _ := errorStatus(err); code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Unauthenticated
+	}
+}
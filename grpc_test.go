@@ -0,0 +1,464 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestAuthFuncMaxTokenLength(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	bearer := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	t.Run("Just Under", func(t *testing.T) {
+		hits = 0
+
+		ctx, err := intro.AuthFunc(ts.URL)(bearer(strings.Repeat("a", 4096)))
+		ok(t, err)
+
+		res, err := intro.FromContext(ctx)
+		ok(t, err)
+
+		equals(t, true, res.Active)
+		equals(t, 1, hits)
+	})
+
+	t.Run("Just Over", func(t *testing.T) {
+		hits = 0
+
+		ctx, err := intro.AuthFunc(ts.URL)(bearer(strings.Repeat("a", 4097)))
+		ok(t, err)
+
+		_, err = intro.FromContext(ctx)
+
+		equals(t, intro.ErrTokenTooLarge, err)
+		equals(t, 0, hits)
+	})
+
+	t.Run("Absurdly Large Enforced", func(t *testing.T) {
+		hits = 0
+
+		_, err := intro.AuthFunc(ts.URL, intro.WithEnforcement())(bearer(strings.Repeat("a", 1<<20)))
+
+		equals(t, codes.InvalidArgument, status.Code(err))
+		equals(t, 0, hits)
+	})
+}
+
+func TestAuthFuncMultipleAuthorizationValues(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	tt := []struct {
+		name    string
+		values  []string
+		options []intro.Option
+		token   string
+		err     error
+	}{
+		{name: "Bearer First", values: []string{"Bearer token", "Basic bWVzaDppZA=="}, token: "token"},
+		{name: "Bearer Second", values: []string{"Basic bWVzaDppZA==", "bearer token"}, token: "token"},
+		{name: "Two Bearers", values: []string{"Bearer first", "Bearer second"}, err: intro.ErrAmbiguousBearer},
+		{name: "Same Bearer Twice", values: []string{"Bearer token", "Bearer token"}, token: "token"},
+		{name: "Same Bearer Twice Rejected", values: []string{"Bearer token", "Bearer token"}, options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Two Bearers Rejected", values: []string{"Bearer first", "Bearer second"}, options: []intro.Option{intro.WithRejectAmbiguousBearer()}, err: intro.ErrAmbiguousBearer},
+		{name: "No Bearer", values: []string{"Basic bWVzaDppZA==", "Mesh identity"}, err: intro.ErrNoBearer},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			md := metadata.MD{"authorization": tc.values}
+
+			ctx, err := intro.AuthFunc(ts.URL, tc.options...)(metadata.NewIncomingContext(context.Background(), md))
+			ok(t, err)
+
+			res, err := intro.FromContext(ctx)
+
+			equals(t, tc.err, err)
+
+			if err == nil {
+				equals(t, `"`+tc.token+`"`, string(res.Optionals["token"]))
+			}
+		})
+	}
+}
+
+func TestForwardedResult(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+			"sub":    "user",
+		})
+	}))
+	defer ts.Close()
+
+	key := []byte("shared-secret")
+
+	// gateway introspects the request and returns the metadata grpc-gateway would forward to the gRPC server
+	gateway := func(t *testing.T, token string, header http.Header, opts ...intro.Option) metadata.MD {
+		var md metadata.MD
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			md = metadata.MD{}
+			for k, v := range r.Header {
+				switch {
+				case k == "Authorization":
+					md.Append("authorization", v...)
+				case strings.HasPrefix(k, "Grpc-Metadata-"):
+					md.Append(strings.TrimPrefix(k, "Grpc-Metadata-"), v...)
+				}
+			}
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return md
+	}
+
+	backend := func(t *testing.T, md metadata.MD, opts ...intro.Option) *intro.Result {
+		ctx, err := intro.AuthFunc(ts.URL, opts...)(metadata.NewIncomingContext(context.Background(), md))
+		ok(t, err)
+
+		res, err := intro.FromContext(ctx)
+		ok(t, err)
+
+		return res
+	}
+
+	t.Run("Forwarded", func(t *testing.T) {
+		hits = 0
+
+		md := gateway(t, "token", nil, intro.WithForwardedResult(key, time.Minute))
+		res := backend(t, md, intro.WithForwardedResult(key, time.Minute))
+
+		equals(t, 1, hits)
+		equals(t, true, res.Active)
+		equals(t, `"user"`, string(res.Optionals["sub"]))
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		hits = 0
+
+		md := gateway(t, "token", nil, intro.WithForwardedResult(key, time.Minute))
+
+		v := md.Get("x-introspection-result")[0]
+		md.Set("x-introspection-result", "x"+v[1:])
+
+		res := backend(t, md, intro.WithForwardedResult(key, time.Minute))
+
+		equals(t, 2, hits)
+		equals(t, true, res.Active)
+	})
+
+	t.Run("Wrong Key", func(t *testing.T) {
+		hits = 0
+
+		md := gateway(t, "token", nil, intro.WithForwardedResult([]byte("forged"), time.Minute))
+		backend(t, md, intro.WithForwardedResult(key, time.Minute))
+
+		equals(t, 2, hits)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		hits = 0
+
+		clock := introspectiontest.NewClock(time.Now())
+
+		md := gateway(t, "token", nil, intro.WithForwardedResult(key, time.Minute), intro.WithClock(clock))
+
+		clock.Advance(time.Minute)
+
+		backend(t, md, intro.WithForwardedResult(key, time.Minute), intro.WithClock(clock))
+
+		equals(t, 1, hits)
+
+		clock.Advance(time.Millisecond)
+
+		backend(t, md, intro.WithForwardedResult(key, time.Minute), intro.WithClock(clock))
+
+		equals(t, 2, hits)
+	})
+
+	t.Run("Clock Skewed", func(t *testing.T) {
+		hits = 0
+
+		clock := introspectiontest.NewClock(time.Now())
+
+		md := gateway(t, "token", nil, intro.WithForwardedResult(key, time.Minute), intro.WithClock(clock))
+
+		backend(t, md, intro.WithForwardedResult(key, time.Minute), intro.WithClock(introspectiontest.NewClock(clock.Now().Add(-2*time.Minute))))
+
+		equals(t, 2, hits)
+	})
+
+	t.Run("Different Token", func(t *testing.T) {
+		hits = 0
+
+		md := gateway(t, "token", nil, intro.WithForwardedResult(key, time.Minute))
+		md.Set("authorization", "Bearer other-token")
+
+		backend(t, md, intro.WithForwardedResult(key, time.Minute))
+
+		equals(t, 2, hits)
+	})
+
+	t.Run("Client Supplied Header Removed", func(t *testing.T) {
+		hits = 0
+
+		md := gateway(t, "token", http.Header{"Grpc-Metadata-X-Introspection-Result": {"forged"}}, intro.WithForwardedResult(key, time.Minute))
+
+		vals := md.Get("x-introspection-result")
+
+		equals(t, 1, len(vals))
+		assert(t, vals[0] != "forged", "client supplied header should be replaced")
+	})
+}
+
+// fakeIntrospectionServer serves the Introspection service from introspection.proto, answering with the JSON object returned by answer
+func fakeIntrospectionServer(t *testing.T, answer func(token string) string) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "introspection.v1.Introspection",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Introspect",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				var in wrappers.StringValue
+				if err := dec(&in); err != nil {
+					return nil, err
+				}
+
+				var out structpb.Struct
+				if err := jsonpb.UnmarshalString(answer(in.Value), &out); err != nil {
+					return nil, err
+				}
+
+				return &out, nil
+			},
+		}},
+	}, struct{}{})
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	ok(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestGRPCIntrospector(t *testing.T) {
+	conn := fakeIntrospectionServer(t, func(token string) string {
+		if token == "unknown" {
+			return `{"active": false}`
+		}
+
+		return `{"active": true, "sub": "` + token + `", "exp": 32503680000}`
+	})
+
+	ir := intro.NewGRPCIntrospector(conn)
+
+	t.Run("Active", func(t *testing.T) {
+		res, err := ir.Do(context.Background(), "user")
+
+		ok(t, err)
+		equals(t, true, res.Active)
+		equals(t, json.RawMessage(`"user"`), res.Optionals["sub"])
+		equals(t, json.RawMessage(`32503680000`), res.Optionals["exp"])
+	})
+
+	t.Run("Inactive", func(t *testing.T) {
+		res, err := ir.Do(context.Background(), "unknown")
+
+		ok(t, err)
+		equals(t, false, res.Active)
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer user")
+
+		var called bool
+		intro.Introspection("grpc://introspection", intro.WithIntrospector(ir))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+
+			res, err := intro.FromContext(r.Context())
+
+			ok(t, err)
+			equals(t, true, res.Active)
+			equals(t, json.RawMessage(`"user"`), res.Optionals["sub"])
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		assert(t, called, "handler should be called")
+	})
+
+	t.Run("Invalid Response", func(t *testing.T) {
+		conn := fakeIntrospectionServer(t, func(string) string { return `{"active": true, "exp": -1}` })
+
+		_, err := intro.NewGRPCIntrospector(conn).Do(context.Background(), "user")
+
+		assert(t, err != nil, "out of range exp should be rejected")
+	})
+}
+
+func TestHTTPIntrospector(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	res, err := intro.NewHTTPIntrospector(ts.URL).Do(context.Background(), "token")
+
+	ok(t, err)
+	equals(t, true, res.Active)
+	equals(t, json.RawMessage(`"token"`), res.Optionals["token"])
+}
+
+func TestForwardResultDownstream(t *testing.T) {
+	var hits int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "user"})
+	}))
+	defer ts.Close()
+
+	key := []byte("shared-secret")
+
+	dial := func(t *testing.T, lis *bufconn.Listener, opts ...grpc.DialOption) *grpc.ClientConn {
+		conn, err := grpc.Dial("bufnet", append(opts, grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return lis.Dial()
+		}))...)
+		ok(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		return conn
+	}
+
+	rewrite := func(edit func(md metadata.MD)) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			md = md.Copy()
+			edit(md)
+
+			return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+		}
+	}
+
+	tt := []struct {
+		name string
+		// edit changes the metadata service A sends to service B
+		edit  func(md metadata.MD)
+		bOpts []intro.Option
+		hits  int32
+		code  codes.Code
+	}{
+		{name: "Forwarded", hits: 1},
+		{name: "Absent", edit: func(md metadata.MD) { delete(md, "x-introspection-result") }, hits: 2},
+		{
+			name: "Tampered",
+			edit: func(md metadata.MD) {
+				v := md.Get("x-introspection-result")[0]
+				md.Set("x-introspection-result", "x"+v[1:])
+			},
+			hits: 2,
+		},
+		{name: "Wrong Key", bOpts: []intro.Option{intro.WithForwardedResult([]byte("other-secret"), time.Minute)}, hits: 2},
+		{name: "Expired", bOpts: []intro.Option{intro.WithClock(introspectiontest.NewClock(time.Now().Add(2 * time.Minute)))}, hits: 2},
+		{name: "Different Token", edit: func(md metadata.MD) { md.Set("authorization", "Bearer other-token") }, hits: 2},
+		{name: "Stricter Downstream", bOpts: []intro.Option{intro.WithRequiredAudience("b", false)}, hits: 1, code: codes.Unauthenticated},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&hits, 0)
+
+			bOpts := append([]intro.Option{intro.WithForwardedResult(key, time.Minute), intro.WithEnforcement()}, tc.bOpts...)
+			serviceB := testGRPCServer(t, intro.AuthFunc(ts.URL, bOpts...), func(ctx context.Context, in *wrappers.StringValue) (interface{}, error) {
+				res, err := intro.FromContext(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				return &wrappers.StringValue{Value: string(res.Optionals["sub"])}, nil
+			})
+
+			interceptors := []grpc.UnaryClientInterceptor{intro.ForwardingUnaryClientInterceptor(key)}
+			if tc.edit != nil {
+				interceptors = append(interceptors, rewrite(tc.edit))
+			}
+			toB := dial(t, serviceB, grpc.WithChainUnaryInterceptor(interceptors...))
+
+			serviceA := testGRPCServer(t, intro.AuthFunc(ts.URL, intro.WithEnforcement()), func(ctx context.Context, in *wrappers.StringValue) (interface{}, error) {
+				var out wrappers.StringValue
+				err := toB.Invoke(ctx, "/test.Echo/Echo", in, &out)
+
+				return &out, err
+			})
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token")
+
+			var out wrappers.StringValue
+			err := dial(t, serviceA).Invoke(ctx, "/test.Echo/Echo", &wrappers.StringValue{Value: "ping"}, &out)
+
+			equals(t, tc.code, status.Code(err))
+			if tc.code == codes.OK {
+				equals(t, `"user"`, out.Value)
+			}
+			equals(t, tc.hits, atomic.LoadInt32(&hits))
+		})
+	}
+
+	t.Run("No Result", func(t *testing.T) {
+		ctx := intro.ForwardResult(context.Background(), key)
+
+		_, found := metadata.FromOutgoingContext(ctx)
+		assert(t, !found, "nothing should be forwarded without a result")
+	})
+}
@@ -0,0 +1,43 @@
+package introspection
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/jsonpb"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+// IntrospectMethod is the full name of the Introspect method of the Introspection service defined in introspection.proto
+const IntrospectMethod = "/introspection.v1.Introspection/Introspect"
+
+// NewGRPCIntrospector returns an Introspector calling the Introspection service defined in introspection.proto over cc.
+// The response is subject to the same checks as an HTTP introspection response.
+func NewGRPCIntrospector(cc grpc.ClientConnInterface, opts ...grpc.CallOption) Introspector {
+	return &grpcIntrospector{cc: cc, opts: opts}
+}
+
+type grpcIntrospector struct {
+	cc   grpc.ClientConnInterface
+	opts []grpc.CallOption
+}
+
+func (i *grpcIntrospector) Do(ctx context.Context, token string) (*Result, error) {
+	var out structpb.Struct
+	if err := i.cc.Invoke(ctx, IntrospectMethod, &wrappers.StringValue{Value: token}, &out, i.opts...); err != nil {
+		return nil, err
+	}
+
+	data, err := (&jsonpb.Marshaler{}).MarshalToString(&out)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := extractIntrospectResult([]byte(data))
+	if err != nil {
+		return nil, &malformedResponseError{err: err}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,57 @@
+package introspection
+
+import "context"
+
+// Hooks are callbacks invoked by the middleware on notable events, useful for metrics and logging. Nil callbacks are skipped.
+type Hooks struct {
+	// OnTokenRejected is called when a token is rejected locally without contacting the introspection endpoint, for instance because it exceeds the maximum token length.
+	OnTokenRejected func(ctx context.Context, err error)
+	// OnFieldAliasConflict is called when an introspection response has both a member named alias and one named after the
+	// standard claim name it is an alias of, see WithFieldAliases. The standard member is used.
+	OnFieldAliasConflict func(ctx context.Context, alias, name string)
+	// OnShadowDenial is called with the error a request would have been rejected with, see WithShadowMode. It may be called more
+	// than once per request, e.g. by the middleware and a requirement behind it.
+	OnShadowDenial func(ctx context.Context, err error)
+	// OnBindingMismatch is called with a *BindingMismatchError when a cached result is reused from another binding, see WithBindTo
+	OnBindingMismatch func(ctx context.Context, err error)
+	// OnCacheError is called when the cache operation op, get, store or touch, failed or panicked, see FallibleCache. key is a
+	// fingerprint of the cache key, which contains the token. The request proceeds as if the entry wasn't cached.
+	OnCacheError func(ctx context.Context, op, key string, err error)
+}
+
+// WithHooks registers callbacks for notable middleware events
+func WithHooks(h Hooks) Option {
+	return func(opt *Options) {
+		opt.hooks = h
+	}
+}
+
+func (h *Hooks) tokenRejected(ctx context.Context, err error) {
+	if h.OnTokenRejected != nil {
+		h.OnTokenRejected(ctx, err)
+	}
+}
+
+func (h *Hooks) shadowDenial(ctx context.Context, err error) {
+	if h.OnShadowDenial != nil {
+		h.OnShadowDenial(ctx, err)
+	}
+}
+
+func (h *Hooks) bindingMismatch(ctx context.Context, err error) {
+	if h.OnBindingMismatch != nil {
+		h.OnBindingMismatch(ctx, err)
+	}
+}
+
+func (h *Hooks) cacheError(ctx context.Context, op, key string, err error) {
+	if h.OnCacheError != nil {
+		h.OnCacheError(ctx, op, key, err)
+	}
+}
+
+func (h *Hooks) fieldAliasConflict(ctx context.Context, alias, name string) {
+	if h.OnFieldAliasConflict != nil {
+		h.OnFieldAliasConflict(ctx, alias, name)
+	}
+}
@@ -1,14 +1,25 @@
 package introspection
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	discoveryPath = ".well-known/openid-configuration"
+	discoveryPath        = ".well-known/openid-configuration"
+	resourceMetadataPath = ".well-known/oauth-protected-resource"
+
+	// maxTokenBodyBytes is the size of the largest request body searched for a token, longer bodies carry none
+	maxTokenBodyBytes = 1 << 20
 )
 
 var (
@@ -16,6 +27,19 @@ var (
 	ErrNoBearer = errors.New("no bearer")
 	// ErrNoMiddleware is returned by FromContext when no value was set. It is due to the middleware not being called before this function.
 	ErrNoMiddleware = errors.New("introspection middleware didn't execute")
+	// ErrNoContent is returned by FromContext when the introspection endpoint responded with 204 No Content, the spec requires a response body.
+	ErrNoContent = errors.New("introspection response has no content")
+	// ErrTokenTooLarge is returned by FromContext when the token exceeds the maximum token length. No introspection call is made for such tokens.
+	ErrTokenTooLarge = errors.New("token exceeds maximum length")
+	// ErrResponseTooLarge is returned by FromContext when the introspection response exceeds the maximum response size
+	ErrResponseTooLarge = errors.New("introspection response exceeds maximum size")
+	// ErrTokenTooShort is returned by FromContext when the token is shorter than the length set by WithMinTokenLength
+	ErrTokenTooShort = errors.New("token is too short")
+	// ErrAmbiguousBearer is returned by FromContext when the request carried conflicting Bearer credentials, or more than one token at all
+	// with WithRejectMultipleTokens or WithRejectAmbiguousBearer. No introspection call is made for such requests.
+	ErrAmbiguousBearer = errors.New("multiple bearer tokens")
+	// ErrInactive is used to reject requests with an inactive token when enforcement is enabled
+	ErrInactive = errors.New("token is not active")
 )
 
 // Introspection ...
@@ -25,17 +49,366 @@ func Introspection(endpoint string, opts ...Option) func(http.Handler) http.Hand
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			hd := r.Header.Get("Authorization")
+			r, token, err := getTokenFromRequest(r, &opt)
 
-			if !strings.HasPrefix(hd, "Bearer ") {
-				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resKey, &result{Err: ErrNoBearer})))
-				return
+			res, latency := &result{Err: err}, time.Duration(0)
+			if err == nil {
+				start := opt.clock.Now()
+				ctx := bindingContext(certificateContext(discriminatorContext(clientParamsContext(r, &opt), r, &opt), r, &opt), r, &opt)
+				res = resolve(ctx, token, &opt)
+				if opt.actorHeader != "" {
+					resolveActor(ctx, actorHeaderValues(r, &opt), res, &opt)
+				}
+				latency = opt.clock.Now().Sub(start)
+			}
+
+			if res.pooled {
+				// resolve reuses the result of an enclosing middleware, only the one that resolved it releases it
+				if prev, ok := r.Context().Value(resKey).(*result); !ok || prev != res {
+					defer releaseResult(&opt, res.Result)
+				}
+			}
+
+			if len(opt.authorizers) > 0 {
+				res = authorizeRequest(r, res, &opt)
+			}
+
+			if opt.accessLog != nil {
+				defer func() { opt.accessLog(newAccessLogEntry(token, res, latency)) }()
 			}
 
-			token := hd[len("Bearer "):]
+			if opt.events != nil {
+				method, path := r.Method, r.URL.Path
+				defer func() { opt.events.publish(newDecisionEvent(token, res, latency, method, path, opt.clock.Now())) }()
+			}
 
-			res, err := introspectionResult(token, opt)
-			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resKey, &result{res, err})))
+			serveResult(w, r, next, &opt, token, res)
 		})
 	}
 }
+
+// getTokenFromRequest extracts the token from r. The returned request is r, or a shallow copy of it carrying extraction details.
+func getTokenFromRequest(r *http.Request, opt *Options) (*http.Request, string, error) {
+	header := "Authorization"
+	if opt.proxyAuthorization {
+		header = "Proxy-Authorization"
+	}
+
+	token, err := bearerToken(r.Header[header], opt)
+	fromBody, fromBasic := false, false
+
+	if err == ErrNoBearer && opt.basicUsername != nil {
+		if token, err = basicPasswordToken(r.Header[header], opt); err == nil {
+			fromBasic = true
+		}
+	}
+
+	if err == ErrNoBearer && opt.wsProtocolPrefix != "" && isWebSocketUpgrade(r) {
+		if wsToken, protocols, ok := webSocketProtocolToken(r, opt.wsProtocolPrefix); ok {
+			r = r.WithContext(context.WithValue(r.Context(), wsProtocolsKey, protocols))
+			token, err = wsToken, nil
+		}
+	}
+
+	if err == ErrNoBearer && opt.jsonBodyTokenField != "" {
+		if bodyToken, ok := jsonBodyToken(r, opt.jsonBodyTokenField); ok {
+			token, err, fromBody = bodyToken, nil, true
+		}
+	}
+
+	if err != nil {
+		return r, "", err
+	}
+
+	if opt.rejectMultipleTokens {
+		if hasParameterToken(r) {
+			return r, "", ErrAmbiguousBearer
+		}
+
+		if !fromBasic && hasBasicPasswordToken(r.Header[header], opt) {
+			return r, "", ErrAmbiguousBearer
+		}
+
+		if opt.jsonBodyTokenField != "" && !fromBody && hasJSONBodyToken(r, opt.jsonBodyTokenField) {
+			return r, "", ErrAmbiguousBearer
+		}
+	}
+
+	token, err = checkToken(r.Context(), token, opt)
+
+	return r, token, err
+}
+
+// bearerToken returns the token of the Bearer credential among the Authorization values. Other schemes, e.g. credentials added
+// by a proxy, are skipped. Repeated Bearer credentials must carry the same token, unless strict, in which case they are rejected.
+// With WithBearerPrefixOptional a value without a scheme is taken as a Bearer credential.
+func bearerToken(values []string, opt *Options) (string, error) {
+	var token string
+	found := false
+
+	for _, v := range values {
+		var credential string
+		switch {
+		case len(v) >= len("Bearer ") && strings.EqualFold(v[:len("Bearer ")], "Bearer "):
+			credential = v[len("Bearer "):]
+		case opt.bearerPrefixOptional && isUnprefixedToken(v):
+			credential = v
+		default:
+			continue
+		}
+
+		if found {
+			if opt.rejectAmbiguousBearer || opt.rejectMultipleTokens || strings.TrimSpace(credential) != strings.TrimSpace(token) {
+				return "", ErrAmbiguousBearer
+			}
+			continue
+		}
+
+		token, found = credential, true
+	}
+
+	if !found {
+		return "", ErrNoBearer
+	}
+
+	return token, nil
+}
+
+// isUnprefixedToken reports whether the Authorization value v has no scheme, i.e. is a single word other than a bare scheme name
+func isUnprefixedToken(v string) bool {
+	v = strings.TrimSpace(v)
+	return v != "" && !strings.ContainsAny(v, " \t") && !strings.EqualFold(v, "Bearer")
+}
+
+// hasParameterToken reports whether r also carries an access_token query or form encoded body parameter, see rfc6750 section 2.
+// The body is read and replaced by an identical one. Bodies that can't be inspected, e.g. longer than maxTokenBodyBytes, are taken
+// to carry one so that a parameter can't be smuggled past the check by padding the body.
+func hasParameterToken(r *http.Request) bool {
+	if _, ok := r.URL.Query()["access_token"]; ok {
+		return true
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != "application/x-www-form-urlencoded" {
+		return false
+	}
+
+	data, ok := peekBody(r)
+	if !ok {
+		return true
+	}
+
+	form, err := url.ParseQuery(string(data))
+	if err != nil {
+		return false
+	}
+
+	_, ok = form["access_token"]
+	return ok
+}
+
+// peekBody returns the body of r, unless it is longer than maxTokenBodyBytes or can't be read. The body is replaced by one reading
+// the same bytes, whether or not it was returned.
+func peekBody(r *http.Request) ([]byte, bool) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxTokenBodyBytes+1))
+	if err != nil || len(data) > maxTokenBodyBytes {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+		return nil, false
+	}
+
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	return data, true
+}
+
+// jsonBodyToken returns the string member field of the JSON object in r's body, if r has a JSON body.
+// The body is read and replaced by an identical one.
+func jsonBodyToken(r *http.Request, field string) (string, bool) {
+	if !hasJSONBody(r) {
+		return "", false
+	}
+
+	data, ok := peekBody(r)
+	if !ok {
+		return "", false
+	}
+
+	return jsonMemberToken(data, field)
+}
+
+// hasJSONBodyToken reports whether r has a JSON body whose object has the string member field. The body is read and replaced by
+// an identical one. Bodies that can't be inspected, e.g. longer than maxTokenBodyBytes, are taken to have it so that a token
+// can't be smuggled past WithRejectMultipleTokens by padding the body.
+func hasJSONBodyToken(r *http.Request, field string) bool {
+	if !hasJSONBody(r) {
+		return false
+	}
+
+	data, ok := peekBody(r)
+	if !ok {
+		return true
+	}
+
+	_, ok = jsonMemberToken(data, field)
+	return ok
+}
+
+// hasJSONBody reports whether r has a body with an application/json or +json Content-Type
+func hasJSONBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return ct == "application/json" || strings.HasSuffix(ct, "+json")
+}
+
+// jsonMemberToken returns the string member field of the JSON object data
+func jsonMemberToken(data []byte, field string) (string, bool) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", false
+	}
+
+	var token string
+	if err := json.Unmarshal(body[field], &token); err != nil {
+		return "", false
+	}
+
+	return token, true
+}
+
+// checkToken applies the local checks every extracted token must pass before it is introspected
+func checkToken(ctx context.Context, token string, opt *Options) (string, error) {
+	if opt.maxTokenLength > 0 && len(token) > opt.maxTokenLength {
+		opt.hooks.tokenRejected(ctx, ErrTokenTooLarge)
+		return "", ErrTokenTooLarge
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrNoBearer
+	}
+
+	if len(token) < opt.minTokenLength {
+		opt.hooks.tokenRejected(ctx, ErrTokenTooShort)
+		return "", ErrTokenTooShort
+	}
+
+	return token, nil
+}
+
+// stripCredentials removes the credentials the token was read from from r's header, which it replaces by a copy.
+// Of a Sec-WebSocket-Protocol token only the entries carrying it are removed, of a JSON body token the member carrying it.
+func stripCredentials(r *http.Request, opt *Options) {
+	r.Header = r.Header.Clone()
+
+	if opt.proxyAuthorization {
+		r.Header.Del("Proxy-Authorization")
+	} else {
+		r.Header.Del("Authorization")
+	}
+
+	if p, ok := WebSocketProtocolsFromContext(r.Context()); ok {
+		r.Header.Del("Sec-Websocket-Protocol")
+		if len(p.Remaining) > 0 {
+			r.Header.Set("Sec-Websocket-Protocol", strings.Join(p.Remaining, ", "))
+		}
+	}
+
+	if opt.jsonBodyTokenField != "" {
+		stripJSONBodyToken(r, opt.jsonBodyTokenField)
+	}
+}
+
+// stripJSONBodyToken replaces r's body by one without the string member field of its JSON object, see WithJSONBodyTokenField.
+// Bodies without the member, or that can't be inspected, are left untouched.
+func stripJSONBodyToken(r *http.Request, field string) {
+	if !hasJSONBody(r) {
+		return
+	}
+
+	data, ok := peekBody(r)
+	if !ok {
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return
+	}
+
+	var token string
+	if err := json.Unmarshal(body[field], &token); err != nil {
+		return
+	}
+
+	delete(body, field)
+
+	stripped, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(stripped))
+	r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(stripped)), nil }
+	r.ContentLength = int64(len(stripped))
+	if r.Header.Get("Content-Length") != "" {
+		r.Header.Set("Content-Length", strconv.Itoa(len(stripped)))
+	}
+}
+
+func serveResult(w http.ResponseWriter, r *http.Request, next http.Handler, opt *Options, token string, res *result) {
+	if opt.retryAfterStatus != 0 {
+		if err, ok := res.Err.(*OverloadedError); ok {
+			writeRetryAfter(w, opt.retryAfterStatus, err, opt.clock.Now())
+			return
+		}
+	}
+
+	if opt.shadow {
+		res.shadowHooks = &opt.hooks
+	}
+
+	if opt.proxyAuthorization {
+		res.proxy = true
+	}
+
+	if opt.enforce || opt.shadow {
+		if err := res.enforcementError(); err != nil && !res.shadowDeny(r.Context(), err) {
+			if opt.proxyAuthorization {
+				writeProxyError(w, err, nil)
+				return
+			}
+
+			writeError(w, err)
+			return
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), resKey, res))
+
+	if opt.forwardKey != nil {
+		r = forwardRequest(r, token, res, opt)
+	}
+
+	if opt.stripAuthorization {
+		stripCredentials(r, opt)
+	}
+
+	if opt.translation != nil {
+		if err := translateToken(r, res, opt); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	next.ServeHTTP(w, r)
+}
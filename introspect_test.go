@@ -1,16 +1,28 @@
 package introspection_test
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestIntrospection(t *testing.T) {
@@ -180,91 +192,1377 @@ func TestWithCache(t *testing.T) {
 	assert(t, hits == 1, fmt.Sprintf("Cache Not Being Used Multiple Hits: %d", hits))
 }
 
+func TestWithResultValidator(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":    true,
+			"client_id": "tenant-client",
+		})
+	}))
+	defer ts.Close()
+
+	errDenied := errors.New("client denied")
+	denied := map[string]bool{}
+	var calls []string
+
+	handler := func(t *testing.T, opts ...intro.Option) func(token string) (*intro.Result, error) {
+		h := intro.Introspection(ts.URL, opts...)
+
+		return func(token string) (*intro.Result, error) {
+			var (
+				res *intro.Result
+				err error
+			)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer "+token)
+
+			h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err = intro.FromContext(r.Context())
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			return res, err
+		}
+	}
+
+	denyList := intro.WithResultValidator(func(ctx context.Context, res *intro.Result) error {
+		calls = append(calls, "deny list")
+
+		var clientID string
+		json.Unmarshal(res.Optionals["client_id"], &clientID)
+
+		if denied[clientID] {
+			return errDenied
+		}
+
+		return nil
+	})
+
+	second := intro.WithResultValidator(func(ctx context.Context, res *intro.Result) error {
+		calls = append(calls, "second")
+		return nil
+	})
+
+	t.Run("Fresh And Cached", func(t *testing.T) {
+		hits, calls, denied = 0, nil, map[string]bool{}
+
+		serve := handler(t, intro.WithCache(intro.NewInMemoryCache(), time.Minute), denyList, second)
+
+		res, err := serve("token")
+		ok(t, err)
+		equals(t, true, res.Active)
+		equals(t, []string{"deny list", "second"}, calls)
+
+		denied["tenant-client"] = true
+		calls = nil
+
+		res, err = serve("token")
+		equals(t, errDenied, err)
+		assert(t, res == nil, "response should be nil when err is non-nil")
+		equals(t, []string{"deny list"}, calls)
+
+		equals(t, 1, hits)
+	})
+
+	t.Run("Fresh Rejected", func(t *testing.T) {
+		hits, calls, denied = 0, nil, map[string]bool{"tenant-client": true}
+
+		_, err := handler(t, denyList)("token")
+
+		equals(t, errDenied, err)
+		equals(t, 1, hits)
+	})
+
+	t.Run("Enforced", func(t *testing.T) {
+		denied = map[string]bool{"tenant-client": true}
+
+		req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+		req.Header.Add("Authorization", "Bearer token")
+
+		intro.Introspection(ts.URL, denyList, intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be called")
+		})).ServeHTTP(res, req)
+
+		equals(t, http.StatusUnauthorized, res.Code)
+	})
+}
+
+func TestWithAccessLog(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool {
+		return r.PostFormValue("token") == "valid"
+	}, map[string]interface{}{"sub": "user", "scope": "read write"})
+	defer ts.Close()
+
+	var entries []intro.AccessLogEntry
+
+	handler := intro.Introspection(ts.URL+"/introspect", intro.WithAccessLog(func(e intro.AccessLogEntry) {
+		entries = append(entries, e)
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, 0, len(entries))
+	}))
+
+	for _, hd := range []string{"Bearer valid", "Bearer invalid", ""} {
+		entries = nil
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if hd != "" {
+			req.Header.Add("Authorization", hd)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		equals(t, 1, len(entries))
+
+		e := entries[0]
+
+		switch hd {
+		case "Bearer valid":
+			equals(t, true, e.Active)
+			equals(t, []string{"read", "write"}, e.Scopes)
+			equals(t, "user", e.Subject)
+			equals(t, 16, len(e.TokenFingerprint))
+			assert(t, !strings.Contains(e.TokenFingerprint, "valid"), "fingerprint should not contain the token")
+			assert(t, e.Latency > 0, "latency should be recorded")
+			ok(t, e.Err)
+		case "Bearer invalid":
+			equals(t, false, e.Active)
+			equals(t, "", e.Subject)
+			assert(t, e.TokenFingerprint != "", "fingerprint should be set")
+			ok(t, e.Err)
+		default:
+			equals(t, intro.AccessLogEntry{Err: intro.ErrNoBearer}, e)
+		}
+	}
+}
+
+func TestWithErrorCacheTTL(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		if r.PostFormValue("token") == "inactive" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			return
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	clock := introspectiontest.NewClock(time.Now())
+
+	handler := intro.Introspection(
+		ts.URL,
+		intro.WithErrorCacheTTL(50*time.Millisecond),
+		intro.WithClock(clock),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(token string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("token")
+	serve("token")
+
+	equals(t, 1, hits)
+
+	serve("other-token")
+
+	equals(t, 2, hits)
+
+	serve("inactive")
+	serve("inactive")
+
+	assert(t, hits == 4, "inactive results should not be cached as errors, hits: %d", hits)
+
+	clock.Advance(49 * time.Millisecond)
+
+	serve("token")
+
+	equals(t, 4, hits)
+
+	clock.Advance(time.Millisecond)
+
+	serve("token")
+
+	equals(t, 5, hits)
+}
+
+func TestCacheRespectsTokenExpiry(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+			"exp":    time.Now().Add(-time.Second).Unix(),
+		})
+	}))
+	defer ts.Close()
+
+	handler := intro.Introspection(
+		ts.URL,
+		intro.WithCache(intro.NewInMemoryCache(), time.Minute),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert(t, hits == 2, "expired tokens should not be cached, hits: %d", hits)
+}
+
+func TestResultFreshness(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool { return true }, nil)
+	defer ts.Close()
+
+	var results []*intro.Result
+
+	handler := intro.Introspection(
+		ts.URL+"/introspect",
+		intro.WithCache(intro.NewInMemoryCache(), time.Second),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := intro.FromContext(r.Context())
+
+		ok(t, err)
+
+		results = append(results, res)
+	}))
+
+	before := time.Now()
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	equals(t, 2, len(results))
+
+	live, cached := results[0], results[1]
+
+	assert(t, !live.FromCache, "live result should not be marked as cached")
+	assert(t, !live.RetrievedAt.Before(before) && !live.RetrievedAt.After(time.Now()), "retrieved at should be set on live calls: %v", live.RetrievedAt)
+
+	assert(t, cached.FromCache, "second result should be served from cache")
+	equals(t, live.RetrievedAt, cached.RetrievedAt)
+}
+
 func TestWithAddedHeaders(t *testing.T) {
 	ts := openIdServer(t, nil, nil)
 	defer ts.Close()
 
-	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		equals(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
-		equals(t, "application/json", r.Header.Get("Accept"))
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		equals(t, "application/json", r.Header.Get("Accept"))
+
+		username, password, ok := r.BasicAuth()
+
+		assert(t, ok, "basic header should be present")
+
+		equals(t, "hell", username)
+		equals(t, "yeah", password)
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	})
+
+	req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+	req.Header.Add("Authorization", "Bearer "+"token")
+
+	handler := intro.Introspection(
+		ts.URL+"/introspect",
+		intro.WithAddedHeaders(http.Header{
+			"Authorization": {
+				fmt.Sprintf("Basic %s", base64.RawStdEncoding.EncodeToString([]byte("hell:yeah"))),
+			},
+			"Content-Type": {"text/plain"},
+			"Accept":       {"text/plain"},
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := intro.FromContext(r.Context())
+
+		ok(t, err)
+
+		equals(t, true, res.Active)
+	}))
+
+	handler.ServeHTTP(res, req)
+}
+
+func TestWithAddedBody(t *testing.T) {
+	ts := openIdServer(t, nil, nil)
+	defer ts.Close()
+
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Add("Content-Type", "application/json")
+
+		equals(t, "hell", r.PostFormValue("api"))
+		equals(t, "yeah", r.PostFormValue("api_secret"))
+
+		equals(t, "token", r.PostFormValue("token"))
+		equals(t, "access_token", r.PostFormValue("token_type_hint"))
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	})
+
+	req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+	req.Header.Add("Authorization", "Bearer "+"token")
+
+	handler := intro.Introspection(
+		ts.URL+"/introspect",
+		intro.WithAddedBody(url.Values{
+			"api":        {"hell"},
+			"api_secret": {"yeah"},
+
+			"token":           {"wrong-token"},
+			"token_type_hint": {"refresh_token"},
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := intro.FromContext(r.Context())
+
+		ok(t, err)
+
+		equals(t, true, res.Active)
+	}))
+
+	handler.ServeHTTP(res, req)
+}
+
+func TestWithDefaultBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	var captured url.Values
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	intro.Introspection(
+		ts.URL,
+		intro.WithAddedBody(url.Values{"discarded": {"yes"}}),
+		intro.WithDefaultBody(url.Values{
+			"token":    {"template"},
+			"resource": {"https://api.example.com"},
+		}),
+		intro.WithAddedBody(url.Values{"api": {"hell"}, "resource": {"ignored"}}),
+		intro.WithCapturedRequestBody(func(_ context.Context, body url.Values) {
+			captured = body
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := intro.FromContext(r.Context())
+
+		ok(t, err)
+
+		equals(t, true, res.Active)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, url.Values{
+		"token":    {intro.RedactedValue},
+		"resource": {"https://api.example.com"},
+		"api":      {"hell"},
+	}, captured)
+}
+
+func TestWithRequestGzip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "gzip", r.Header.Get("Content-Encoding"))
+		equals(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+
+		zr, err := gzip.NewReader(r.Body)
+		ok(t, err)
+
+		data, err := io.ReadAll(zr)
+		ok(t, err)
+
+		body, err := url.ParseQuery(string(data))
+		ok(t, err)
+
+		equals(t, "token", body.Get("token"))
+		equals(t, "hell", body.Get("api"))
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	var captured url.Values
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	intro.Introspection(
+		ts.URL,
+		intro.WithRequestGzip(),
+		intro.WithAddedBody(url.Values{"api": {"hell"}}),
+		intro.WithCapturedRequestBody(func(_ context.Context, body url.Values) {
+			captured = body
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := intro.FromContext(r.Context())
+
+		ok(t, err)
+
+		equals(t, true, res.Active)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, url.Values{"token": {intro.RedactedValue}, "token_type_hint": {"access_token"}, "api": {"hell"}}, captured)
+}
+
+func TestWithCapturedRequestBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		equals(t, "modified", r.Header.Get("X-Debug"))
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	var captured url.Values
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, "req-1"))
+	req.Header.Add("Authorization", "Bearer token")
+
+	intro.Introspection(
+		ts.URL,
+		intro.WithAddedBody(url.Values{"api": {"hell"}, "client_secret": {"secret"}}),
+		intro.WithCapturedRequestBody(func(ctx context.Context, body url.Values) {
+			equals(t, "req-1", ctx.Value(requestIDKey{}))
+
+			captured = body
+		}),
+		intro.WithRequestModifier(func(r *http.Request) {
+			r.Header.Set("X-Debug", "modified")
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := intro.FromContext(r.Context())
+
+		ok(t, err)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, url.Values{
+		"token":           {intro.RedactedValue},
+		"token_type_hint": {"access_token"},
+		"api":             {"hell"},
+		"client_secret":   {intro.RedactedValue},
+	}, captured)
+
+	t.Run("Modified Body", func(t *testing.T) {
+		rewritten := "token=token&resource=https%3A%2F%2Fapi.example.com"
+
+		intro.Introspection(
+			ts.URL,
+			intro.WithCapturedRequestBody(func(_ context.Context, body url.Values) {
+				captured = body
+			}),
+			intro.WithRequestModifier(func(r *http.Request) {
+				r.Header.Set("X-Debug", "modified")
+				r.Body = io.NopCloser(strings.NewReader(rewritten))
+				r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(rewritten)), nil }
+				r.ContentLength = int64(len(rewritten))
+			}),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+
+		equals(t, url.Values{"token": {intro.RedactedValue}, "resource": {"https://api.example.com"}}, captured)
+	})
+}
+
+func TestSuccessStatus(t *testing.T) {
+	tt := []struct {
+		name    string
+		status  int
+		options []intro.Option
+		success bool
+	}{
+		{name: "200", status: 200, success: true},
+		{name: "201", status: 201, success: true},
+		{name: "204", status: 204},
+		{name: "204 Accepted By Predicate", status: 204, options: []intro.Option{
+			intro.WithSuccessStatusPredicate(func(int) bool { return true }),
+		}},
+		{name: "201 Rejected By Predicate", status: 201, options: []intro.Option{
+			intro.WithSuccessStatusPredicate(func(code int) bool { return code == 200 }),
+		}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"active": true,
+				})
+			}))
+			defer ts.Close()
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer token")
+
+			intro.Introspection(ts.URL, tc.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
+
+				if !tc.success {
+					assert(t, err != nil, "err should not be nil for status %d", tc.status)
+					assert(t, res == nil, "response should be nil when err is non-nil")
+					return
+				}
+
+				ok(t, err)
+
+				equals(t, true, res.Active)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+
+	t.Run("No Content", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(204)
+		}))
+		defer ts.Close()
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		intro.Introspection(ts.URL)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := intro.FromContext(r.Context())
+
+			equals(t, intro.ErrNoContent, err)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
+
+func TestWhitespaceToken(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		equals(t, "token", r.PostFormValue("token"))
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	for _, hd := range []string{"Bearer  ", "Bearer \t", "Bearer  token "} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", hd)
+
+		intro.Introspection(ts.URL)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := intro.FromContext(r.Context())
+
+			if strings.TrimSpace(hd) == "Bearer" {
+				equals(t, intro.ErrNoBearer, err)
+			} else {
+				ok(t, err)
+			}
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	equals(t, 1, hits)
+}
+
+func TestMaxTokenLength(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name    string
+		token   string
+		options []intro.Option
+		err     error
+	}{
+		{name: "Just Under", token: strings.Repeat("a", 4096)},
+		{name: "Just Over", token: strings.Repeat("a", 4097), err: intro.ErrTokenTooLarge},
+		{name: "Absurdly Large", token: strings.Repeat("a", 1<<20), err: intro.ErrTokenTooLarge},
+		{name: "Custom Limit", token: strings.Repeat("a", 11), options: []intro.Option{intro.WithMaxTokenLength(10)}, err: intro.ErrTokenTooLarge},
+		{name: "Disabled", token: strings.Repeat("a", 1<<20), options: []intro.Option{intro.WithMaxTokenLength(0)}},
+		{name: "Too Short", token: "short", options: []intro.Option{intro.WithMinTokenLength(6)}, err: intro.ErrTokenTooShort},
+		{name: "Min Length", token: "length", options: []intro.Option{intro.WithMinTokenLength(6)}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			hits = 0
+
+			var rejected int
+
+			opts := append([]intro.Option{
+				intro.WithHooks(intro.Hooks{
+					OnTokenRejected: func(ctx context.Context, err error) {
+						equals(t, tc.err, err)
+						rejected++
+					},
+				}),
+			}, tc.options...)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer "+tc.token)
+
+			intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, err := intro.FromContext(r.Context())
+
+				equals(t, tc.err, err)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			if tc.err != nil {
+				equals(t, 0, hits)
+				equals(t, 1, rejected)
+			} else {
+				equals(t, 1, hits)
+				equals(t, 0, rejected)
+			}
+		})
+	}
+
+	t.Run("Enforced", func(t *testing.T) {
+		hits = 0
+
+		req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+		req.Header.Add("Authorization", "Bearer "+strings.Repeat("a", 4097))
+
+		intro.Introspection(ts.URL, intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be called")
+		})).ServeHTTP(res, req)
+
+		equals(t, 0, hits)
+		equals(t, http.StatusBadRequest, res.Code)
+		equals(t, `Bearer error="invalid_request"`, res.Header().Get("WWW-Authenticate"))
+	})
+}
+
+// echoServer responds with an active result that echoes the introspected token in the token claim
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+			"token":  r.PostFormValue("token"),
+		})
+	}))
+}
+
+func TestMultipleAuthorizationValues(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	tt := []struct {
+		name    string
+		values  []string
+		options []intro.Option
+		token   string
+		err     error
+	}{
+		{name: "Bearer First", values: []string{"Bearer token", "Basic bWVzaDppZA=="}, token: "token"},
+		{name: "Bearer Second", values: []string{"Basic bWVzaDppZA==", "Bearer token"}, token: "token"},
+		{name: "Two Bearers", values: []string{"Bearer first", "Bearer second"}, err: intro.ErrAmbiguousBearer},
+		{name: "Same Bearer Twice", values: []string{"Bearer token", "Bearer token"}, token: "token"},
+		{name: "Same Bearer Twice Rejected", values: []string{"Bearer token", "Bearer token"}, options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Two Bearers Rejected", values: []string{"Bearer first", "Bearer second"}, options: []intro.Option{intro.WithRejectAmbiguousBearer()}, err: intro.ErrAmbiguousBearer},
+		{name: "No Bearer", values: []string{"Basic bWVzaDppZA==", "Mesh identity"}, err: intro.ErrNoBearer},
+		{name: "Unprefixed Strict", values: []string{"token"}, err: intro.ErrNoBearer},
+		{name: "Unprefixed", values: []string{"token"}, options: []intro.Option{intro.WithBearerPrefixOptional()}, token: "token"},
+		{name: "Unprefixed Padded", values: []string{"  token "}, options: []intro.Option{intro.WithBearerPrefixOptional()}, token: "token"},
+		{name: "Prefixed Optional", values: []string{"Bearer token"}, options: []intro.Option{intro.WithBearerPrefixOptional()}, token: "token"},
+		{name: "Unprefixed Beside Basic", values: []string{"Basic bWVzaDppZA==", "token"}, options: []intro.Option{intro.WithBearerPrefixOptional()}, token: "token"},
+		{name: "Unprefixed And Bearer", values: []string{"token", "Bearer other"}, options: []intro.Option{intro.WithBearerPrefixOptional()}, err: intro.ErrAmbiguousBearer},
+		{name: "Bare Scheme", values: []string{"Bearer"}, options: []intro.Option{intro.WithBearerPrefixOptional()}, err: intro.ErrNoBearer},
+		{name: "Other Scheme Optional", values: []string{"Basic bWVzaDppZA=="}, options: []intro.Option{intro.WithBearerPrefixOptional()}, err: intro.ErrNoBearer},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header["Authorization"] = tc.values
+
+			intro.Introspection(ts.URL, tc.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
+
+				equals(t, tc.err, err)
+
+				if err == nil {
+					equals(t, `"`+tc.token+`"`, string(res.Optionals["token"]))
+				}
+			})).ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func TestRejectMultipleTokens(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	tt := []struct {
+		name    string
+		target  string
+		body    string
+		ct      string
+		options []intro.Option
+		err     error
+	}{
+		{name: "Header Only", target: "/", options: []intro.Option{intro.WithRejectMultipleTokens()}},
+		{name: "Header And Form", target: "/", body: "access_token=other&a=b", ct: "application/x-www-form-urlencoded", options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Header And Form Charset", target: "/", body: "access_token=other", ct: "application/x-www-form-urlencoded; charset=utf-8", options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Header And Query", target: "/?access_token=other", options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Form Without Token", target: "/", body: "a=b", ct: "application/x-www-form-urlencoded", options: []intro.Option{intro.WithRejectMultipleTokens()}},
+		{name: "JSON Body", target: "/", body: `{"access_token":"other"}`, ct: "application/json", options: []intro.Option{intro.WithRejectMultipleTokens()}},
+		{name: "Header And Form Default", target: "/", body: "access_token=other&a=b", ct: "application/x-www-form-urlencoded"},
+		{name: "Form Too Large", target: "/", body: "a=" + strings.Repeat("x", 1<<20) + "&access_token=other", ct: "application/x-www-form-urlencoded", options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Form Too Large Without Token", target: "/", body: "a=" + strings.Repeat("x", 1<<20), ct: "application/x-www-form-urlencoded", options: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tc.target, strings.NewReader(tc.body))
+			req.Header.Add("Authorization", "Bearer token")
+			if tc.ct != "" {
+				req.Header.Set("Content-Type", tc.ct)
+			}
+
+			var called bool
+			intro.Introspection(ts.URL, tc.options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+
+				_, err := intro.FromContext(r.Context())
+				equals(t, tc.err, err)
+
+				body, err := io.ReadAll(r.Body)
+				ok(t, err)
+				equals(t, tc.body, string(body))
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert(t, called, "handler should be called")
+		})
+	}
+}
+
+func TestAutoTokenTypeHint(t *testing.T) {
+	var hint string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hint = r.PostFormValue("token_type_hint")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	byPrefix := func(token string) string {
+		switch {
+		case strings.HasPrefix(token, "at_"):
+			return "access_token"
+		case strings.HasPrefix(token, "rt_"):
+			return "refresh_token"
+		default:
+			return ""
+		}
+	}
+
+	tt := []struct {
+		name  string
+		token string
+		hint  string
+	}{
+		{name: "Access Token", token: "at_token", hint: "access_token"},
+		{name: "Refresh Token", token: "rt_token", hint: "refresh_token"},
+		{name: "Fallback", token: "token", hint: "access_token"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer "+tc.token)
+
+			intro.Introspection(ts.URL, intro.WithAutoTokenTypeHint(byPrefix))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, err := intro.FromContext(r.Context())
+				ok(t, err)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			equals(t, tc.hint, hint)
+		})
+	}
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, max, calls int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		calls++
+		if inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	h := intro.Introspection(ts.URL, intro.WithMaxConcurrency(3), intro.WithCache(intro.NewInMemoryCache(), time.Minute))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := intro.FromContext(r.Context())
+			ok(t, err)
+		}),
+	)
+
+	serve := func(token string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			serve(fmt.Sprint("token-", i))
+		}(i)
+	}
+	wg.Wait()
+
+	assert(t, max <= 3, "at most 3 concurrent calls expected, got %d", max)
+	equals(t, 20, calls)
+
+	// cache hits don't wait for a slot
+	for i := 0; i < 20; i++ {
+		serve(fmt.Sprint("token-", i))
+	}
+	equals(t, 20, calls)
+}
+
+func TestMaxConcurrencyDeadline(t *testing.T) {
+	release := make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	var errs = make(chan error, 2)
+	h := intro.Introspection(ts.URL, intro.WithMaxConcurrency(1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := intro.FromContext(r.Context())
+		errs <- err
+	}))
+
+	go func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer first")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	// wait until the first call holds the only slot
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	req.Header.Add("Authorization", "Bearer second")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, context.DeadlineExceeded, <-errs)
+}
+
+func TestWebSocketProtocolToken(t *testing.T) {
+	ts := echoServer()
+	defer ts.Close()
+
+	tt := []struct {
+		name      string
+		prefix    string
+		protocols string
+		upgrade   bool
+		bearer    string
+		token     string
+		entries   *intro.WebSocketProtocols
+		err       error
+	}{
+		{
+			name: "Marker First", prefix: "bearer", protocols: "bearer, token, chat", upgrade: true, token: "token",
+			entries: &intro.WebSocketProtocols{Token: []string{"bearer", "token"}, Remaining: []string{"chat"}},
+		},
+		{
+			name: "Marker Last", prefix: "bearer", protocols: "chat, v2.chat, bearer, token", upgrade: true, token: "token",
+			entries: &intro.WebSocketProtocols{Token: []string{"bearer", "token"}, Remaining: []string{"chat", "v2.chat"}},
+		},
+		{
+			name: "Prefixed Middle", prefix: "access_token.", protocols: "chat,access_token.token,v2.chat", upgrade: true, token: "token",
+			entries: &intro.WebSocketProtocols{Token: []string{"access_token.token"}, Remaining: []string{"chat", "v2.chat"}},
+		},
+		{name: "Marker Without Token", prefix: "bearer", protocols: "chat, bearer", upgrade: true, err: intro.ErrNoBearer},
+		{name: "Not An Upgrade", prefix: "bearer", protocols: "bearer, token", err: intro.ErrNoBearer},
+		{name: "Authorization Header Preferred", prefix: "bearer", protocols: "bearer, token", upgrade: true, bearer: "header", token: "header"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/ws", nil)
+			req.Header.Set("Sec-WebSocket-Protocol", tc.protocols)
+			if tc.upgrade {
+				req.Header.Set("Connection", "keep-alive, Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+			}
+			if tc.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+
+			intro.Introspection(ts.URL, intro.WithWebSocketProtocolToken(tc.prefix))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
+
+				equals(t, tc.err, err)
+
+				if err == nil {
+					equals(t, `"`+tc.token+`"`, string(res.Optionals["token"]))
+				}
+
+				entries, found := intro.WebSocketProtocolsFromContext(r.Context())
+
+				equals(t, tc.entries != nil, found)
+				if tc.entries != nil {
+					equals(t, tc.entries, entries)
+				}
+			})).ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
+
+func TestWithTokenClassifier(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	classify := func(token string) intro.TokenClass {
+		switch {
+		case strings.HasPrefix(token, "key_"):
+			return intro.Skip
+		case strings.Count(token, ".") == 2:
+			return intro.JWT
+		default:
+			return intro.Opaque
+		}
+	}
+
+	validate := intro.WithJWTValidator(func(ctx context.Context, token string) (*intro.Result, error) {
+		return &intro.Result{Active: true, Optionals: map[string]json.RawMessage{"local": json.RawMessage("true")}}, nil
+	})
+
+	tt := []struct {
+		name    string
+		token   string
+		options []intro.Option
+		hits    int
+		active  bool
+		local   bool
+	}{
+		{name: "Opaque", token: "opaque", hits: 1, active: true},
+		{name: "JWT", token: "header.payload.signature", options: []intro.Option{validate}, active: true, local: true},
+		{name: "JWT Without Validator", token: "header.payload.signature", hits: 1, active: true},
+		{name: "Skip", token: "key_123", options: []intro.Option{validate}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			hits = 0
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Add("Authorization", "Bearer "+tc.token)
+
+			intro.Introspection(ts.URL, append(tc.options, intro.WithTokenClassifier(classify))...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
+
+				ok(t, err)
+
+				equals(t, tc.active, res.Active)
+				equals(t, tc.local, res.Optionals["local"] != nil)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			equals(t, tc.hits, hits)
+		})
+	}
+}
+
+func TestNestedMiddleware(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": true,
+		})
+	}))
+	defer ts.Close()
+
+	serve := func(outer, inner string) {
+		hits = 0
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		intro.Introspection(outer)(intro.Introspection(inner)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := intro.FromContext(r.Context())
+
+			ok(t, err)
+
+			equals(t, true, res.Active)
+		}))).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("Same Endpoint", func(t *testing.T) {
+		serve(ts.URL, ts.URL)
+
+		equals(t, 1, hits)
+	})
+
+	t.Run("Different Endpoint", func(t *testing.T) {
+		serve(ts.URL, ts.URL+"/other")
+
+		equals(t, 2, hits)
+	})
+}
+
+func TestNestedMiddlewareChecks(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true, "aud": "a"}`))
+	}))
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-		username, password, ok := r.BasicAuth()
+	tt := []struct {
+		name   string
+		outer  []intro.Option
+		inner  []intro.Option
+		status int
+	}{
+		{name: "Stricter Inner", inner: []intro.Option{intro.WithRequiredAudience("b", false), intro.WithEnforcement()}, status: http.StatusUnauthorized},
+		{name: "Stricter Outer", outer: []intro.Option{intro.WithRequiredAudience("b", false)}, inner: []intro.Option{intro.WithRequiredAudience("a", false), intro.WithEnforcement()}, status: http.StatusOK},
+		{name: "Inner Authorizer", inner: []intro.Option{intro.WithAuthorizer(func(*http.Request, *intro.Result) error { return errWrongTenant }), intro.WithEnforcement()}, status: http.StatusForbidden},
+		{name: "Same Checks", inner: []intro.Option{intro.WithRequiredAudience("a", false), intro.WithEnforcement()}, status: http.StatusOK},
+	}
 
-		assert(t, ok, "basic header should be present")
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			hits = 0
 
-		equals(t, "hell", username)
-		equals(t, "yeah", password)
+			h := intro.Introspection(ts.URL, tc.outer...)(intro.Introspection(ts.URL, tc.inner...)(next))
+
+			equals(t, tc.status, serveStatus(h, "token"))
+			equals(t, 1, hits)
+		})
+	}
+}
+
+func TestNestedMiddlewareFailedLookup(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	var outer, inner intro.Meta
+	h := intro.Introspection(ts.URL)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		intro.Introspection(ts.URL, intro.WithShadowMode())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner, _ = intro.MetaFromContext(r.Context())
+		})).ServeHTTP(w, r)
+
+		outer, _ = intro.MetaFromContext(r.Context())
+	}))
 
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, 1, hits)
+	assert(t, inner.ShadowDenial != nil, "the inner middleware should record its shadow denial")
+	equals(t, nil, outer.ShadowDenial)
+}
+
+func TestEnforcementIntrospectionFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "application/json")
 
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"active": true,
+		switch r.PostFormValue("token") {
+		case "failing":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "malformed":
+			w.Write([]byte(`{"active": true`))
+		case "large":
+			w.Write([]byte(`{"active": true, "padding": "` + strings.Repeat("x", 1024) + `"}`))
+		case "inactive":
+			w.Write([]byte(`{"active": false}`))
+		default:
+			w.Write([]byte(`{"active": true}`))
+		}
+	}))
+	defer ts.Close()
+
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := intro.Introspection(ts.URL, intro.WithMaxResponseBytes(512), intro.WithEnforcement())(next)
+
+	tt := []struct {
+		name      string
+		h         http.Handler
+		token     string
+		status    int
+		challenge string
+	}{
+		{name: "Server Error", h: h, token: "failing", status: http.StatusServiceUnavailable},
+		{name: "Malformed Response", h: h, token: "malformed", status: http.StatusServiceUnavailable},
+		{name: "Response Too Large", h: h, token: "large", status: http.StatusServiceUnavailable},
+		{name: "Unreachable", h: intro.Introspection(unreachable.URL, intro.WithEnforcement())(next), token: "token", status: http.StatusServiceUnavailable},
+		{name: "Inactive", h: h, token: "inactive", status: http.StatusUnauthorized, challenge: `Bearer error="invalid_token"`},
+		{name: "Active", h: h, token: "token", status: http.StatusOK},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, rr := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+			req.Header.Add("Authorization", "Bearer "+tc.token)
+
+			tc.h.ServeHTTP(rr, req)
+
+			equals(t, tc.status, rr.Code)
+			equals(t, tc.challenge, rr.Header().Get("WWW-Authenticate"))
 		})
+	}
+
+	t.Run("GRPC", func(t *testing.T) {
+		_, err := intro.AuthFunc(ts.URL, intro.WithEnforcement())(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer failing")))
+		equals(t, codes.Unavailable, status.Code(err))
 	})
+}
 
-	req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
-	req.Header.Add("Authorization", "Bearer "+"token")
+func TestEnforcement(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool {
+		return r.PostFormValue("token") == "valid"
+	}, nil)
+	defer ts.Close()
 
-	handler := intro.Introspection(
-		ts.URL+"/introspect",
-		intro.WithAddedHeaders(http.Header{
-			"Authorization": {
-				fmt.Sprintf("Basic %s", base64.RawStdEncoding.EncodeToString([]byte("hell:yeah"))),
-			},
-			"Content-Type": {"text/plain"},
-			"Accept":       {"text/plain"},
-		}),
-	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		res, err := intro.FromContext(r.Context())
+	tt := []struct {
+		name      string
+		header    string
+		status    int
+		challenge string
+	}{
+		{name: "Active", header: "Bearer valid", status: http.StatusOK},
+		{name: "Inactive", header: "Bearer invalid", status: http.StatusUnauthorized, challenge: `Bearer error="invalid_token"`},
+		{name: "No Bearer", status: http.StatusUnauthorized, challenge: "Bearer"},
+	}
 
-		ok(t, err)
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+			if tc.header != "" {
+				req.Header.Add("Authorization", tc.header)
+			}
 
-		equals(t, true, res.Active)
-	}))
+			intro.Introspection(ts.URL+"/introspect", intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
 
-	handler.ServeHTTP(res, req)
+				ok(t, err)
+
+				equals(t, true, res.Active)
+			})).ServeHTTP(res, req)
+
+			equals(t, tc.status, res.Code)
+			equals(t, tc.challenge, res.Header().Get("WWW-Authenticate"))
+		})
+	}
 }
 
-func TestWithAddedBody(t *testing.T) {
-	ts := openIdServer(t, nil, nil)
+func TestProxyAuthorization(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool {
+		return r.PostFormValue("token") == "valid"
+	}, nil)
 	defer ts.Close()
 
-	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	tt := []struct {
+		name      string
+		proxy     string
+		origin    string
+		status    int
+		challenge string
+	}{
+		{name: "Active", proxy: "Bearer valid", status: http.StatusOK},
+		{name: "Inactive", proxy: "Bearer invalid", status: http.StatusProxyAuthRequired, challenge: `Bearer error="invalid_token"`},
+		{name: "No Bearer", status: http.StatusProxyAuthRequired, challenge: "Bearer"},
+		{name: "Authorization Ignored", origin: "Bearer valid", status: http.StatusProxyAuthRequired, challenge: "Bearer"},
+		{name: "Both Present", proxy: "Bearer valid", origin: "Bearer invalid", status: http.StatusOK},
+		{name: "Both Present Proxy Wins", proxy: "Bearer invalid", origin: "Bearer valid", status: http.StatusProxyAuthRequired, challenge: `Bearer error="invalid_token"`},
+		{name: "Too Large", proxy: "Bearer " + strings.Repeat("a", 5000), status: http.StatusBadRequest, challenge: `Bearer error="invalid_request"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+			if tc.proxy != "" {
+				req.Header.Add("Proxy-Authorization", tc.proxy)
+			}
+			if tc.origin != "" {
+				req.Header.Add("Authorization", tc.origin)
+			}
+
+			intro.Introspection(ts.URL+"/introspect", intro.WithEnforcement(), intro.WithProxyAuthorization())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				res, err := intro.FromContext(r.Context())
+
+				ok(t, err)
+
+				equals(t, true, res.Active)
+				equals(t, tc.origin, r.Header.Get("Authorization"))
+			})).ServeHTTP(res, req)
+
+			equals(t, tc.status, res.Code)
+			equals(t, tc.challenge, res.Header().Get("Proxy-Authenticate"))
+			equals(t, "", res.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
 
+func TestWithMaxResponseBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "application/json")
 
-		equals(t, "hell", r.PostFormValue("api"))
-		equals(t, "yeah", r.PostFormValue("api_secret"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active":  true,
+			"padding": strings.Repeat("a", 100),
+		})
+	}))
+	defer ts.Close()
 
-		equals(t, "token", r.PostFormValue("token"))
-		equals(t, "access_token", r.PostFormValue("token_type_hint"))
+	serve := func(opts ...intro.Option) (*intro.Result, error) {
+		var (
+			res *intro.Result
+			err error
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err = intro.FromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res, err
+	}
+
+	res, err := serve(intro.WithMaxResponseBytes(200))
+	ok(t, err)
+	equals(t, true, res.Active)
+
+	_, err = serve(intro.WithMaxResponseBytes(100))
+	equals(t, intro.ErrResponseTooLarge, err)
+}
+
+func TestWithH2C(t *testing.T) {
+	ts := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
 
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"active": true,
+			"proto":  r.Proto,
 		})
-	})
-
-	req, res := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
-	req.Header.Add("Authorization", "Bearer "+"token")
+	}), &http2.Server{}))
+	defer ts.Close()
 
-	handler := intro.Introspection(
-		ts.URL+"/introspect",
-		intro.WithAddedBody(url.Values{
-			"api":        {"hell"},
-			"api_secret": {"yeah"},
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
 
-			"token":           {"wrong-token"},
-			"token_type_hint": {"refresh_token"},
-		}),
-	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	intro.Introspection(ts.URL, intro.WithH2C())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		res, err := intro.FromContext(r.Context())
 
 		ok(t, err)
 
-		equals(t, true, res.Active)
-	}))
+		equals(t, `"HTTP/2.0"`, string(res.Optionals["proto"]))
+	})).ServeHTTP(httptest.NewRecorder(), req)
 
-	handler.ServeHTTP(res, req)
+	t.Run("Custom Client", func(t *testing.T) {
+		defer func() {
+			err := recover()
+			assert(t, err != nil, "should have panicked")
+		}()
+
+		intro.Introspection(ts.URL, intro.WithH2C(), func(opt *intro.Options) {
+			opt.Client = &http.Client{}
+		})
+	})
 }
 
 func TestEndpointFromDiscovery(t *testing.T) {
@@ -288,6 +1586,63 @@ func TestEndpointFromDiscovery(t *testing.T) {
 	})
 }
 
+func TestEndpointFromResourceMetadata(t *testing.T) {
+	as := openIdServer(t, nil, nil)
+	defer as.Close()
+
+	mux := http.NewServeMux()
+	rs := httptest.NewServer(mux)
+	defer rs.Close()
+
+	metadata := func(resource string, servers ...string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"resource":              resource,
+				"authorization_servers": servers,
+			})
+		}
+	}
+
+	mux.Handle("/.well-known/oauth-protected-resource", metadata(rs.URL, as.URL))
+	mux.Handle("/.well-known/oauth-protected-resource/api", metadata(rs.URL+"/api", as.URL))
+	mux.Handle("/.well-known/oauth-protected-resource/mismatch", metadata(rs.URL+"/other", as.URL))
+	mux.Handle("/.well-known/oauth-protected-resource/none", metadata(rs.URL+"/none"))
+
+	t.Run("Host", func(t *testing.T) {
+		endpoint, err := intro.EndpointFromResourceMetadata(rs.URL)
+
+		ok(t, err)
+
+		equals(t, as.URL+"/introspect", endpoint)
+	})
+
+	t.Run("With Path", func(t *testing.T) {
+		endpoint, err := intro.EndpointFromResourceMetadata(rs.URL + "/api")
+
+		ok(t, err)
+
+		equals(t, as.URL+"/introspect", endpoint)
+	})
+
+	t.Run("Resource Mismatch", func(t *testing.T) {
+		_, err := intro.EndpointFromResourceMetadata(rs.URL + "/mismatch")
+
+		assert(t, err != nil, "metadata for another resource should be rejected")
+	})
+
+	t.Run("No Authorization Servers", func(t *testing.T) {
+		_, err := intro.EndpointFromResourceMetadata(rs.URL + "/none")
+
+		assert(t, err != nil, "metadata without authorization servers should be rejected")
+	})
+
+	t.Run("Not Found", func(t *testing.T) {
+		_, err := intro.EndpointFromResourceMetadata(rs.URL + "/missing")
+
+		assert(t, err != nil, "missing metadata should be an error")
+	})
+}
+
 func TestMust(t *testing.T) {
 	t.Run("Nil Issuer", func(t *testing.T) {
 		defer func() {
@@ -501,3 +1856,236 @@ func TestErrorPropagation(t *testing.T) {
 		}).ServeHTTP(nil, httptest.NewRequest("GET", "/", nil))
 	})
 }
+
+func TestETagRevalidation(t *testing.T) {
+	var full, notModified int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		full++
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "user"})
+	}))
+	defer ts.Close()
+
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	h := intro.Introspection(ts.URL,
+		intro.WithClock(clock),
+		intro.WithCache(intro.NewInMemoryCache(intro.CacheClock(clock)), time.Minute),
+		intro.WithETagRevalidation(time.Minute),
+	)
+
+	check := func(fromCache bool) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := intro.FromContext(r.Context())
+
+			ok(t, err)
+			equals(t, true, res.Active)
+			equals(t, json.RawMessage(`"user"`), res.Optionals["sub"])
+			equals(t, `"v1"`, res.ETag)
+			equals(t, fromCache, res.FromCache)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	check(false)
+	equals(t, 1, full)
+
+	clock.Advance(59 * time.Second)
+	check(true)
+	equals(t, 0, notModified)
+
+	clock.Advance(time.Second)
+	check(false)
+	equals(t, 1, full)
+	equals(t, 1, notModified)
+
+	clock.Advance(59 * time.Second)
+	check(true)
+	equals(t, 1, notModified)
+
+	clock.Advance(3 * time.Minute)
+	check(false)
+	equals(t, 2, full)
+	equals(t, 1, notModified)
+}
+
+func TestETagRevalidationDisabled(t *testing.T) {
+	var hits int
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		equals(t, "", r.Header.Get("If-None-Match"))
+
+		w.Header().Set("ETag", `"v1"`)
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	h := intro.Introspection(ts.URL,
+		intro.WithClock(clock),
+		intro.WithCache(intro.NewInMemoryCache(intro.CacheClock(clock)), time.Minute),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		clock.Advance(time.Minute)
+	}
+
+	equals(t, 2, hits)
+}
+
+func TestStripAuthorization(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool {
+		return r.PostFormValue("token") == "valid"
+	}, nil)
+	defer ts.Close()
+
+	t.Run("Header", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("name=value&other=1"))
+		req.Header.Add("Authorization", "Bearer valid")
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+		called := false
+		intro.Introspection(ts.URL+"/introspect", intro.WithStripAuthorization(), intro.WithRejectMultipleTokens())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+
+			res, err := intro.FromContext(r.Context())
+			ok(t, err)
+			equals(t, true, res.Active)
+
+			_, present := r.Header["Authorization"]
+			assert(t, !present, "Authorization header should be stripped")
+
+			ok(t, r.ParseForm())
+			equals(t, url.Values{"name": {"value"}, "other": {"1"}}, r.PostForm)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		assert(t, called, "next handler should be called")
+		equals(t, "Bearer valid", req.Header.Get("Authorization"))
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Proxy-Authorization", "Bearer valid")
+		req.Header.Add("Authorization", "Bearer origin")
+
+		intro.Introspection(ts.URL+"/introspect", intro.WithStripAuthorization(), intro.WithProxyAuthorization())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := intro.FromContext(r.Context())
+			ok(t, err)
+			equals(t, true, res.Active)
+
+			equals(t, "", r.Header.Get("Proxy-Authorization"))
+			equals(t, "Bearer origin", r.Header.Get("Authorization"))
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Connection", "Upgrade")
+		req.Header.Add("Upgrade", "websocket")
+		req.Header.Add("Sec-WebSocket-Protocol", "chat, bearer, valid, json")
+
+		intro.Introspection(ts.URL+"/introspect", intro.WithStripAuthorization(), intro.WithWebSocketProtocolToken("bearer"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := intro.FromContext(r.Context())
+			ok(t, err)
+			equals(t, true, res.Active)
+
+			equals(t, []string{"chat, json"}, r.Header["Sec-Websocket-Protocol"])
+		})).ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("JSON Body", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"value","access_token":"valid","data":[1,2]}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		called := false
+		intro.Introspection(ts.URL+"/introspect", intro.WithStripAuthorization(), intro.WithJSONBodyTokenField("access_token"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+
+			res, err := intro.FromContext(r.Context())
+			ok(t, err)
+			equals(t, true, res.Active)
+
+			body, err := io.ReadAll(r.Body)
+			ok(t, err)
+			equals(t, `{"data":[1,2],"name":"value"}`, string(body))
+			equals(t, int64(len(body)), r.ContentLength)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		assert(t, called, "next handler should be called")
+	})
+}
+
+func TestJSONBodyTokenField(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool {
+		return r.PostFormValue("token") == "valid"
+	}, nil)
+	defer ts.Close()
+
+	tt := []struct {
+		name        string
+		contentType string
+		body        string
+		bearer      string
+		opts        []intro.Option
+		active      bool
+		err         error
+	}{
+		{name: "Body Token", contentType: "application/json", body: `{"access_token":"valid","data":[1,2]}`, active: true},
+		{name: "Vendor JSON", contentType: "application/vnd.api+json; charset=utf-8", body: `{"access_token":"valid"}`, active: true},
+		{name: "Inactive", contentType: "application/json", body: `{"access_token":"invalid"}`},
+		{name: "Not JSON", contentType: "text/plain", body: `{"access_token":"valid"}`, err: intro.ErrNoBearer},
+		{name: "Missing Field", contentType: "application/json", body: `{"token":"valid"}`, err: intro.ErrNoBearer},
+		{name: "Not A String", contentType: "application/json", body: `{"access_token":1}`, err: intro.ErrNoBearer},
+		{name: "Malformed", contentType: "application/json", body: `{"access_token":`, err: intro.ErrNoBearer},
+		{name: "Bearer Wins", contentType: "application/json", body: `{"access_token":"invalid"}`, bearer: "valid", active: true},
+		{name: "Both Rejected", contentType: "application/json", body: `{"access_token":"valid"}`, bearer: "valid", opts: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Body Too Large", contentType: "application/json", body: `{"access_token":"valid","padding":"` + strings.Repeat("x", 1<<20) + `"}`, err: intro.ErrNoBearer},
+		{name: "Body Too Large Rejected", contentType: "application/json", body: `{"access_token":"valid","padding":"` + strings.Repeat("x", 1<<20) + `"}`, bearer: "valid", opts: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+		{name: "Body Too Large Without Field", contentType: "application/json", body: `{"padding":"` + strings.Repeat("x", 1<<20) + `"}`, bearer: "valid", opts: []intro.Option{intro.WithRejectMultipleTokens()}, err: intro.ErrAmbiguousBearer},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+
+			called := false
+			intro.Introspection(ts.URL+"/introspect", append(tc.opts, intro.WithJSONBodyTokenField("access_token"))...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+
+				res, err := intro.FromContext(r.Context())
+				equals(t, tc.err, err)
+				if err == nil {
+					equals(t, tc.active, res.Active)
+				}
+
+				body, err := io.ReadAll(r.Body)
+				ok(t, err)
+				equals(t, tc.body, string(body))
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert(t, called, "next handler should be called")
+		})
+	}
+}
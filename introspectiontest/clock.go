@@ -0,0 +1,89 @@
+// Package introspectiontest provides utilities for testing code that uses the introspection package
+package introspectiontest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/srikrsna/oauth-introspection"
+)
+
+// Clock is a fake introspection.Clock whose time only moves when Advance is called. It is safe for concurrent use.
+type Clock struct {
+	mu sync.Mutex
+
+	now    time.Time
+	timers []*timer
+}
+
+// NewClock returns a Clock set to now
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current fake time
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc schedules f to be called once the clock has been advanced by at least d
+func (c *Clock) AfterFunc(d time.Duration, f func()) introspection.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+
+	return t
+}
+
+// Advance moves the clock forward by d. Functions scheduled with AfterFunc that become due are called synchronously,
+// in the order of their deadlines, before Advance returns.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+
+	var due, pending []*timer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+
+	for _, t := range due {
+		t.f()
+	}
+}
+
+type timer struct {
+	clock *Clock
+
+	at time.Time
+	f  func()
+}
+
+func (t *timer) Stop() bool {
+	c := t.clock
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,44 @@
+package introspection
+
+import "context"
+
+// Introspector introspects tokens over some transport. The middleware uses an HTTP Introspector posting to the endpoint by default,
+// WithIntrospector replaces it, e.g. with one returned by NewGRPCIntrospector.
+type Introspector interface {
+	// Do introspects token, a nil error means the authorization server answered, whether or not the token is active
+	Do(ctx context.Context, token string) (*Result, error)
+}
+
+// WithIntrospector introspects tokens using i instead of posting them to the endpoint. The endpoint is then only used to recognise
+// nested middlewares introspecting the same token. Options configuring the HTTP request, such as WithAddedBody, have no effect,
+// and those authenticating or routing it, such as WithCredentials and WithEndpointPool, are rejected with an *OptionConflictError.
+func WithIntrospector(i Introspector) Option {
+	return func(opt *Options) {
+		opt.introspector = i
+	}
+}
+
+// NewHTTPIntrospector returns the Introspector used by default, it posts tokens to the RFC 7662 endpoint configured with opts.
+// Options unrelated to the HTTP request, such as WithCache, are ignored.
+func NewHTTPIntrospector(endpoint string, opts ...Option) Introspector {
+	return &httpIntrospector{opt: makeOptions(endpoint, opts)}
+}
+
+type httpIntrospector struct {
+	opt Options
+	// issuer, if set, is the issuer results must come from, see NewDiscoveryIntrospector
+	issuer string
+}
+
+func (i *httpIntrospector) Do(ctx context.Context, token string) (*Result, error) {
+	res, err := introspect(ctx, token, "", &i.opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkIssuer(res, i.issuer); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
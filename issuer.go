@@ -0,0 +1,69 @@
+package introspection
+
+import "fmt"
+
+// IssuerMismatchError is returned by FromContext when an active token was issued by an authorization server other than the
+// expected one, see WithExpectedIssuer and NewDiscoveryIntrospector
+type IssuerMismatchError struct {
+	// Expected is the issuer tokens must come from
+	Expected string
+	// Presented is the iss claim of the token, empty if it has none
+	Presented string
+}
+
+func (e *IssuerMismatchError) Error() string {
+	if e.Presented == "" {
+		return fmt.Sprintf("token has no iss claim, expected %q", e.Expected)
+	}
+
+	return fmt.Sprintf("token is issued by %q, expected %q", e.Presented, e.Expected)
+}
+
+// WithExpectedIssuer rejects active tokens whose iss claim is not iss with an *IssuerMismatchError, tokens without an iss
+// claim are rejected too. The comparison is exact, as per rfc8414 section 3.3.
+func WithExpectedIssuer(iss string) Option {
+	return func(opt *Options) {
+		opt.expectedIssuer = iss
+	}
+}
+
+// WithoutIssuerValidation turns off the issuer validation NewDiscoveryIntrospector enables, e.g. for authorization servers
+// that omit the iss claim from introspection responses. It has no effect on WithExpectedIssuer.
+func WithoutIssuerValidation() Option {
+	return func(opt *Options) {
+		opt.skipIssuerValidation = true
+	}
+}
+
+// NewDiscoveryIntrospector returns an HTTP Introspector, see NewHTTPIntrospector, posting tokens to the introspection endpoint
+// discovered from the openid configuration of iss, see EndpointFromDiscovery. Active results whose iss claim differs from the
+// issuer the configuration advertises fail with an *IssuerMismatchError unless WithoutIssuerValidation is used.
+func NewDiscoveryIntrospector(iss string, opts ...Option) (Introspector, error) {
+	doc, err := discover(iss, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.IntrospectionEndpoint == "" {
+		return nil, fmt.Errorf("openid configuration of %q has no introspection_endpoint", iss)
+	}
+
+	i := &httpIntrospector{opt: makeOptions(doc.IntrospectionEndpoint, opts)}
+	if !i.opt.skipIssuerValidation {
+		i.issuer = doc.Issuer
+		if i.issuer == "" {
+			i.issuer = iss
+		}
+	}
+
+	return i, nil
+}
+
+// checkIssuer fails with an *IssuerMismatchError if res is active and was not issued by iss, an empty iss accepts any issuer
+func checkIssuer(res *Result, iss string) error {
+	if iss == "" || !res.Active || res.Iss == iss {
+		return nil
+	}
+
+	return &IssuerMismatchError{Expected: iss, Presented: res.Iss}
+}
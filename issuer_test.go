@@ -0,0 +1,95 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestDiscoveryIntrospectorIssuer(t *testing.T) {
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"introspection_endpoint": "http://" + r.Host + "/introspect",
+		})
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		data := map[string]interface{}{"active": true}
+		switch r.PostFormValue("token") {
+		case "ours":
+			data["iss"] = issuer
+		case "theirs":
+			data["iss"] = "https://evil.example.com"
+		case "inactive":
+			data = map[string]interface{}{"active": false, "iss": "https://evil.example.com"}
+		}
+
+		json.NewEncoder(w).Encode(data)
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	issuer = ts.URL
+
+	validated, err := intro.NewDiscoveryIntrospector(ts.URL)
+	ok(t, err)
+
+	skipped, err := intro.NewDiscoveryIntrospector(ts.URL, intro.WithoutIssuerValidation())
+	ok(t, err)
+
+	mismatch := &intro.IssuerMismatchError{Expected: ts.URL, Presented: "https://evil.example.com"}
+
+	tt := []struct {
+		name         string
+		introspector intro.Introspector
+		token        string
+		err          error
+	}{
+		{name: "Matching Issuer", introspector: validated, token: "ours"},
+		{name: "Wrong Issuer", introspector: validated, token: "theirs", err: mismatch},
+		{name: "Missing Issuer", introspector: validated, token: "none", err: &intro.IssuerMismatchError{Expected: ts.URL}},
+		{name: "Inactive", introspector: validated, token: "inactive"},
+		{name: "Opt Out", introspector: skipped, token: "theirs"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.introspector.Do(context.Background(), tc.token)
+			equals(t, tc.err, err)
+		})
+	}
+
+	t.Run("Middleware", func(t *testing.T) {
+		h := intro.Introspection(ts.URL, intro.WithIntrospector(validated), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		equals(t, http.StatusOK, serveStatus(h, "ours"))
+		equals(t, http.StatusUnauthorized, serveStatus(h, "theirs"))
+	})
+}
+
+func TestExpectedIssuer(t *testing.T) {
+	tt := []struct {
+		name string
+		data map[string]interface{}
+		err  error
+	}{
+		{name: "Match", data: map[string]interface{}{"active": true, "iss": "https://as.example.com"}},
+		{name: "Mismatch", data: map[string]interface{}{"active": true, "iss": "https://as.example.com/"}, err: &intro.IssuerMismatchError{Expected: "https://as.example.com", Presented: "https://as.example.com/"}},
+		{name: "Missing", data: map[string]interface{}{"active": true}, err: &intro.IssuerMismatchError{Expected: "https://as.example.com"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := intro.FromContext(introspectedContext(t, tc.data, intro.WithExpectedIssuer("https://as.example.com")))
+			equals(t, tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package introspection
+
+import (
+	"context"
+	"time"
+)
+
+// Source tells where an introspection result came from
+type Source int
+
+const (
+	// SourceEndpoint is a result freshly obtained from the introspection endpoint, or the configured Introspector
+	SourceEndpoint Source = iota + 1
+	// SourceCache is a result, or an error, served from the cache
+	SourceCache
+	// SourceLocal is a result produced without the authorization server, by the JWT validator or for a skipped token
+	SourceLocal
+	// SourceForwarded is a result forwarded by a grpc-gateway, see WithForwardedResult
+	SourceForwarded
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceEndpoint:
+		return "endpoint"
+	case SourceCache:
+		return "cache"
+	case SourceLocal:
+		return "local"
+	case SourceForwarded:
+		return "forwarded"
+	default:
+		return "unknown"
+	}
+}
+
+// Meta describes how the introspection result of a request was obtained
+type Meta struct {
+	Source Source
+	// CacheHit is true when Source is SourceCache
+	CacheHit bool
+	// Latency is the time spent obtaining the result, including cache lookups and validation
+	Latency time.Duration
+	// EntryAge is the age of the cache entry on cache hits, from when it was stored if the cache is an EntryInspector, otherwise
+	// from when the result was retrieved
+	EntryAge time.Duration
+	// EntryExpiresAt is when the cache entry expires and the token will be introspected again, on cache hits from an
+	// EntryInspector. It is unrelated to the expiry of the token.
+	EntryExpiresAt time.Time
+	// ShadowDenial is the first error the request would have been rejected with, see WithShadowMode
+	ShadowDenial error
+}
+
+// MetaFromContext returns the metadata of the introspection result in ctx. ok is false when there is no middleware or no
+// result was looked up, e.g. because the request carried no token, unless a shadow denial was recorded.
+func MetaFromContext(ctx context.Context) (meta Meta, ok bool) {
+	if val, ok := ctx.Value(resKey).(*result); ok && (val.meta.Source != 0 || val.meta.ShadowDenial != nil) {
+		return val.meta, true
+	}
+
+	return Meta{}, false
+}
@@ -0,0 +1,156 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMetaFromContext(t *testing.T) {
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(50 * time.Millisecond)
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	opts := []intro.Option{
+		intro.WithClock(clock),
+		intro.WithCache(intro.NewInMemoryCache(intro.CacheClock(clock)), time.Minute),
+		intro.WithTokenClassifier(func(token string) intro.TokenClass {
+			if strings.Count(token, ".") == 2 {
+				return intro.JWT
+			}
+
+			return intro.Opaque
+		}),
+		intro.WithJWTValidator(func(ctx context.Context, token string) (*intro.Result, error) {
+			return &intro.Result{Active: true}, nil
+		}),
+	}
+
+	h := intro.Introspection(ts.URL, opts...)
+
+	meta := func(token string) (intro.Meta, bool) {
+		var (
+			meta intro.Meta
+			ok   bool
+		)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		if token != "" {
+			req.Header.Add("Authorization", "Bearer "+token)
+		}
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			meta, ok = intro.MetaFromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return meta, ok
+	}
+
+	t.Run("Cold", func(t *testing.T) {
+		m, ok := meta("token")
+
+		assert(t, ok, "metadata should be present")
+		equals(t, intro.Meta{Source: intro.SourceEndpoint, Latency: 50 * time.Millisecond}, m)
+	})
+
+	t.Run("Warm", func(t *testing.T) {
+		clock.Advance(10 * time.Second)
+
+		m, ok := meta("token")
+
+		assert(t, ok, "metadata should be present")
+		expires := time.Unix(1500000000, 0).Add(50*time.Millisecond + time.Minute)
+		equals(t, intro.Meta{Source: intro.SourceCache, CacheHit: true, EntryAge: 10 * time.Second, EntryExpiresAt: expires}, m)
+	})
+
+	t.Run("Fallback", func(t *testing.T) {
+		m, ok := meta("header.payload.signature")
+
+		assert(t, ok, "metadata should be present")
+		equals(t, intro.Meta{Source: intro.SourceLocal}, m)
+	})
+
+	t.Run("No Token", func(t *testing.T) {
+		_, ok := meta("")
+
+		assert(t, !ok, "metadata should be absent without a lookup")
+	})
+
+	t.Run("No Middleware", func(t *testing.T) {
+		_, ok := intro.MetaFromContext(context.Background())
+
+		assert(t, !ok, "metadata should be absent without the middleware")
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer grpc"))
+
+		ctx, err := intro.AuthFunc(ts.URL, opts...)(ctx)
+		ok(t, err)
+
+		m, found := intro.MetaFromContext(ctx)
+
+		assert(t, found, "metadata should be present")
+		equals(t, intro.Meta{Source: intro.SourceEndpoint, Latency: 50 * time.Millisecond}, m)
+	})
+}
+
+func TestMetaEntryAge(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	clock := introspectiontest.NewClock(start)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+	}))
+	defer ts.Close()
+
+	h := intro.Introspection(ts.URL, intro.WithClock(clock), intro.WithCache(intro.NewInMemoryCache(intro.CacheClock(clock)), time.Minute))
+
+	meta := func() intro.Meta {
+		var meta intro.Meta
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			meta, _ = intro.MetaFromContext(r.Context())
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return meta
+	}
+
+	equals(t, intro.SourceEndpoint, meta().Source)
+
+	clock.Advance(20 * time.Second)
+	m := meta()
+	equals(t, 20*time.Second, m.EntryAge)
+	equals(t, start.Add(time.Minute), m.EntryExpiresAt)
+
+	clock.Advance(30 * time.Second)
+	m = meta()
+	equals(t, 50*time.Second, m.EntryAge)
+	equals(t, start.Add(time.Minute), m.EntryExpiresAt)
+
+	clock.Advance(10 * time.Second)
+	equals(t, intro.SourceEndpoint, meta().Source)
+
+	clock.Advance(5 * time.Second)
+	m = meta()
+	equals(t, 5*time.Second, m.EntryAge)
+	equals(t, start.Add(2*time.Minute), m.EntryExpiresAt)
+}
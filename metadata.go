@@ -0,0 +1,31 @@
+package introspection
+
+import "context"
+
+// WithMetadataDeriver computes data derived from the introspection result of each request, e.g. the resolved tenant, for
+// handlers to retrieve with MetadataFromContext. derive is called once per request that obtained a result, active or not, and
+// its return value is stored with the result. It is not called when introspection failed.
+func WithMetadataDeriver(derive func(res *Result) map[string]interface{}) Option {
+	return func(opt *Options) {
+		opt.deriveMetadata = derive
+	}
+}
+
+// MetadataFromContext returns the metadata derived from the introspection result in ctx by the function passed to
+// WithMetadataDeriver. It returns nil when there is none.
+func MetadataFromContext(ctx context.Context) map[string]interface{} {
+	if val, ok := ctx.Value(resKey).(*result); ok {
+		return val.metadata
+	}
+
+	return nil
+}
+
+// deriveMetadata stores the metadata derived from res.Result in res, if WithMetadataDeriver is used
+func deriveMetadata(res *result, opt *Options) *result {
+	if opt.deriveMetadata != nil && res.Err == nil && res.Result != nil {
+		res.metadata = opt.deriveMetadata(res.Result)
+	}
+
+	return res
+}
@@ -0,0 +1,65 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestMetadataDeriver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true, "sub": "alice", "tenant_id": "acme"}`))
+	}))
+	defer ts.Close()
+
+	calls := 0
+	deriver := intro.WithMetadataDeriver(func(res *intro.Result) map[string]interface{} {
+		calls++
+
+		var tenant string
+		json.Unmarshal(res.Optionals["tenant_id"], &tenant)
+
+		return map[string]interface{}{"tenant": tenant, "sub": res.Sub}
+	})
+
+	var metadata map[string]interface{}
+	h := intro.Introspection(ts.URL, deriver)(intro.Introspection(ts.URL, deriver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadata = intro.MetadataFromContext(r.Context())
+	})))
+
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, map[string]interface{}{"tenant": "acme", "sub": "alice"}, metadata)
+	equals(t, 1, calls)
+}
+
+func TestMetadataDeriverNoResult(t *testing.T) {
+	calls := 0
+	deriver := intro.WithMetadataDeriver(func(res *intro.Result) map[string]interface{} {
+		calls++
+		return map[string]interface{}{"derived": true}
+	})
+
+	metadata := map[string]interface{}{}
+	intro.Introspection("/introspect", deriver)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metadata = intro.MetadataFromContext(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert(t, metadata == nil, "there should be no metadata without a result: %v", metadata)
+	equals(t, 0, calls)
+}
+
+func TestMetadataFromContextWithoutDeriver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true}`))
+	}))
+	defer ts.Close()
+
+	metadata := intro.MetadataFromContext(introspectedContextAt(t, ts.URL))
+
+	assert(t, metadata == nil, "there should be no metadata without a deriver: %v", metadata)
+}
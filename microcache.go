@@ -0,0 +1,100 @@
+package introspection
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithMicroCache coalesces the lookups of a token: requests arriving while its result is being looked up wait for that lookup,
+// and requests arriving within ttl after it completed reuse its result. It absorbs bursts of requests with the same token
+// without caching results for long, ttl is typically well below a second, and works with or without WithCache.
+// Failures are only shared with the requests that waited for them, except cancellations, after which waiting requests look
+// up the token themselves. Results are reused as they are, so the option disables WithResultPool.
+func WithMicroCache(ttl time.Duration) Option {
+	return func(opt *Options) {
+		opt.microCacheTTL = ttl
+	}
+}
+
+type microCache struct {
+	sync.Mutex
+
+	clock   Clock
+	ttl     time.Duration
+	entries map[string]*microEntry
+}
+
+// microEntry is a lookup, done is closed once it completed
+type microEntry struct {
+	done chan struct{}
+
+	res *Result
+	src Source
+	err error
+}
+
+func newMicroCache(clock Clock, ttl time.Duration) *microCache {
+	return &microCache{clock: clock, ttl: ttl, entries: make(map[string]*microEntry)}
+}
+
+// microLookupResult is lookupResult going through the micro cache, if WithMicroCache is used
+func microLookupResult(ctx context.Context, token string, opt *Options) (*Result, Source, error) {
+	if opt.microCache == nil {
+		return lookupResult(ctx, token, opt)
+	}
+
+	return opt.microCache.do(ctx, cacheKey(ctx, token), func() (*Result, Source, error) {
+		return lookupResult(ctx, token, opt)
+	})
+}
+
+func (mc *microCache) do(ctx context.Context, key string, lookup func() (*Result, Source, error)) (*Result, Source, error) {
+	mc.Lock()
+	if e, ok := mc.entries[key]; ok {
+		mc.Unlock()
+
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, SourceCache, ctx.Err()
+		}
+
+		switch {
+		case e.err == nil:
+			cp := *e.res
+			cp.FromCache = true
+			return &cp, SourceCache, nil
+		case e.err == context.Canceled || e.err == context.DeadlineExceeded:
+			// the request that looked the token up went away, that says nothing about this one
+			return lookup()
+		default:
+			return nil, e.src, e.err
+		}
+	}
+
+	e := &microEntry{done: make(chan struct{})}
+	mc.entries[key] = e
+	mc.Unlock()
+
+	e.res, e.src, e.err = lookup()
+	close(e.done)
+
+	if e.err != nil {
+		mc.remove(key, e)
+	} else {
+		mc.clock.AfterFunc(mc.ttl, func() { mc.remove(key, e) })
+	}
+
+	return e.res, e.src, e.err
+}
+
+// remove removes the entry under key if it is still e
+func (mc *microCache) remove(key string, e *microEntry) {
+	mc.Lock()
+	defer mc.Unlock()
+
+	if mc.entries[key] == e {
+		delete(mc.entries, key)
+	}
+}
@@ -0,0 +1,86 @@
+package introspection_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestMicroCache(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true}`))
+	}))
+	defer ts.Close()
+
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+
+	var fromCache int32
+	h := intro.Introspection(ts.URL, intro.WithMicroCache(500*time.Millisecond), intro.WithClock(clock), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if res, _ := intro.FromContext(r.Context()); res.FromCache {
+			atomic.AddInt32(&fromCache, 1)
+		}
+	}))
+
+	const burst = 20
+
+	var wg sync.WaitGroup
+	codes := make([]int, burst)
+	for i := 0; i < burst; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serveStatus(h, "token")
+		}(i)
+	}
+
+	// let the burst pile up behind the first lookup
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, code := range codes {
+		equals(t, http.StatusOK, code)
+	}
+	equals(t, int32(1), atomic.LoadInt32(&calls))
+	equals(t, int32(burst-1), atomic.LoadInt32(&fromCache))
+
+	clock.Advance(400 * time.Millisecond)
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, int32(1), atomic.LoadInt32(&calls))
+
+	clock.Advance(100 * time.Millisecond)
+	equals(t, http.StatusOK, serveStatus(h, "token"))
+	equals(t, int32(2), atomic.LoadInt32(&calls))
+
+	equals(t, http.StatusOK, serveStatus(h, "other"))
+	equals(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestMicroCacheError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	h := intro.Introspection(ts.URL, intro.WithMicroCache(time.Second), intro.WithEnforcement())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	equals(t, http.StatusServiceUnavailable, serveStatus(h, "token"))
+	equals(t, http.StatusServiceUnavailable, serveStatus(h, "token"))
+
+	// failures are not kept once their lookup completed
+	equals(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,209 @@
+package introspection
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+var errUnsupportedMintKey = errors.New("introspection: unsupported token translation key, use an HMAC secret, an RSA or a P-256 ECDSA key")
+
+// MintKey is the key translated tokens are signed with, see TokenTranslation
+type MintKey struct {
+	// ID is sent as the kid header parameter so verifiers can select the key while keys are rotated, it may be empty
+	ID string
+	// Secret is an HMAC key, tokens are then signed with HS256
+	Secret []byte
+	// Signer is used when Secret is empty. RSA keys sign with RS256, P-256 ECDSA keys with ES256.
+	Signer crypto.Signer
+}
+
+// TokenTranslation configures WithTokenTranslation
+type TokenTranslation struct {
+	// Key returns the key to sign with, it is called for every minted token so keys can be rotated
+	Key func() (MintKey, error)
+	// TTL is the lifetime of minted tokens, it is shortened to never exceed the expiry of the introspected token
+	TTL time.Duration
+	// Issuer and Audience, when non empty, are set as the iss and aud claims
+	Issuer   string
+	Audience string
+	// Claims lists additional claims of the introspection result that are copied to minted tokens
+	Claims []string
+	// Header is the request header the minted token is set in, defaults to Authorization, where it is sent as a Bearer token
+	Header string
+}
+
+// WithTokenTranslation replaces the token of requests passed to the next handler by a short lived JWT minted from the
+// introspection result, for services behind a gateway that trust the gateway's signature rather than introspecting themselves.
+// The minted token carries the sub and scope claims, the claims listed in t.Claims, and iat and exp. The original token is
+// always removed, from wherever it was read as by WithStripAuthorization, requests whose token is missing, inactive or failed
+// introspection reach the next handler without any token. Requests for which no token can be minted, e.g. because t.Key fails, are answered with 500.
+func WithTokenTranslation(t TokenTranslation) Option {
+	return func(opt *Options) {
+		if t.Header == "" {
+			t.Header = "Authorization"
+		}
+
+		opt.translation = &t
+	}
+}
+
+// translateToken replaces the token of r, whose header it replaces by a copy, by one minted from res
+func translateToken(r *http.Request, res *result, opt *Options) error {
+	t := opt.translation
+
+	stripCredentials(r, opt)
+	r.Header.Del(t.Header)
+
+	if res.Err != nil || res.Result == nil || !res.Result.Active {
+		return nil
+	}
+
+	jwt, err := mintToken(res.Result, t, opt.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	if http.CanonicalHeaderKey(t.Header) == "Authorization" {
+		jwt = "Bearer " + jwt
+	}
+
+	r.Header.Set(t.Header, jwt)
+
+	return nil
+}
+
+// mintToken returns a JWT for res signed with the current key of t
+func mintToken(res *Result, t *TokenTranslation, now time.Time) (string, error) {
+	key, err := t.Key()
+	if err != nil {
+		return "", err
+	}
+
+	exp := now.Add(t.TTL)
+	if until, ok := res.EffectiveExpiry(now); ok && until.Before(exp) {
+		exp = until
+	}
+
+	if !exp.After(now) {
+		return "", ErrExpired
+	}
+
+	claims := make(map[string]json.RawMessage, len(t.Claims)+6)
+	for _, names := range [][]string{{"sub", "scope"}, t.Claims} {
+		for _, name := range names {
+			if val, ok := res.Optionals[name]; ok {
+				claims[name] = val
+			}
+		}
+	}
+
+	setClaim(claims, "iat", now.Unix())
+	setClaim(claims, "exp", exp.Unix())
+	if t.Issuer != "" {
+		setClaim(claims, "iss", t.Issuer)
+	}
+	if t.Audience != "" {
+		setClaim(claims, "aud", t.Audience)
+	}
+
+	alg, signer, err := mintSigner(key)
+	if err != nil {
+		return "", err
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if key.ID != "" {
+		header["kid"] = key.ID
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+
+	sig, err := signer([]byte(input))
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func setClaim(claims map[string]json.RawMessage, name string, v interface{}) {
+	data, _ := json.Marshal(v)
+	claims[name] = data
+}
+
+// mintSigner returns the JWS algorithm for key along with a function signing with it
+func mintSigner(key MintKey) (string, func([]byte) ([]byte, error), error) {
+	if len(key.Secret) > 0 {
+		return "HS256", func(input []byte) ([]byte, error) {
+			mac := hmac.New(sha256.New, key.Secret)
+			mac.Write(input)
+			return mac.Sum(nil), nil
+		}, nil
+	}
+
+	if key.Signer == nil {
+		return "", nil, errUnsupportedMintKey
+	}
+
+	switch pub := key.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		return "RS256", func(input []byte) ([]byte, error) {
+			digest := sha256.Sum256(input)
+			return key.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			break
+		}
+
+		return "ES256", func(input []byte) ([]byte, error) {
+			digest := sha256.Sum256(input)
+
+			der, err := key.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil {
+				return nil, err
+			}
+
+			// JWS wants the fixed size big endian concatenation of r and s instead of DER
+			return rawP256Signature(der)
+		}, nil
+	}
+
+	return "", nil, errUnsupportedMintKey
+}
+
+// rawP256Signature converts a DER encoded P-256 ECDSA signature to the fixed size big endian concatenation of r and s
+func rawP256Signature(der []byte) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 64)
+	sig.R.FillBytes(out[:32])
+	sig.S.FillBytes(out[32:])
+
+	return out, nil
+}
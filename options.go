@@ -1,10 +1,26 @@
 package introspection
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultMaxTokenLength   = 4096
+	defaultMaxResponseBytes = 1 << 20
 )
 
 // Options ...
@@ -12,20 +28,153 @@ type Options struct {
 	body   url.Values
 	header http.Header
 
-	endpoint string
-	Client   *http.Client
+	endpoint     string
+	endpointPool *endpointPool
+	Client       *http.Client
+
+	cache              Cache
+	cacheExp           time.Duration
+	slidingIdle        time.Duration
+	slidingMax         time.Duration
+	cacheDiscriminator func(*http.Request) string
+
+	errCache    *errorCache
+	errCacheTTL time.Duration
+
+	microCache    *microCache
+	microCacheTTL time.Duration
+
+	successStatus func(int) bool
+
+	maxTokenLength int
+	minTokenLength int
+	enforce        bool
+	hooks          Hooks
+
+	forwardKey    []byte
+	forwardMaxAge time.Duration
+
+	h2c bool
+
+	introspectionDeadline time.Duration
+
+	// baseCtx bounds the background work of the middleware, see WithBaseContext
+	baseCtx context.Context
+
+	// dialAddress replaces the address of the endpoint when connecting, see WithAddressOverride
+	dialAddress string
+
+	pins              map[[sha256.Size]byte]bool
+	clientCertificate *tls.Certificate
+
+	maxResponseBytes int64
+
+	rejectAmbiguousBearer bool
+	rejectMultipleTokens  bool
+
+	gzip bool
+
+	credentials      *credentialState
+	messageSignature *messageSignature
+
+	requestModifiers []func(*http.Request)
+	capturedBody     func(context.Context, url.Values)
+
+	wsProtocolPrefix string
+
+	classify    func(string) TokenClass
+	validateJWT func(context.Context, string) (*Result, error)
+
+	validators []func(context.Context, *Result) error
+	enrichers  []enricher
+
+	authorizers     []func(*http.Request, *Result) error
+	grpcAuthorizers []func(context.Context, string, metadata.MD, *Result) error
+
+	revocations RevocationSet
+	denyList    DenyList
+
+	fieldAliases   map[string]string
+	claimWhitelist map[string]bool
+
+	jsonBodyTokenField string
+	basicUsername      func(string) bool
+
+	scopeClaim   string
+	scopeMatcher func(have, want string) bool
+
+	deriveExp bool
 
-	cache    Cache
-	cacheExp time.Duration
+	retryAfterStatus int
+
+	accessLog func(AccessLogEntry)
+	events    *EventStream
+
+	deriveMetadata func(*Result) map[string]interface{}
+
+	clock           Clock
+	clockSkew       time.Duration
+	checkTimeClaims bool
+	tokenAge        *tokenAgePolicy
+
+	introspector Introspector
+
+	clientParams map[string]func(*http.Request) string
+
+	revalidationWindow time.Duration
+
+	certificateBinding bool
+
+	expectedIssuer       string
+	skipIssuerValidation bool
+
+	shadow bool
+
+	respectCacheControl bool
+	cacheBreaker        *cacheBreaker
+	noCache             func(*Result) bool
+
+	actorHeader string
+	actorPolicy ActorPolicy
+
+	bind        func(*http.Request) string
+	bindingMode BindingMode
+
+	softDeadline time.Duration
+	degraded     func(context.Context, string) (*Result, error)
+
+	// clientAuth names the options that authenticate introspection requests, in the order they were applied
+	clientAuth []string
+
+	proxyAuthorization   bool
+	bearerPrefixOptional bool
+	stripAuthorization   bool
+
+	translation *TokenTranslation
+
+	resultPool *sync.Pool
+
+	tokenTypeHint func(string) string
+	probe         *tokenTypeProbe
+
+	maxConcurrency int
+	sem            chan struct{}
 }
 
-// Option ...
+// Option configures the middleware. Options are applied in the order they are passed and a later option overrides what an
+// earlier one set, except WithAddedHeaders and WithAddedBody which keep the values set first. Options that can't be combined, such
+// as two ways of authenticating introspection requests, are rejected with an *OptionConflictError: the constructors panic with it
+// and the Chain methods return it.
 type Option func(*Options)
 
 // WithAddedHeaders ...
 func WithAddedHeaders(h http.Header) Option {
 	return func(opt *Options) {
 		for k, v := range h {
+			if http.CanonicalHeaderKey(k) == "Authorization" {
+				opt.clientAuth = append(opt.clientAuth, "WithAddedHeaders(Authorization)")
+			}
+
 			if _, ok := opt.header[k]; !ok {
 				opt.header[k] = v
 			}
@@ -37,6 +186,10 @@ func WithAddedHeaders(h http.Header) Option {
 func WithAddedBody(b url.Values) Option {
 	return func(opt *Options) {
 		for k, v := range b {
+			if k == "client_secret" || k == "client_assertion" {
+				opt.clientAuth = append(opt.clientAuth, "WithAddedBody("+k+")")
+			}
+
 			if _, ok := opt.body[k]; !ok {
 				opt.body[k] = v
 			}
@@ -44,8 +197,25 @@ func WithAddedBody(b url.Values) Option {
 	}
 }
 
+// WithDefaultBody replaces the default body, {"token": ..., "token_type_hint": "access_token"}, with b for servers expecting a
+// different shape, e.g. without token_type_hint. The token member is still set to the introspected token. Values added earlier
+// with WithAddedBody are discarded, pass it after WithDefaultBody to add to the new body.
+func WithDefaultBody(b url.Values) Option {
+	return func(opt *Options) {
+		opt.body = make(url.Values, len(b)+1)
+
+		for k, v := range b {
+			if k == "client_secret" || k == "client_assertion" {
+				opt.clientAuth = append(opt.clientAuth, "WithDefaultBody("+k+")")
+			}
+
+			opt.body[k] = v
+		}
+	}
+}
+
 // WithCache uses provided cache to store and retrieve objects, if this option is passed caching will be used otherwise not used
-// exp is the expiry for each cache entry
+// exp is the expiry for each cache entry, it is shortened for tokens that expire earlier (see Result.EffectiveExpiry)
 func WithCache(cache Cache, exp time.Duration) Option {
 	return func(opt *Options) {
 		opt.cache = cache
@@ -53,8 +223,245 @@ func WithCache(cache Cache, exp time.Duration) Option {
 	}
 }
 
-// EndpointFromDiscovery is helper function to get the introspection endpoint from the openid issuer/authority
-func EndpointFromDiscovery(iss string) (string, error) {
+// WithNoCachePredicate keeps results for which noCache returns true out of the cache, e.g. those of privileged tokens, so that
+// their revocation takes effect on the next request. Such tokens are introspected on every request, though WithMicroCache still
+// shares the result among concurrent requests.
+func WithNoCachePredicate(noCache func(res *Result) bool) Option {
+	return func(opt *Options) {
+		opt.noCache = noCache
+	}
+}
+
+// WithFieldAliases maps the members of introspection responses from servers that don't follow rfc7662 naming to the standard
+// claim names, e.g. {"user_name": "username", "cid": "client_id", "expires_at": "exp"}. Keys are the aliases, values the standard
+// names. Aliased members are renamed while the response is decoded, so they populate the typed Result fields and are found under
+// the standard name in Optionals, and are validated like the standard claims. When a response has both an alias and the standard
+// member the latter is used, the alias is left in Optionals and Hooks.OnFieldAliasConflict is called.
+func WithFieldAliases(aliases map[string]string) Option {
+	return func(opt *Options) {
+		opt.fieldAliases = make(map[string]string, len(aliases))
+		for alias, name := range aliases {
+			opt.fieldAliases[alias] = name
+		}
+	}
+}
+
+// WithClaimWhitelist keeps only the members of introspection responses named in names, along with active, decoding the others
+// just far enough to skip them. It saves building Optionals for servers returning many claims of which only a few are used.
+// Claims the middleware reads itself must be listed too, e.g. exp for the cache lifetime and the time checks, or scope for the
+// scope requirements. With WithFieldAliases, an alias is kept if either it or the standard name it maps to is listed.
+func WithClaimWhitelist(names ...string) Option {
+	return func(opt *Options) {
+		opt.claimWhitelist = make(map[string]bool, len(names))
+		for _, name := range names {
+			opt.claimWhitelist[name] = true
+		}
+	}
+}
+
+// WithCacheDiscriminator partitions the cache by the value discriminate returns for each request, e.g. a tenant or the version of
+// data an enricher adds, so the same token has independent cache entries for different values. It only applies to the HTTP
+// middleware, the gRPC AuthFunc caches by token alone.
+func WithCacheDiscriminator(discriminate func(r *http.Request) string) Option {
+	return func(opt *Options) {
+		opt.cacheDiscriminator = discriminate
+	}
+}
+
+// WithSuccessStatusPredicate sets the function used to decide whether the status code of an introspection response indicates success.
+// By default any 2xx status is accepted. A 204 No Content response is always treated as an error since the spec requires a body.
+func WithSuccessStatusPredicate(pred func(code int) bool) Option {
+	return func(opt *Options) {
+		opt.successStatus = pred
+	}
+}
+
+// WithMaxTokenLength sets the maximum accepted token length in bytes, defaults to 4096. Longer tokens are rejected with ErrTokenTooLarge
+// without contacting the introspection endpoint. A value of 0 disables the check.
+func WithMaxTokenLength(n int) Option {
+	return func(opt *Options) {
+		opt.maxTokenLength = n
+	}
+}
+
+// WithMinTokenLength rejects tokens shorter than n bytes with ErrTokenTooShort without contacting the introspection endpoint.
+// Useful when the authorization server is known to issue tokens of a minimum length.
+func WithMinTokenLength(n int) Option {
+	return func(opt *Options) {
+		opt.minTokenLength = n
+	}
+}
+
+// WithProxyAuthorization is for middlewares embedded in a forward proxy. The token is read from the Proxy-Authorization header
+// instead of Authorization, which is then ignored whether or not it is present, as it is meant for the origin server. When
+// enforcement is enabled requests are rejected with 407 and a Proxy-Authenticate challenge instead of 401 and WWW-Authenticate,
+// as they are by the requirement middlewares behind it, e.g. RequireScopes.
+func WithProxyAuthorization() Option {
+	return func(opt *Options) {
+		opt.proxyAuthorization = true
+	}
+}
+
+// WithJSONBodyTokenField makes requests without a Bearer credential carry the token in the string member field of a JSON object
+// request body, e.g. {"access_token": "..."}, for requests with an application/json or +json Content-Type. The body is read
+// and replaced by an identical one, so the next handler can read it as usual. Bodies longer than 1 MiB are not read entirely and
+// carry no token. With WithRejectMultipleTokens requests carrying a token both in a Bearer credential and in the body are rejected,
+// as are those with a Bearer credential and a JSON body too long to be inspected.
+func WithJSONBodyTokenField(field string) Option {
+	return func(opt *Options) {
+		opt.jsonBodyTokenField = field
+	}
+}
+
+// WithBearerPrefixOptional accepts Authorization values carrying the raw token without the Bearer scheme, as some clients send
+// them. A value is taken as a token when it is a single word, values with another scheme, e.g. Basic, are still skipped.
+func WithBearerPrefixOptional() Option {
+	return func(opt *Options) {
+		opt.bearerPrefixOptional = true
+	}
+}
+
+// WithStripAuthorization removes the credentials the token is read from before calling the next handler, so that it, or a service
+// it forwards the request to, never sees the raw token: the Authorization header, or Proxy-Authorization with WithProxyAuthorization,
+// the Sec-WebSocket-Protocol entries carrying the token with WithWebSocketProtocolToken, and the token member of a JSON body with
+// WithJSONBodyTokenField, the rest of the body being re-encoded with its members sorted and the Content-Length updated. Other
+// request bodies are left untouched.
+// The result remains available through FromContext.
+func WithStripAuthorization() Option {
+	return func(opt *Options) {
+		opt.stripAuthorization = true
+	}
+}
+
+// WithRejectAmbiguousBearer makes requests carrying more than one Bearer credential fail with ErrAmbiguousBearer, even when they
+// carry the same token. By default repeated Bearer credentials are accepted as long as they carry the same token.
+func WithRejectAmbiguousBearer() Option {
+	return func(opt *Options) {
+		opt.rejectAmbiguousBearer = true
+	}
+}
+
+// WithRejectMultipleTokens makes requests that present a token in more than one way fail with ErrAmbiguousBearer, as rfc6750
+// forbids it: repeated Bearer credentials, even identical ones, and a Bearer credential along with an access_token query or
+// form encoded body parameter. To detect the latter the request body is read and replaced by an identical one, form bodies
+// longer than 1 MiB are not read entirely and rejected as they can't be inspected.
+func WithRejectMultipleTokens() Option {
+	return func(opt *Options) {
+		opt.rejectMultipleTokens = true
+	}
+}
+
+// WithMaxConcurrency limits the number of introspection calls in flight at once to n, protecting the authorization server and
+// the connection pool. Further calls wait for a free slot until their request's context is done, they then fail with its error.
+// Cache hits and locally validated tokens don't count towards the limit.
+func WithMaxConcurrency(n int) Option {
+	return func(opt *Options) {
+		opt.maxConcurrency = n
+	}
+}
+
+// WithAutoTokenTypeHint derives the token_type_hint sent with each token by calling hint, e.g. based on a token prefix convention.
+// When hint returns an empty string the default hint, access_token, is sent.
+func WithAutoTokenTypeHint(hint func(token string) string) Option {
+	return func(opt *Options) {
+		opt.tokenTypeHint = hint
+	}
+}
+
+// WithRequestGzip gzips the introspection request body and sets the Content-Encoding header accordingly.
+// Only worthwhile when large additional body parameters are sent and the endpoint accepts compressed requests.
+func WithRequestGzip() Option {
+	return func(opt *Options) {
+		opt.gzip = true
+	}
+}
+
+// WithRequestModifier registers a function that is called with every introspection request right before it is sent.
+// Modifiers run in the order they were registered. A modifier replacing the body must set GetBody and ContentLength to match.
+func WithRequestModifier(modify func(*http.Request)) Option {
+	return func(opt *Options) {
+		opt.requestModifiers = append(opt.requestModifiers, modify)
+	}
+}
+
+// WithCapturedRequestBody calls capture with the form values of each introspection request, with the context of the request,
+// as they are sent: after credentials, request modifiers and message signatures are applied, and decompressed with
+// WithRequestGzip. It is intended for tests and debugging IdP incompatibilities. The token, client_secret and client_assertion
+// members are replaced by RedactedValue so the captured values never hold a secret. Capture is a callback rather than a shared
+// *url.Values destination, which concurrent requests would race on.
+func WithCapturedRequestBody(capture func(ctx context.Context, body url.Values)) Option {
+	return func(opt *Options) {
+		opt.capturedBody = capture
+	}
+}
+
+// RedactedValue replaces secrets in the form values passed to the WithCapturedRequestBody function.
+const RedactedValue = "[REDACTED]"
+
+// WithMaxResponseBytes sets the maximum size of an introspection response body, defaults to 1 MiB.
+// Larger responses fail with ErrResponseTooLarge.
+func WithMaxResponseBytes(n int64) Option {
+	return func(opt *Options) {
+		opt.maxResponseBytes = n
+	}
+}
+
+// WithH2C makes the package built client speak HTTP/2 over cleartext (h2c) to http:// endpoints, it has no effect on https:// endpoints.
+// It cannot be combined with a caller supplied Client, which is rejected with an *OptionConflictError. Connections are dialed with
+// the timeout of the client.
+func WithH2C() Option {
+	return func(opt *Options) {
+		opt.h2c = true
+	}
+}
+
+// WithResultValidator adds a check that every active result must pass, whether it is fresh or served from the cache.
+// A non nil error fails the request, it is what FromContext returns and what the request is rejected with when enforcement is enabled.
+// Validators run in the order they were added and stop at the first error.
+func WithResultValidator(validate func(ctx context.Context, res *Result) error) Option {
+	return func(opt *Options) {
+		opt.validators = append(opt.validators, validate)
+	}
+}
+
+// WithETagRevalidation keeps cached results that came with an ETag for window longer than they would otherwise be cached.
+// Once such a result is due, the token is introspected again with If-None-Match and a 304 Not Modified response renews the
+// cached result without transferring it again. It has no effect without WithCache or with WithIntrospector.
+func WithETagRevalidation(window time.Duration) Option {
+	return func(opt *Options) {
+		opt.revalidationWindow = window
+	}
+}
+
+// WithErrorCacheTTL remembers failed introspections, e.g. due to network errors or unexpected responses, for ttl per token, and
+// per partition with WithCacheDiscriminator.
+// Requests with the same token fail with the remembered error in the meantime instead of retrying against a flaky endpoint.
+// Inactive tokens are not failures, they are cached as regular results by WithCache.
+func WithErrorCacheTTL(ttl time.Duration) Option {
+	return func(opt *Options) {
+		opt.errCacheTTL = ttl
+	}
+}
+
+// EndpointFromDiscovery is helper function to get the introspection endpoint from the openid issuer/authority.
+// Options configuring the connection, such as WithCertificatePinning, apply to the discovery request, others are ignored.
+func EndpointFromDiscovery(iss string, opts ...Option) (string, error) {
+	doc, err := discover(iss, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return doc.IntrospectionEndpoint, nil
+}
+
+// discoveryDocument holds the members of the openid configuration the package uses
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+}
+
+// discover fetches the openid configuration of iss, see EndpointFromDiscovery
+func discover(iss string, opts []Option) (*discoveryDocument, error) {
 
 	if iss == "" {
 		panic("no issuer passed")
@@ -66,25 +473,64 @@ func EndpointFromDiscovery(iss string) (string, error) {
 
 	discoveryURI := iss + discoveryPath
 
-	client := http.Client{
-		Timeout: 10 * time.Second,
-	}
+	client := discoveryClient(opts)
 
 	res, err := client.Get(discoveryURI)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var doc discoveryDocument
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// EndpointFromResourceMetadata is a helper function to get the introspection endpoint from the OAuth 2.0 Protected Resource Metadata (rfc9728)
+// of resource. The introspection endpoint of the first advertised authorization server is resolved using EndpointFromDiscovery,
+// opts apply to both requests.
+func EndpointFromResourceMetadata(resource string, opts ...Option) (string, error) {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = "/" + resourceMetadataPath + strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	client := discoveryClient(opts)
+
+	res, err := client.Get(u.String())
 	if err != nil {
 		return "", err
 	}
 	defer res.Body.Close()
 
-	var discoResp struct {
-		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("resource metadata status does not indicate success: code: %d", res.StatusCode)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&discoResp); err != nil {
+	var metadata struct {
+		Resource             string   `json:"resource"`
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&metadata); err != nil {
 		return "", err
 	}
 
-	return discoResp.IntrospectionEndpoint, nil
+	if metadata.Resource != resource {
+		return "", fmt.Errorf("resource metadata is for %q instead of %q", metadata.Resource, resource)
+	}
+
+	if len(metadata.AuthorizationServers) == 0 {
+		return "", errors.New("resource metadata lists no authorization servers")
+	}
+
+	return EndpointFromDiscovery(metadata.AuthorizationServers[0], opts...)
 }
 
 // Must is a helper function that panics if err != nil and returns v if err == nil.
@@ -97,19 +543,93 @@ func Must(v string, err error) string {
 }
 
 func makeOptions(endpoint string, opts []Option) Options {
+	opt, client := applyOptions(endpoint, opts)
+
+	if err := checkConflicts(&opt, client); err != nil {
+		panic(err)
+	}
+
+	if opt.errCacheTTL > 0 {
+		opt.errCache = newErrorCache(opt.clock)
+	}
+
+	if opt.maxConcurrency > 0 {
+		opt.sem = make(chan struct{}, opt.maxConcurrency)
+	}
+
+	if opt.endpointPool != nil {
+		opt.endpointPool.clock = opt.clock
+	}
+
+	if opt.microCacheTTL > 0 {
+		opt.microCache = newMicroCache(opt.clock, opt.microCacheTTL)
+	}
+
+	if opt.cache != nil || opt.microCache != nil {
+		// cached results outlive requests
+		opt.resultPool = nil
+	}
+
+	if usesCustomTransport(&opt) {
+		if opt.Client != client {
+			panic("introspection: WithCertificatePinning, WithClientCertificate and WithAddressOverride cannot be used with a caller supplied Client")
+		}
+
+		client.Transport = customTransport(&opt)
+	}
+
+	if opt.h2c {
+		if u, err := url.Parse(endpoint); err == nil && u.Scheme == "http" {
+			dialAddress := opt.dialAddress
+			// this version of http2.Transport dials without the request context, the timeout bounds dials to a blackholed server
+			dialer := &net.Dialer{Timeout: client.Timeout, KeepAlive: 30 * time.Second}
+			if dialer.Timeout <= 0 {
+				dialer.Timeout = 30 * time.Second
+			}
+			client.Transport = &http2.Transport{
+				AllowHTTP: true,
+				DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+					if dialAddress != "" {
+						addr = dialAddress
+					}
+
+					return dialer.Dial(network, addr)
+				},
+			}
+		}
+	}
+
+	return opt
+}
+
+// applyOptions returns the defaults with opts applied, and the default Client
+func applyOptions(endpoint string, opts []Option) (Options, *http.Client) {
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+	}
+
 	opt := Options{
-		Client: &http.Client{
-			Timeout: 2 * time.Second,
-		},
+		Client: client,
 		body:   url.Values{"token": {""}, "token_type_hint": {"access_token"}},
 		header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, "Accept": {"application/json"}},
 
 		endpoint: endpoint,
+
+		successStatus:  isSuccessStatus,
+		maxTokenLength: defaultMaxTokenLength,
+
+		maxResponseBytes: defaultMaxResponseBytes,
+
+		clock: SystemClock,
 	}
 
 	for _, apply := range opts {
 		apply(&opt)
 	}
 
-	return opt
+	return opt, client
+}
+
+func isSuccessStatus(code int) bool {
+	return code >= 200 && code < 300
 }
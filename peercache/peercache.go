@@ -0,0 +1,191 @@
+// Package peercache shares introspection results between replicas without an external cache, using groupcache. Each replica
+// owns part of the keyspace, a replica asks the owner of a token for its result and only the owner introspects it, once,
+// however many requests for the token arrive concurrently across replicas.
+//
+// Peers are wired with groupcache as usual, e.g. with groupcache.NewHTTPPool, and the group name must be the same on every
+// replica. Ownership is sharded by the peer picker's hash of the key, but the key itself holds the raw token: the owner needs it to
+// introspect the token, so unlike a token hash keyspace raw tokens are sent to peers, e.g. in the URLs of the requests of
+// groupcache.HTTPPool, where access logs and proxies may record them. Peers should talk over a trusted network or TLS and
+// must not log request URLs.
+package peercache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/groupcache"
+	"github.com/srikrsna/oauth-introspection"
+)
+
+var errInvalidKey = errors.New("peercache: invalid key")
+
+// Option configures an Introspector
+type Option func(*Introspector)
+
+// Clock sets the clock used to bucket and expire results, defaults to introspection.SystemClock. Replicas should have synced clocks.
+func Clock(c introspection.Clock) Option {
+	return func(i *Introspector) {
+		i.clock = c
+	}
+}
+
+// Serializer sets how results are encoded when they travel between replicas, defaults to introspection.JSONSerializer. Every
+// replica must use the same one.
+func Serializer(s introspection.Serializer) Option {
+	return func(i *Introspector) {
+		i.serializer = s
+	}
+}
+
+// Introspector is an introspection.Introspector resolving tokens through a groupcache group, see New
+type Introspector struct {
+	group    *groupcache.Group
+	upstream introspection.Introspector
+	ttl      time.Duration
+	clock    introspection.Clock
+
+	serializer introspection.Serializer
+}
+
+// New creates the groupcache group called name, holding at most cacheBytes of results, whose loader introspects tokens with
+// upstream, e.g. introspection.NewHTTPIntrospector. Use the returned Introspector with introspection.WithIntrospector.
+//
+// groupcache has no expiry, so results are cached for time buckets of length ttl, which is part of the key: a result is reused
+// until the bucket it was loaded in ends, and no longer than the token's own expiry. Older buckets are evicted as the group fills.
+// Failed introspections are not cached. New panics if ttl isn't positive or a group called name already exists.
+func New(name string, cacheBytes int64, upstream introspection.Introspector, ttl time.Duration, opts ...Option) *Introspector {
+	if ttl <= 0 {
+		panic("peercache: ttl must be positive, got " + ttl.String())
+	}
+
+	i := &Introspector{
+		upstream: upstream,
+		ttl:      ttl,
+		clock:    introspection.SystemClock,
+
+		serializer: introspection.JSONSerializer,
+	}
+
+	for _, apply := range opts {
+		apply(i)
+	}
+
+	i.group = groupcache.NewGroup(name, cacheBytes, groupcache.GetterFunc(i.load))
+
+	return i
+}
+
+// Group returns the underlying groupcache group, e.g. to read its stats
+func (i *Introspector) Group() *groupcache.Group {
+	return i.group
+}
+
+// entry is a result along with its expiry as held by the group. Results serialized as JSON are embedded in Result, others are
+// held by Data.
+type entry struct {
+	Result  json.RawMessage `json:"r,omitempty"`
+	Data    []byte          `json:"d,omitempty"`
+	Expires int64           `json:"e"`
+}
+
+// Do returns the result for token from the owning replica, introspecting it with upstream if this replica owns it
+func (i *Introspector) Do(ctx context.Context, token string) (*introspection.Result, error) {
+	now := i.clock.Now()
+	bucket := now.UnixNano() / int64(i.ttl)
+
+	var data []byte
+	if err := i.group.Get(ctx, strconv.FormatInt(bucket, 36)+":"+token, groupcache.AllocatingByteSliceSink(&data)); err != nil {
+		return nil, err
+	}
+
+	res, expires, err := i.decode(data)
+	if err != nil {
+		return i.upstream.Do(ctx, token)
+	}
+
+	if !now.Before(expires) {
+		// the token expired before the bucket ended, the cached result is stale
+		return i.upstream.Do(ctx, token)
+	}
+
+	return res, nil
+}
+
+// load is the groupcache loader, key is the bucket and the token separated by a colon
+func (i *Introspector) load(ctx context.Context, key string, dest groupcache.Sink) error {
+	sep := strings.IndexByte(key, ':')
+	if sep < 0 {
+		return errInvalidKey
+	}
+
+	bucket, err := strconv.ParseInt(key[:sep], 36, 64)
+	if err != nil {
+		return errInvalidKey
+	}
+
+	token := key[sep+1:]
+
+	res, err := i.upstream.Do(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	now := i.clock.Now()
+	if res.RetrievedAt.IsZero() {
+		res.RetrievedAt = now
+	}
+
+	expires := time.Unix(0, (bucket+1)*int64(i.ttl))
+	if exp, ok := res.EffectiveExpiry(now); ok && exp.Before(expires) {
+		expires = exp
+	}
+
+	data, err := i.encode(res, expires)
+	if err != nil {
+		return err
+	}
+
+	return dest.SetBytes(data)
+}
+
+// encode returns the entry for res expiring at expires
+func (i *Introspector) encode(res *introspection.Result, expires time.Time) ([]byte, error) {
+	data, err := i.serializer.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	e := entry{Expires: expires.UnixNano()}
+	if json.Valid(data) {
+		e.Result = data
+	} else {
+		e.Data = data
+	}
+
+	return json.Marshal(e)
+}
+
+// decode returns the result and the expiry held by an entry
+func (i *Introspector) decode(data []byte) (*introspection.Result, time.Time, error) {
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if len(e.Result) > 0 {
+		data = e.Result
+	} else {
+		data = e.Data
+	}
+
+	res, err := i.serializer.Unmarshal(data)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	return res, time.Unix(0, e.Expires), nil
+}
@@ -0,0 +1,182 @@
+package peercache_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/groupcache"
+	pb "github.com/golang/groupcache/groupcachepb"
+	"github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+	"github.com/srikrsna/oauth-introspection/peercache"
+)
+
+// groups numbers clusters, group names must be unique in a process even when tests are repeated
+var groups int32
+
+// pickers maps group names to their peer pickers, groupcache allows registering a single picker function per process
+var pickers sync.Map
+
+func init() {
+	groupcache.RegisterPerGroupPeerPicker(func(name string) groupcache.PeerPicker {
+		if p, ok := pickers.Load(name); ok {
+			return p.(groupcache.PeerPicker)
+		}
+
+		return groupcache.NoPeers{}
+	})
+}
+
+// cluster is a set of in process peers, the owner of a key is chosen by its CRC-32
+type cluster struct {
+	groups []*groupcache.Group
+}
+
+type picker struct {
+	c    *cluster
+	self int
+}
+
+func (p picker) PickPeer(key string) (groupcache.ProtoGetter, bool) {
+	owner := int(crc32.ChecksumIEEE([]byte(key)) % uint32(len(p.c.groups)))
+	if owner == p.self {
+		return nil, false
+	}
+
+	return peer{p.c.groups[owner]}, true
+}
+
+type peer struct {
+	g *groupcache.Group
+}
+
+func (p peer) Get(ctx context.Context, in *pb.GetRequest, out *pb.GetResponse) error {
+	var data []byte
+	if err := p.g.Get(ctx, in.GetKey(), groupcache.AllocatingByteSliceSink(&data)); err != nil {
+		return err
+	}
+
+	out.Value = data
+	return nil
+}
+
+type upstream struct {
+	calls int32
+	exp   int64
+}
+
+func (u *upstream) Do(ctx context.Context, token string) (*introspection.Result, error) {
+	atomic.AddInt32(&u.calls, 1)
+
+	claims := map[string]json.RawMessage{"sub": json.RawMessage(`"` + token + `"`)}
+	if u.exp != 0 {
+		data, _ := json.Marshal(u.exp)
+		claims["exp"] = data
+	}
+
+	return &introspection.Result{Active: true, Optionals: claims}, nil
+}
+
+func newCluster(up introspection.Introspector, clock introspection.Clock) []*peercache.Introspector {
+	c := &cluster{}
+	var peers []*peercache.Introspector
+
+	n := atomic.AddInt32(&groups, 1)
+	for i := 0; i < 2; i++ {
+		group := fmt.Sprintf("introspection-%d-%d", n, i)
+		pickers.Store(group, picker{c: c, self: i})
+
+		p := peercache.New(group, 1<<20, up, time.Minute, peercache.Clock(clock))
+		c.groups = append(c.groups, p.Group())
+		peers = append(peers, p)
+	}
+
+	return peers
+}
+
+func TestSingleUpstreamCall(t *testing.T) {
+	up := &upstream{}
+	peers := newCluster(up, introspectiontest.NewClock(time.Unix(1500000000, 0)))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(p *peercache.Introspector) {
+			defer wg.Done()
+
+			res, err := p.Do(context.Background(), "token")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !res.Active || string(res.Optionals["sub"]) != `"token"` {
+				t.Errorf("unexpected result %#v", res)
+			}
+		}(peers[i%2])
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&up.calls); calls != 1 {
+		t.Fatalf("expected a single upstream introspection, got %d", calls)
+	}
+}
+
+func TestBucketExpiry(t *testing.T) {
+	up := &upstream{}
+	clock := introspectiontest.NewClock(time.Unix(1500000000, 0))
+	peers := newCluster(up, clock)
+
+	peers[0].Do(context.Background(), "token")
+	peers[1].Do(context.Background(), "token")
+
+	if calls := atomic.LoadInt32(&up.calls); calls != 1 {
+		t.Fatalf("expected a single upstream introspection, got %d", calls)
+	}
+
+	clock.Advance(time.Minute)
+
+	peers[1].Do(context.Background(), "token")
+
+	if calls := atomic.LoadInt32(&up.calls); calls != 2 {
+		t.Fatalf("expected the token to be introspected again in the next bucket, got %d calls", calls)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	up := &upstream{exp: now.Add(10 * time.Second).Unix()}
+	clock := introspectiontest.NewClock(now)
+	peers := newCluster(up, clock)
+
+	peers[0].Do(context.Background(), "token")
+	clock.Advance(5 * time.Second)
+	peers[0].Do(context.Background(), "token")
+
+	if calls := atomic.LoadInt32(&up.calls); calls != 1 {
+		t.Fatalf("expected the cached result to be used before exp, got %d calls", calls)
+	}
+
+	clock.Advance(5 * time.Second)
+	peers[0].Do(context.Background(), "token")
+
+	if calls := atomic.LoadInt32(&up.calls); calls != 2 {
+		t.Fatalf("expected a stale result to be treated as a miss, got %d calls", calls)
+	}
+}
+
+func TestInvalidTTL(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected New to panic on a zero ttl")
+		}
+	}()
+
+	peercache.New(fmt.Sprintf("introspection-%d-ttl", atomic.AddInt32(&groups, 1)), 1<<20, &upstream{}, 0)
+}
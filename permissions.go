@@ -0,0 +1,109 @@
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrNoPermissions is returned by Result.Permissions when the result carries no permissions claim
+	ErrNoPermissions = errors.New("result has no permissions")
+	// ErrPermissionDenied is returned when the token lacks a permission required by RequirePermission
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Permission is a UMA permission as found in the introspection response of a Keycloak requesting party token
+type Permission struct {
+	ResourceID   string   `json:"rsid"`
+	ResourceName string   `json:"rsname"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// Permissions decodes the permissions claim, taken from the top level of the response or from the authorization member,
+// where Keycloak places it for requesting party tokens. It returns ErrNoPermissions when neither is present.
+func (r *Result) Permissions() ([]Permission, error) {
+	raw, ok := r.Optionals["permissions"]
+	if !ok {
+		var authz struct {
+			Permissions json.RawMessage `json:"permissions"`
+		}
+
+		if val, found := r.Optionals["authorization"]; found {
+			if err := json.Unmarshal(val, &authz); err != nil {
+				return nil, fmt.Errorf("invalid authorization claim: %v", err)
+			}
+		}
+
+		raw, ok = authz.Permissions, authz.Permissions != nil
+	}
+
+	if !ok || string(raw) == "null" {
+		return nil, ErrNoPermissions
+	}
+
+	perms := []Permission{}
+	if err := json.Unmarshal(raw, &perms); err != nil {
+		return nil, fmt.Errorf("invalid permissions claim: %v", err)
+	}
+
+	return perms, nil
+}
+
+// HasPermission reports whether the token is permitted all of scopes on resource, matched against the resource name or id
+func (r *Result) HasPermission(resource string, scopes ...string) bool {
+	perms, err := r.Permissions()
+	if err != nil {
+		return false
+	}
+
+	for _, p := range perms {
+		if (p.ResourceName == resource || p.ResourceID == resource) && containsAll(p.Scopes, scopes) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequirePermission returns a middleware that rejects requests unless the introspection result in their context is active and
+// permitted all of scopes on resource, see Result.HasPermission. Requests lacking the permission get a 403.
+// It must be used behind the Introspection middleware, otherwise every request is rejected.
+func RequirePermission(resource string, scopes ...string) func(http.Handler) http.Handler {
+	return requirement(requirePermission(resource, scopes))
+}
+
+func requirePermission(resource string, scopes []string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		res, err := Authorize(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !res.HasPermission(resource, scopes...) {
+			return ErrPermissionDenied
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+// keycloakRPT is shaped after the introspection response Keycloak returns for a requesting party token
+const keycloakRPT = `{
+	"exp": 32503680000,
+	"iat": 1500000000,
+	"jti": "4a7d8c4e-1b2f-4f0e-9d55-0a8c0e2b1f3d",
+	"iss": "https://keycloak.example.com/realms/demo",
+	"aud": "photoz-restful-api",
+	"sub": "0a9b3c2d-5e6f-4a1b-8c7d-9e0f1a2b3c4d",
+	"typ": "Bearer",
+	"azp": "photoz-html5-client",
+	"session_state": "b1c2d3e4-f5a6-4b7c-8d9e-0f1a2b3c4d5e",
+	"scope": "profile email",
+	"authorization": {
+		"permissions": [
+			{"scopes": ["album:view", "album:delete"], "rsid": "a7f2c9e0-3b4d-4e5f-8a9b-0c1d2e3f4a5b", "rsname": "Album Resource"},
+			{"rsid": "c3d4e5f6-a7b8-4c9d-0e1f-2a3b4c5d6e7f", "rsname": "Default Resource"}
+		]
+	},
+	"client_id": "photoz-html5-client",
+	"username": "alice",
+	"active": true
+}`
+
+// keycloakIntrospect is shaped after the response of Keycloak's token introspection for RPTs when permissions are at the top level
+const keycloakIntrospect = `{
+	"active": true,
+	"exp": 32503680000,
+	"sub": "0a9b3c2d-5e6f-4a1b-8c7d-9e0f1a2b3c4d",
+	"permissions": [
+		{"resource_id": "ignored", "rsid": "a7f2c9e0-3b4d-4e5f-8a9b-0c1d2e3f4a5b", "rsname": "Album Resource", "scopes": ["album:view"]}
+	]
+}`
+
+func resultFrom(t *testing.T, body string) *intro.Result {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	res, err := intro.NewHTTPIntrospector(ts.URL).Do(context.Background(), "token")
+	ok(t, err)
+
+	return res
+}
+
+func TestPermissions(t *testing.T) {
+	t.Run("Nested", func(t *testing.T) {
+		perms, err := resultFrom(t, keycloakRPT).Permissions()
+
+		ok(t, err)
+		equals(t, []intro.Permission{
+			{ResourceID: "a7f2c9e0-3b4d-4e5f-8a9b-0c1d2e3f4a5b", ResourceName: "Album Resource", Scopes: []string{"album:view", "album:delete"}},
+			{ResourceID: "c3d4e5f6-a7b8-4c9d-0e1f-2a3b4c5d6e7f", ResourceName: "Default Resource"},
+		}, perms)
+	})
+
+	t.Run("Top Level", func(t *testing.T) {
+		perms, err := resultFrom(t, keycloakIntrospect).Permissions()
+
+		ok(t, err)
+		equals(t, []intro.Permission{
+			{ResourceID: "a7f2c9e0-3b4d-4e5f-8a9b-0c1d2e3f4a5b", ResourceName: "Album Resource", Scopes: []string{"album:view"}},
+		}, perms)
+	})
+
+	tt := []struct {
+		name   string
+		claims map[string]json.RawMessage
+		perms  []intro.Permission
+		err    error
+		fails  bool
+	}{
+		{name: "Missing", claims: map[string]json.RawMessage{"sub": json.RawMessage(`"user"`)}, err: intro.ErrNoPermissions},
+		{name: "Authorization Without Permissions", claims: map[string]json.RawMessage{"authorization": json.RawMessage(`{}`)}, err: intro.ErrNoPermissions},
+		{name: "Null", claims: map[string]json.RawMessage{"permissions": json.RawMessage(`null`)}, err: intro.ErrNoPermissions},
+		{name: "Empty", claims: map[string]json.RawMessage{"permissions": json.RawMessage(`[]`)}, perms: []intro.Permission{}},
+		{name: "Malformed", claims: map[string]json.RawMessage{"permissions": json.RawMessage(`"album"`)}, fails: true},
+		{name: "Malformed Authorization", claims: map[string]json.RawMessage{"authorization": json.RawMessage(`[]`)}, fails: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := intro.Result{Active: true, Optionals: tc.claims}
+
+			perms, err := res.Permissions()
+
+			if tc.fails {
+				assert(t, err != nil && err != intro.ErrNoPermissions, "malformed permissions should fail with a descriptive error, got %v", err)
+				return
+			}
+
+			equals(t, tc.err, err)
+			equals(t, tc.perms, perms)
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		switch r.PostFormValue("token") {
+		case "rpt":
+			w.Write([]byte(keycloakRPT))
+		case "inactive":
+			w.Write([]byte(`{"active": false}`))
+		default:
+			w.Write([]byte(`{"active": true}`))
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		token    string
+		resource string
+		scopes   []string
+		status   int
+	}{
+		{name: "By Name", token: "rpt", resource: "Album Resource", scopes: []string{"album:view"}, status: http.StatusOK},
+		{name: "By ID", token: "rpt", resource: "a7f2c9e0-3b4d-4e5f-8a9b-0c1d2e3f4a5b", scopes: []string{"album:view", "album:delete"}, status: http.StatusOK},
+		{name: "Resource Only", token: "rpt", resource: "Default Resource", status: http.StatusOK},
+		{name: "Missing Scope", token: "rpt", resource: "Default Resource", scopes: []string{"album:view"}, status: http.StatusForbidden},
+		{name: "Unknown Resource", token: "rpt", resource: "Photo Resource", status: http.StatusForbidden},
+		{name: "No Permissions", token: "plain", resource: "Album Resource", status: http.StatusForbidden},
+		{name: "Inactive", token: "inactive", resource: "Album Resource", status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			h := intro.Introspection(ts.URL)(intro.RequirePermission(tc.resource, tc.scopes...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+			equals(t, tc.status, serveStatus(h, tc.token))
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package introspection
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// ErrPinMismatch fails connections to an authorization server whose certificates match none of the pins, see WithCertificatePinning
+var ErrPinMismatch = errors.New("introspection: no certificate of the authorization server matches a pinned public key")
+
+// WithCertificatePinning pins the public keys of the authorization server: TLS connections of the package built client are only
+// accepted when a certificate of the verified chain has a Subject Public Key Info whose SHA-256 hash is one of pins, otherwise the
+// introspection fails with ErrPinMismatch. Pins are base64 encoded, as produced by
+//
+//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+//
+// Passing the current and the next key allows rotating it without downtime. The transport is a clone of http.DefaultTransport, the
+// chain is still verified as usual. Pass the same option to EndpointFromDiscovery to pin the discovery request. It panics if a pin
+// is not a base64 encoded SHA-256 hash, or when used with a caller supplied Client.
+func WithCertificatePinning(pins []string) Option {
+	hashes := make(map[[sha256.Size]byte]bool, len(pins))
+	for _, pin := range pins {
+		raw, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(raw) != sha256.Size {
+			panic("introspection: invalid certificate pin " + pin)
+		}
+
+		var hash [sha256.Size]byte
+		copy(hash[:], raw)
+		hashes[hash] = true
+	}
+
+	return func(opt *Options) {
+		opt.pins = hashes
+	}
+}
@@ -0,0 +1,113 @@
+package introspection_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestCertificatePinning(t *testing.T) {
+	ca := newTestCA(t)
+	pinnedCert := ca.issue(t, "127.0.0.1")
+	otherCert := ca.issue(t, "127.0.0.1")
+
+	// both servers are trusted, the pinned transport is cloned from http.DefaultTransport
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}
+	defer func() { http.DefaultTransport = defaultTransport }()
+
+	serve := func(cert tls.Certificate) *httptest.Server {
+		ts := httptest.NewUnstartedServer(nil)
+		ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Content-Type", "application/json")
+
+			if r.URL.Path == "/.well-known/openid-configuration" {
+				w.Write([]byte(`{"introspection_endpoint": "` + ts.URL + `/introspect"}`))
+				return
+			}
+
+			w.Write([]byte(`{"active": true}`))
+		})
+		ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+		ts.StartTLS()
+
+		return ts
+	}
+
+	pinned := serve(pinnedCert)
+	defer pinned.Close()
+
+	other := serve(otherCert)
+	defer other.Close()
+
+	pin := spkiPin(pinnedCert)
+	pinning := intro.WithCertificatePinning([]string{pin})
+
+	t.Run("Pinned Key", func(t *testing.T) {
+		res, err := intro.FromContext(introspectedContextAt(t, pinned.URL, pinning))
+
+		ok(t, err)
+		equals(t, true, res.Active)
+	})
+
+	t.Run("Other Key", func(t *testing.T) {
+		_, err := intro.FromContext(introspectedContextAt(t, other.URL, pinning))
+
+		assert(t, errors.Is(err, intro.ErrPinMismatch), "expected ErrPinMismatch, got %v", err)
+	})
+
+	t.Run("Unpinned", func(t *testing.T) {
+		res, err := intro.FromContext(introspectedContextAt(t, other.URL))
+
+		ok(t, err)
+		equals(t, true, res.Active)
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		rotating := intro.WithCertificatePinning([]string{spkiPin(otherCert), pin})
+
+		_, err := intro.FromContext(introspectedContextAt(t, pinned.URL, rotating))
+		ok(t, err)
+
+		_, err = intro.FromContext(introspectedContextAt(t, other.URL, rotating))
+		ok(t, err)
+	})
+
+	t.Run("Discovery", func(t *testing.T) {
+		endpoint, err := intro.EndpointFromDiscovery(pinned.URL, pinning)
+		ok(t, err)
+		equals(t, pinned.URL+"/introspect", endpoint)
+
+		_, err = intro.EndpointFromDiscovery(other.URL, pinning)
+		assert(t, errors.Is(err, intro.ErrPinMismatch), "expected ErrPinMismatch, got %v", err)
+	})
+
+	t.Run("Invalid Pin", func(t *testing.T) {
+		defer func() {
+			assert(t, recover() != nil, "invalid pin should panic")
+		}()
+
+		intro.WithCertificatePinning([]string{"not a pin"})
+	})
+
+	t.Run("Custom Client", func(t *testing.T) {
+		defer func() {
+			assert(t, recover() != nil, "should have panicked")
+		}()
+
+		intro.Introspection(pinned.URL, pinning, func(opt *intro.Options) {
+			opt.Client = &http.Client{}
+		})
+	})
+}
+
+func spkiPin(cert tls.Certificate) string {
+	sum := sha256.Sum256(cert.Leaf.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,48 @@
+package introspection
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// WithResultPool makes the HTTP middleware reuse Results, and their Optionals maps, across requests to reduce allocations.
+// A Result freshly obtained from the introspection endpoint is returned to the pool once the next handler, and the access log,
+// have returned, after which it is cleared and handed to another request.
+//
+// Handlers, validators and hooks must therefore not retain the Result, its Optionals, or the slices backing them beyond the
+// request, e.g. by passing them to a goroutine that outlives the handler; copy what is needed instead. Results served from the
+// cache, the JWT validator or an Introspector are never pooled, and the option has no effect together with WithCache.
+// The gRPC AuthFunc has no hook to release Results, they are left to the garbage collector there.
+func WithResultPool() Option {
+	return func(opt *Options) {
+		opt.resultPool = &sync.Pool{
+			New: func() interface{} {
+				return &Result{Optionals: make(map[string]json.RawMessage)}
+			},
+		}
+	}
+}
+
+// newResult returns an empty Result, from the pool if WithResultPool is used
+func newResult(opt *Options) *Result {
+	if opt.resultPool == nil {
+		return &Result{Optionals: make(map[string]json.RawMessage)}
+	}
+
+	return opt.resultPool.Get().(*Result)
+}
+
+// releaseResult clears res and returns it to the pool, if WithResultPool is used
+func releaseResult(opt *Options, res *Result) {
+	if opt.resultPool == nil {
+		return
+	}
+
+	for k := range res.Optionals {
+		delete(res.Optionals, k)
+	}
+
+	*res = Result{Optionals: res.Optionals}
+
+	opt.resultPool.Put(res)
+}
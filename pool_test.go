@@ -0,0 +1,114 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+// staticTransport answers every request with body without touching the network
+type staticTransport string
+
+func (body staticTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    r,
+	}, nil
+}
+
+func withTransport(rt http.RoundTripper) intro.Option {
+	return func(opt *intro.Options) {
+		opt.Client = &http.Client{Transport: rt}
+	}
+}
+
+const pooledResponse = `{"active":true,"sub":"user","scope":"read write","client_id":"client","exp":32503680000}`
+
+func TestResultPool(t *testing.T) {
+	var kept *intro.Result
+	var logged intro.AccessLogEntry
+
+	inner := intro.Introspection("https://as.example.com/introspect", intro.WithResultPool(), withTransport(staticTransport(pooledResponse)))
+	outer := intro.Introspection("https://as.example.com/introspect",
+		intro.WithResultPool(),
+		withTransport(staticTransport(pooledResponse)),
+		intro.WithAccessLog(func(e intro.AccessLogEntry) { logged = e }),
+	)
+
+	h := outer(inner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := intro.FromContext(r.Context())
+		ok(t, err)
+
+		kept = res
+
+		equals(t, true, res.Active)
+		equals(t, json.RawMessage(`"user"`), res.Optionals["sub"])
+		equals(t, []string{"read", "write"}, res.Scopes())
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// the nested middleware must not release the result while the outer chain still uses it
+	equals(t, "user", logged.Subject)
+	equals(t, []string{"read", "write"}, logged.Scopes)
+
+	// the result has been released once the request completed
+	equals(t, false, kept.Active)
+	equals(t, 0, len(kept.Optionals))
+}
+
+func TestResultPoolWithCache(t *testing.T) {
+	var kept *intro.Result
+
+	h := intro.Introspection("https://as.example.com/introspect",
+		intro.WithResultPool(),
+		intro.WithCache(intro.NewInMemoryCache(), time.Minute),
+		withTransport(staticTransport(pooledResponse)),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kept, _ = intro.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	equals(t, true, kept.Active)
+	equals(t, json.RawMessage(`"user"`), kept.Optionals["sub"])
+}
+
+func benchmarkMiddleware(b *testing.B, opts ...intro.Option) {
+	h := intro.Introspection("https://as.example.com/introspect", append(opts, withTransport(staticTransport(pooledResponse)))...)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkResultPool(b *testing.B) {
+	b.Run("Unpooled", func(b *testing.B) {
+		benchmarkMiddleware(b)
+	})
+
+	b.Run("Pooled", func(b *testing.B) {
+		benchmarkMiddleware(b, intro.WithResultPool())
+	})
+}
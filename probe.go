@@ -0,0 +1,92 @@
+package introspection
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// maxProbeMemo bounds the number of tokens whose probed hint is remembered, the memo is cleared when it is reached
+const maxProbeMemo = 4096
+
+// WithProbeTokenTypes introspects tokens with each of hints as token_type_hint in turn until the token is active or every hint was
+// tried, for servers that only recognise tokens of the hinted type, e.g. WithProbeTokenTypes("access_token", "refresh_token").
+// Only the final result is cached. The hint a token was found active with is remembered, later introspections of the token, e.g.
+// once its cache entry expired, try it first. Tokens WithAutoTokenTypeHint derives a hint for are not probed.
+func WithProbeTokenTypes(hints ...string) Option {
+	return func(opt *Options) {
+		opt.probe = &tokenTypeProbe{hints: append([]string(nil), hints...), memo: make(map[string]string)}
+	}
+}
+
+type tokenTypeProbe struct {
+	hints []string
+
+	mu   sync.Mutex
+	memo map[string]string
+}
+
+// introspect posts body with each hint until token is active, the request with the first hint is sent with etag
+func (p *tokenTypeProbe) introspect(ctx context.Context, token string, body url.Values, etag string, opt *Options) (*Result, error) {
+	key := string(hashToken(token))
+
+	var res *Result
+	for _, hint := range p.order(key) {
+		if res != nil {
+			releaseResult(opt, res)
+		}
+
+		body.Set("token_type_hint", hint)
+
+		var err error
+		if res, err = post(ctx, body, etag, opt); err != nil {
+			return nil, err
+		}
+
+		if res.Active {
+			p.remember(key, hint)
+			return res, nil
+		}
+
+		etag = ""
+	}
+
+	return res, nil
+}
+
+// order returns the hints to try for the token with key, the one it was last found active with first
+func (p *tokenTypeProbe) order(key string) []string {
+	p.mu.Lock()
+	known, ok := p.memo[key]
+	p.mu.Unlock()
+
+	if !ok {
+		return p.hints
+	}
+
+	hints := append(make([]string, 0, len(p.hints)), known)
+	for _, hint := range p.hints {
+		if hint != known {
+			hints = append(hints, hint)
+		}
+	}
+
+	return hints
+}
+
+// remember records that the token with key is active with hint, only hints tried later than first by default are kept
+func (p *tokenTypeProbe) remember(key, hint string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if hint == p.hints[0] {
+		delete(p.memo, key)
+		return
+	}
+
+	if len(p.memo) >= maxProbeMemo {
+		p.memo = make(map[string]string)
+	}
+
+	p.memo[key] = hint
+}
@@ -0,0 +1,93 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestProbeTokenTypes(t *testing.T) {
+	var hints []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hint := r.PostFormValue("token_type_hint")
+		hints = append(hints, hint)
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": r.PostFormValue("token") == hint,
+		})
+	}))
+	defer ts.Close()
+
+	probe := intro.WithProbeTokenTypes("access_token", "refresh_token")
+
+	serve := func(mw func(http.Handler) http.Handler, token string) *intro.Result {
+		var res *intro.Result
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			res, err = intro.FromContext(r.Context())
+			ok(t, err)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res
+	}
+
+	t.Run("First Hint", func(t *testing.T) {
+		hints = nil
+
+		equals(t, true, serve(intro.Introspection(ts.URL, probe), "access_token").Active)
+		equals(t, []string{"access_token"}, hints)
+	})
+
+	t.Run("Second Hint", func(t *testing.T) {
+		hints = nil
+
+		equals(t, true, serve(intro.Introspection(ts.URL, probe), "refresh_token").Active)
+		equals(t, []string{"access_token", "refresh_token"}, hints)
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		hints = nil
+
+		equals(t, false, serve(intro.Introspection(ts.URL, probe), "unknown").Active)
+		equals(t, []string{"access_token", "refresh_token"}, hints)
+	})
+
+	t.Run("Remembered Hint", func(t *testing.T) {
+		hints = nil
+
+		mw := intro.Introspection(ts.URL, probe)
+		equals(t, true, serve(mw, "refresh_token").Active)
+		equals(t, true, serve(mw, "refresh_token").Active)
+
+		equals(t, []string{"access_token", "refresh_token", "refresh_token"}, hints)
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		hints = nil
+
+		mw := intro.Introspection(ts.URL, probe, intro.WithCache(intro.NewInMemoryCache(), time.Minute))
+		equals(t, true, serve(mw, "refresh_token").Active)
+		equals(t, true, serve(mw, "refresh_token").Active)
+
+		equals(t, []string{"access_token", "refresh_token"}, hints)
+	})
+
+	t.Run("Auto Hint", func(t *testing.T) {
+		hints = nil
+
+		auto := intro.WithAutoTokenTypeHint(func(string) string { return "access_token" })
+
+		equals(t, false, serve(intro.Introspection(ts.URL, probe, auto), "refresh_token").Active)
+		equals(t, []string{"access_token"}, hints)
+	})
+}
@@ -0,0 +1,105 @@
+package introspection
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequireActive returns a middleware that rejects requests, in the same way WithEnforcement does, unless the introspection
+// result in their context is active. It must be used behind the Introspection middleware, otherwise every request is rejected.
+func RequireActive() func(http.Handler) http.Handler {
+	return requirement(requireActive)
+}
+
+// RequireScopes returns a middleware that rejects requests unless the introspection result in their context is active and has all
+// of scopes. It must be used behind the Introspection middleware, otherwise every request is rejected. Requests lacking scopes get a
+// 403 whose WWW-Authenticate challenge lists scopes in its scope parameter, as per rfc6750 section 3.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return requirement(requireScopes(scopes))
+}
+
+// RequireAllScopes is RequireScopes
+func RequireAllScopes(scopes ...string) func(http.Handler) http.Handler {
+	return RequireScopes(scopes...)
+}
+
+// RequireAnyScope returns a middleware that rejects requests unless the introspection result in their context is active and has at
+// least one of scopes. It must be used behind the Introspection middleware, otherwise every request is rejected. The challenge of
+// the 403 lists scopes like RequireScopes does.
+func RequireAnyScope(scopes ...string) func(http.Handler) http.Handler {
+	return requirement(requireAnyScope(scopes))
+}
+
+// RequireAudience returns a middleware that rejects requests unless the introspection result in their context is active and its
+// aud claim contains aud, compared as by WithRequiredAudience. It must be used behind the Introspection middleware, otherwise
+// every request is rejected. Unlike WithRequiredAudience it lets route groups sharing one Introspection middleware require
+// different audiences.
+func RequireAudience(aud string, normalized bool) func(http.Handler) http.Handler {
+	return requirement(requireAudience(aud, normalized))
+}
+
+func requireActive(ctx context.Context) error {
+	_, err := Authorize(ctx)
+	return err
+}
+
+func requireScopes(scopes []string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := Authorize(ctx, scopes...)
+		if err == ErrInsufficientScope {
+			return &insufficientScope{scopes: scopes}
+		}
+
+		return err
+	}
+}
+
+func requireAnyScope(scopes []string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		res, err := Authorize(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !res.HasAnyScope(scopes...) {
+			return &insufficientScope{scopes: scopes}
+		}
+
+		return nil
+	}
+}
+
+func requireAudience(aud string, normalized bool) func(context.Context) error {
+	return func(ctx context.Context) error {
+		res, err := Authorize(ctx)
+		if err != nil {
+			return err
+		}
+
+		return checkAudience(res, aud, normalized)
+	}
+}
+
+func requirement(check func(context.Context) error) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, err := challengeScopes(check(r.Context()))
+			if err != nil && !shadowed(r.Context(), err) {
+				if val, ok := r.Context().Value(resKey).(*result); ok && val.proxy {
+					writeProxyError(w, err, scopes)
+					return
+				}
+
+				if scopes != nil {
+					writeScopeError(w, scopes)
+					return
+				}
+
+				writeError(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package introspection
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OverloadedError is returned by FromContext when the introspection endpoint responded with 429 Too Many Requests or
+// 503 Service Unavailable along with a valid Retry-After header
+type OverloadedError struct {
+	// StatusCode is the status the introspection endpoint responded with
+	StatusCode int
+	// RetryAt is the time from which the introspection endpoint asked to be retried
+	RetryAt time.Time
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("status does not indicate success: code: %d, retry after: %s", e.StatusCode, e.RetryAt.UTC().Format(http.TimeFormat))
+}
+
+// WithPropagateRetryAfter makes the middleware answer requests whose introspection failed with an OverloadedError with status,
+// typically 503, and a Retry-After header telling the client when to retry, instead of rejecting or passing them on.
+// It applies whether or not enforcement is enabled.
+func WithPropagateRetryAfter(status int) Option {
+	return func(opt *Options) {
+		opt.retryAfterStatus = status
+	}
+}
+
+// overloadedError returns an OverloadedError for a response with code and the Retry-After header value v, or nil if the response
+// doesn't qualify
+func overloadedError(code int, v string, now time.Time) error {
+	if code != http.StatusTooManyRequests && code != http.StatusServiceUnavailable {
+		return nil
+	}
+
+	at, ok := parseRetryAfter(v, now)
+	if !ok {
+		return nil
+	}
+
+	return &OverloadedError{StatusCode: code, RetryAt: at}
+}
+
+// parseRetryAfter parses a Retry-After header value, either delay-seconds or an HTTP-date, as per rfc9110 section 10.2.3
+func parseRetryAfter(v string, now time.Time) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	if sec, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return now.Add(time.Duration(sec) * time.Second), true
+	}
+
+	at, err := http.ParseTime(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if at.Before(now) {
+		at = now
+	}
+
+	return at, true
+}
+
+// writeRetryAfter answers with status and a Retry-After header in delay-seconds
+func writeRetryAfter(w http.ResponseWriter, status int, err *OverloadedError, now time.Time) {
+	delay := int64(math.Ceil(err.RetryAt.Sub(now).Seconds()))
+	if delay < 0 {
+		delay = 0
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(delay, 10))
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,78 @@
+package introspection_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestPropagateRetryAfter(t *testing.T) {
+	now := time.Date(2024, 4, 25, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name       string
+		status     int
+		retryAfter string
+		opts       []intro.Option
+		code       int
+		header     string
+		called     bool
+	}{
+		{name: "Delay Seconds", status: http.StatusServiceUnavailable, retryAfter: "120", code: http.StatusServiceUnavailable, header: "120"},
+		{name: "HTTP Date", status: http.StatusTooManyRequests, retryAfter: now.Add(90 * time.Second).Format(http.TimeFormat), code: http.StatusServiceUnavailable, header: "90"},
+		{name: "Past HTTP Date", status: http.StatusServiceUnavailable, retryAfter: now.Add(-time.Minute).Format(http.TimeFormat), code: http.StatusServiceUnavailable, header: "0"},
+		{name: "Configured Status", status: http.StatusTooManyRequests, retryAfter: "5", opts: []intro.Option{intro.WithPropagateRetryAfter(http.StatusTooManyRequests)}, code: http.StatusTooManyRequests, header: "5"},
+		{name: "Enforced", status: http.StatusServiceUnavailable, retryAfter: "1", opts: []intro.Option{intro.WithEnforcement()}, code: http.StatusServiceUnavailable, header: "1"},
+		{name: "Invalid Retry After", status: http.StatusServiceUnavailable, retryAfter: "soon", code: http.StatusOK, called: true},
+		{name: "No Retry After", status: http.StatusServiceUnavailable, code: http.StatusOK, called: true},
+		{name: "Other Status", status: http.StatusInternalServerError, retryAfter: "120", code: http.StatusOK, called: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			opts := append([]intro.Option{intro.WithClock(introspectiontest.NewClock(now)), intro.WithPropagateRetryAfter(http.StatusServiceUnavailable)}, tc.opts...)
+
+			req, rec := httptest.NewRequest("GET", "/", nil), httptest.NewRecorder()
+			req.Header.Add("Authorization", "Bearer token")
+
+			called := false
+			intro.Introspection(ts.URL, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			})).ServeHTTP(rec, req)
+
+			equals(t, tc.called, called)
+			equals(t, tc.code, rec.Code)
+			equals(t, tc.header, rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestOverloadedError(t *testing.T) {
+	now := time.Date(2024, 4, 25, 12, 0, 0, 0, time.UTC)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx := introspectedContextAt(t, ts.URL, intro.WithClock(introspectiontest.NewClock(now)))
+
+	_, err := intro.FromContext(ctx)
+
+	oe, isOverloaded := err.(*intro.OverloadedError)
+	assert(t, isOverloaded, "error should be an OverloadedError: %v", err)
+	equals(t, &intro.OverloadedError{StatusCode: http.StatusTooManyRequests, RetryAt: now.Add(30 * time.Second)}, oe)
+}
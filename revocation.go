@@ -0,0 +1,43 @@
+package introspection
+
+import "encoding/json"
+
+// RevocationSet tells whether tokens have been revoked, e.g. fed by a push based revocation feed. See WithRevocationSet.
+type RevocationSet interface {
+	// IsRevoked reports whether the token identified by jti was revoked. It is called on every request and should be fast.
+	IsRevoked(jti string) bool
+}
+
+// RevocationSetFunc adapts an ordinary function to a RevocationSet
+type RevocationSetFunc func(jti string) bool
+
+// IsRevoked calls f(jti)
+func (f RevocationSetFunc) IsRevoked(jti string) bool {
+	return f(jti)
+}
+
+// WithRevocationSet treats active tokens whose jti claim is in set as inactive, whether their result is fresh or served from
+// the cache. This lets a revocation take effect immediately instead of once the cached result expires. Tokens without a jti
+// claim are never considered revoked.
+func WithRevocationSet(set RevocationSet) Option {
+	return func(opt *Options) {
+		opt.revocations = set
+	}
+}
+
+// revoked returns an inactive result in place of res if res is active and its jti is in the revocation set, otherwise res
+func revoked(res *Result, opt *Options) *Result {
+	if opt.revocations == nil || !res.Active {
+		return res
+	}
+
+	if jti := res.stringClaim("jti"); jti == "" || !opt.revocations.IsRevoked(jti) {
+		return res
+	}
+
+	return &Result{
+		Optionals:   make(map[string]json.RawMessage),
+		RetrievedAt: res.RetrievedAt,
+		FromCache:   res.FromCache,
+	}
+}
@@ -0,0 +1,84 @@
+package introspection_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestRevocationSet(t *testing.T) {
+	calls := 0
+	ts := openIdServer(t, func(r *http.Request) bool {
+		calls++
+		return true
+	}, map[string]interface{}{"jti": "token-1", "sub": "alice"})
+	defer ts.Close()
+
+	var mu sync.Mutex
+	revoked := map[string]bool{}
+
+	set := intro.RevocationSetFunc(func(jti string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return revoked[jti]
+	})
+
+	h := intro.Introspection(ts.URL+"/introspect", intro.WithCache(intro.NewInMemoryCache(), time.Minute), intro.WithRevocationSet(set))
+
+	serve := func() *intro.Result {
+		var res *intro.Result
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Add("Authorization", "Bearer token")
+
+		h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			res, err = intro.FromContext(r.Context())
+			ok(t, err)
+		})).ServeHTTP(httptest.NewRecorder(), req)
+
+		return res
+	}
+
+	res := serve()
+	assert(t, res.Active, "token should be active before it is revoked")
+
+	res = serve()
+	assert(t, res.Active && res.FromCache, "token should be active and served from the cache")
+
+	mu.Lock()
+	revoked["token-1"] = true
+	mu.Unlock()
+
+	res = serve()
+	assert(t, !res.Active, "revoked token should be inactive even though it is cached")
+	assert(t, res.FromCache, "revoked result should still come from the cache")
+	equals(t, 0, len(res.Optionals))
+
+	equals(t, 1, calls)
+}
+
+func TestRevocationSetWithoutJTI(t *testing.T) {
+	ts := openIdServer(t, func(r *http.Request) bool { return true }, nil)
+	defer ts.Close()
+
+	called := false
+	set := intro.RevocationSetFunc(func(jti string) bool {
+		called = true
+		return true
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Add("Authorization", "Bearer token")
+
+	intro.Introspection(ts.URL+"/introspect", intro.WithEnforcement(), intro.WithRevocationSet(set))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+
+	equals(t, http.StatusOK, rec.Code)
+	assert(t, !called, "revocation set should not be consulted for tokens without jti")
+}
@@ -0,0 +1,22 @@
+package introspection
+
+import "net/http"
+
+// RouteByClaim returns a handler dispatching requests to the handler in routes keyed by the value of the string claim in the
+// introspection result, e.g. a tenant id. Requests whose result lacks the claim, has no matching route or failed introspection
+// are served by fallback. It must be used behind the Introspection middleware.
+func RouteByClaim(claim string, routes map[string]http.Handler, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, err := FromContext(r.Context())
+		if err == nil && res.Active {
+			if val := res.stringClaim(claim); val != "" {
+				if h, ok := routes[val]; ok {
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		fallback.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestRouteByClaim(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		switch token := r.PostFormValue("token"); token {
+		case "inactive":
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false, "tenant": "acme"})
+		case "none":
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "tenant": token})
+		}
+	}))
+	defer ts.Close()
+
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		})
+	}
+
+	h := intro.Introspection(ts.URL)(intro.RouteByClaim("tenant", map[string]http.Handler{
+		"acme":   named("acme"),
+		"globex": named("globex"),
+	}, named("fallback")))
+
+	tt := []struct {
+		name   string
+		token  string
+		served string
+	}{
+		{name: "First Route", token: "acme", served: "acme"},
+		{name: "Second Route", token: "globex", served: "globex"},
+		{name: "Unknown Value", token: "initech", served: "fallback"},
+		{name: "Absent Claim", token: "none", served: "fallback"},
+		{name: "Inactive", token: "inactive", served: "fallback"},
+		{name: "No Token", served: "fallback"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.token != "" {
+				req.Header.Add("Authorization", "Bearer "+tc.token)
+			}
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			equals(t, tc.served, rr.Body.String())
+		})
+	}
+}
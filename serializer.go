@@ -0,0 +1,66 @@
+package introspection
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Serializer encodes results for caches that keep them outside the process, such as the filecache and peercache packages.
+// Only the exported fields of Result need to survive a round trip.
+type Serializer interface {
+	// Marshal encodes res
+	Marshal(res *Result) ([]byte, error)
+	// Unmarshal decodes a result encoded by Marshal
+	Unmarshal(data []byte) (*Result, error)
+}
+
+// JSONSerializer is the Serializer encoding results as JSON, it is used unless another one is configured
+var JSONSerializer Serializer = jsonSerializer{}
+
+// GobSerializer is the Serializer encoding results with encoding/gob, which is more compact and faster to decode than JSON
+var GobSerializer Serializer = gobSerializer{}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(res *Result) ([]byte, error) {
+	return json.Marshal(res)
+}
+
+func (jsonSerializer) Unmarshal(data []byte) (*Result, error) {
+	var res Result
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	return serializedResult(&res), nil
+}
+
+type gobSerializer struct{}
+
+func (gobSerializer) Marshal(res *Result) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(res); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobSerializer) Unmarshal(data []byte) (*Result, error) {
+	var res Result
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	return serializedResult(&res), nil
+}
+
+// serializedResult restores the invariants of a decoded result that its encoding may not preserve, gob omits empty maps
+func serializedResult(res *Result) *Result {
+	if res.Optionals == nil {
+		res.Optionals = make(map[string]json.RawMessage)
+	}
+
+	return res
+}
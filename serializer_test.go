@@ -0,0 +1,55 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestSerializers(t *testing.T) {
+	full := &intro.Result{
+		Active:    true,
+		Scope:     "read write",
+		ClientID:  "client",
+		Username:  "user",
+		TokenType: "Bearer",
+		Exp:       1500003600,
+		Iat:       1500000000,
+		Nbf:       1500000000,
+		Sub:       "user",
+		Aud:       []string{"api", "admin"},
+		Iss:       "https://as.example.com",
+		Jti:       "id",
+		Optionals: map[string]json.RawMessage{
+			"sub":       json.RawMessage(`"user"`),
+			"tenant_id": json.RawMessage(`"acme"`),
+			"groups":    json.RawMessage(`["admin","dev"]`),
+			"profile":   json.RawMessage(`{"name":"User","age":42}`),
+		},
+		RetrievedAt: time.Unix(1500000000, 0).UTC(),
+		ETag:        `"v1"`,
+		Binding:     "session",
+		ExpDerived:  true,
+	}
+
+	empty := &intro.Result{Optionals: map[string]json.RawMessage{}}
+
+	for name, s := range map[string]intro.Serializer{"JSON": intro.JSONSerializer, "Gob": intro.GobSerializer} {
+		t.Run(name, func(t *testing.T) {
+			for _, res := range []*intro.Result{full, empty} {
+				data, err := s.Marshal(res)
+				ok(t, err)
+
+				got, err := s.Unmarshal(data)
+				ok(t, err)
+
+				equals(t, res, got)
+			}
+
+			_, err := s.Unmarshal([]byte("garbage"))
+			assert(t, err != nil, "malformed data should fail to decode")
+		})
+	}
+}
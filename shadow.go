@@ -0,0 +1,35 @@
+package introspection
+
+import "context"
+
+// WithShadowMode makes the middleware report the requests it would reject instead of rejecting them, to measure the impact of
+// enforcement before turning it on. The decisions of WithEnforcement, whether or not it is passed, and of the Require middlewares
+// and Chain requirements behind the middleware are made as usual, but requests always proceed to the next handler as they would
+// without enforcement. Each would-be rejection is passed to Hooks.OnShadowDenial, marks the DecisionEvent of the request as
+// ShadowDenied and is exposed by MetaFromContext as Meta.ShadowDenial so handlers can log it.
+func WithShadowMode() Option {
+	return func(opt *Options) {
+		opt.shadow = true
+	}
+}
+
+// shadowDeny records that the request res belongs to would have been rejected with err. It reports whether res is in shadow mode,
+// in which case the request must proceed.
+func (r *result) shadowDeny(ctx context.Context, err error) bool {
+	if r.shadowHooks == nil {
+		return false
+	}
+
+	if r.meta.ShadowDenial == nil {
+		r.meta.ShadowDenial = err
+	}
+
+	r.shadowHooks.shadowDenial(ctx, err)
+	return true
+}
+
+// shadowed is shadowDeny for the result in ctx, if any
+func shadowed(ctx context.Context, err error) bool {
+	res, ok := ctx.Value(resKey).(*result)
+	return ok && res.shadowDeny(ctx, err)
+}
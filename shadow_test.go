@@ -0,0 +1,93 @@
+package introspection_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestShadowMode(t *testing.T) {
+	ts := scopeServer()
+	defer ts.Close()
+
+	var denials []error
+	hooks := intro.WithHooks(intro.Hooks{
+		OnShadowDenial: func(_ context.Context, err error) { denials = append(denials, err) },
+	})
+
+	events := make(chan intro.DecisionEvent, 1)
+
+	var reached bool
+	var meta intro.Meta
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		meta, _ = intro.MetaFromContext(r.Context())
+	})
+
+	h := intro.Introspection(ts.URL, intro.WithShadowMode(), intro.WithEnforcement(), hooks,
+		intro.WithEventStream(intro.NewEventStream(events, intro.DropOldest)),
+	)(intro.RequireScopes("write")(next))
+
+	tt := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "No Token", err: intro.ErrNoBearer},
+		{name: "Inactive", token: "inactive", err: intro.ErrInactive},
+		{name: "Missing Scope", token: "read", err: intro.ErrInsufficientScope},
+		{name: "Allowed", token: "read write"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			denials, reached, meta = nil, false, intro.Meta{}
+
+			equals(t, http.StatusOK, serveStatus(h, tc.token))
+			equals(t, true, reached)
+			equals(t, tc.err, meta.ShadowDenial)
+			equals(t, tc.err != nil, (<-events).ShadowDenied)
+
+			if tc.err == nil {
+				equals(t, 0, len(denials))
+				return
+			}
+
+			// the middleware and the requirement both deny inactive tokens
+			assert(t, len(denials) > 0, "the denial should have been reported")
+			equals(t, tc.err, denials[0])
+		})
+	}
+
+	t.Run("Enforced", func(t *testing.T) {
+		reached = false
+
+		enforced := intro.Introspection(ts.URL, intro.WithEnforcement())(intro.RequireScopes("write")(next))
+
+		equals(t, http.StatusForbidden, serveStatus(enforced, "read"))
+		equals(t, false, reached)
+	})
+}
+
+func TestShadowModeAuthFunc(t *testing.T) {
+	ts := scopeServer()
+	defer ts.Close()
+
+	var denials []error
+	hooks := intro.WithHooks(intro.Hooks{
+		OnShadowDenial: func(_ context.Context, err error) { denials = append(denials, err) },
+	})
+
+	auth, err := intro.NewChain(ts.URL, intro.WithShadowMode(), hooks).RequireScopes("write").AuthFunc()
+	ok(t, err)
+
+	ctx, err := auth(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer read")))
+	ok(t, err)
+
+	meta, _ := intro.MetaFromContext(ctx)
+	equals(t, intro.ErrInsufficientScope, meta.ShadowDenial)
+	equals(t, []error{intro.ErrInsufficientScope}, denials)
+}
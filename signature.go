@@ -0,0 +1,179 @@
+package introspection
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCoveredComponents are the components WithMessageSignature signs when none are given
+var defaultCoveredComponents = []string{"@method", "@target-uri", "content-digest", "date"}
+
+// messageSignature configures WithMessageSignature
+type messageSignature struct {
+	signer     crypto.Signer
+	alg        string
+	keyID      string
+	components []string
+}
+
+// WithMessageSignature signs every introspection request, including retries, with an HTTP Message Signature as per rfc9421.
+// A Content-Digest header (rfc9530) holding the SHA-256 digest of the body as sent and a Date header are added, then a signature
+// labelled sig1 covering coveredComponents, by default @method, @target-uri, content-digest and date, is created with signer and
+// sent along with keyID in the Signature and Signature-Input headers. Components are either derived components, @method,
+// @target-uri, @authority, @scheme, @path, @query and @request-target, or lower case header names.
+//
+// Requests are signed after the request modifiers ran, so headers they set can be covered. Ed25519 keys sign with ed25519,
+// P-256 ECDSA keys with ecdsa-p256-sha256 and RSA keys with rsa-pss-sha512, it panics for other keys.
+func WithMessageSignature(signer crypto.Signer, keyID string, coveredComponents ...string) Option {
+	alg, err := signatureAlgorithm(signer)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(coveredComponents) == 0 {
+		coveredComponents = defaultCoveredComponents
+	}
+
+	sig := &messageSignature{signer: signer, alg: alg, keyID: keyID, components: append([]string(nil), coveredComponents...)}
+
+	return func(opt *Options) {
+		opt.messageSignature = sig
+	}
+}
+
+// signatureAlgorithm returns the rfc9421 algorithm for the key of signer
+func signatureAlgorithm(signer crypto.Signer) (string, error) {
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		return "ed25519", nil
+	case *ecdsa.PublicKey:
+		if pub.Curve == elliptic.P256() {
+			return "ecdsa-p256-sha256", nil
+		}
+	case *rsa.PublicKey:
+		return "rsa-pss-sha512", nil
+	}
+
+	return "", fmt.Errorf("introspection: unsupported message signature key %T, use an Ed25519, a P-256 ECDSA or an RSA key", signer.Public())
+}
+
+// sign adds the Content-Digest, Date, Signature-Input and Signature headers to req
+func (s *messageSignature) sign(req *http.Request, now time.Time) error {
+	digest := sha256.New()
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(digest, body); err != nil {
+			return err
+		}
+	}
+
+	req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest.Sum(nil))+":")
+	req.Header.Set("Date", now.UTC().Format(http.TimeFormat))
+
+	var base strings.Builder
+	names := make([]string, len(s.components))
+	for i, c := range s.components {
+		c = strings.ToLower(c)
+
+		v, err := componentValue(req, c)
+		if err != nil {
+			return err
+		}
+
+		names[i] = strconv.Quote(c)
+		fmt.Fprintf(&base, "%q: %s\n", c, v)
+	}
+
+	params := "(" + strings.Join(names, " ") + ");created=" + strconv.FormatInt(now.Unix(), 10) + ";keyid=" + strconv.Quote(s.keyID) + ";alg=" + strconv.Quote(s.alg)
+	fmt.Fprintf(&base, "%q: %s", "@signature-params", params)
+
+	sig, err := s.signBase([]byte(base.String()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature-Input", "sig1="+params)
+	req.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(sig)+":")
+
+	return nil
+}
+
+func (s *messageSignature) signBase(base []byte) ([]byte, error) {
+	switch s.alg {
+	case "ed25519":
+		return s.signer.Sign(rand.Reader, base, crypto.Hash(0))
+	case "ecdsa-p256-sha256":
+		digest := sha256.Sum256(base)
+
+		der, err := s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+
+		return rawP256Signature(der)
+	default:
+		digest := sha512.Sum512(base)
+		return s.signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512})
+	}
+}
+
+// componentValue returns the value of the component c of req as it appears in the signature base, see rfc9421 section 2
+func componentValue(req *http.Request, c string) (string, error) {
+	switch c {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		u := *req.URL
+		if u.Path == "" {
+			// the request target of an empty path is /
+			u.Path = "/"
+		}
+		return u.String(), nil
+	case "@authority":
+		return strings.ToLower(req.URL.Host), nil
+	case "@scheme":
+		return strings.ToLower(req.URL.Scheme), nil
+	case "@path":
+		if p := req.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	}
+
+	if strings.HasPrefix(c, "@") {
+		return "", fmt.Errorf("introspection: unsupported message signature component %q", c)
+	}
+
+	values, ok := req.Header[http.CanonicalHeaderKey(c)]
+	if !ok {
+		return "", fmt.Errorf("introspection: message signature component %q is not present", c)
+	}
+
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+
+	return strings.Join(trimmed, ", "), nil
+}
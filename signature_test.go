@@ -0,0 +1,236 @@
+package introspection_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+// signedRequest is an introspection request as received by the fake authorization server
+type signedRequest struct {
+	method, targetURI string
+	header            http.Header
+	body              []byte
+}
+
+// verifyMessageSignature is a reference rfc9421 verifier for the signature labelled sig1 of r, it returns the covered
+// components and the created parameter
+func verifyMessageSignature(r signedRequest, pub crypto.PublicKey, keyID string) ([]string, int64, error) {
+	digest := sha256.Sum256(r.body)
+	if exp := "sha-256=:" + base64.StdEncoding.EncodeToString(digest[:]) + ":"; r.header.Get("Content-Digest") != exp {
+		return nil, 0, fmt.Errorf("content digest mismatch: %q", r.header.Get("Content-Digest"))
+	}
+
+	input := r.header.Get("Signature-Input")
+	if !strings.HasPrefix(input, "sig1=(") {
+		return nil, 0, fmt.Errorf("unexpected signature input: %q", input)
+	}
+
+	params := strings.TrimPrefix(input, "sig1=")
+	end := strings.Index(params, ")")
+	inner, rest := params[1:end], params[end+1:]
+
+	var components []string
+	var base strings.Builder
+	for _, item := range strings.Fields(inner) {
+		name, err := strconv.Unquote(item)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var v string
+		switch name {
+		case "@method":
+			v = r.method
+		case "@target-uri":
+			v = r.targetURI
+		default:
+			v = r.header.Get(name)
+		}
+
+		components = append(components, name)
+		fmt.Fprintf(&base, "\"%s\": %s\n", name, v)
+	}
+	fmt.Fprintf(&base, "\"@signature-params\": %s", params)
+
+	var created int64
+	var alg string
+	for _, p := range strings.Split(strings.TrimPrefix(rest, ";"), ";") {
+		kv := strings.SplitN(p, "=", 2)
+		switch kv[0] {
+		case "created":
+			created, _ = strconv.ParseInt(kv[1], 10, 64)
+		case "keyid":
+			if kv[1] != strconv.Quote(keyID) {
+				return nil, 0, fmt.Errorf("unexpected key id: %s", kv[1])
+			}
+		case "alg":
+			alg, _ = strconv.Unquote(kv[1])
+		}
+	}
+
+	sigHeader := r.header.Get("Signature")
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(sigHeader, "sig1=:"), ":"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	valid := false
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		valid = alg == "ed25519" && ed25519.Verify(key, []byte(base.String()), sig)
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256([]byte(base.String()))
+		valid = alg == "ecdsa-p256-sha256" && len(sig) == 64 &&
+			ecdsa.Verify(key, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	case *rsa.PublicKey:
+		h := sha512.Sum512([]byte(base.String()))
+		valid = alg == "rsa-pss-sha512" && rsa.VerifyPSS(key, crypto.SHA512, h[:], sig, &rsa.PSSOptions{SaltLength: 64}) == nil
+	}
+
+	if !valid {
+		return nil, 0, errors.New("invalid signature")
+	}
+
+	return components, created, nil
+}
+
+// signatureServer records the requests it receives and answers with an active result
+func signatureServer(requests *[]signedRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, signedRequest{method: r.Method, targetURI: "http://" + r.Host + r.RequestURI, header: r.Header, body: body})
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true}`))
+	}))
+}
+
+func TestMessageSignature(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	ok(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	ok(t, err)
+
+	now := time.Date(2024, 4, 25, 12, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name       string
+		signer     crypto.Signer
+		pub        crypto.PublicKey
+		components []string
+		opts       []intro.Option
+		exp        []string
+	}{
+		{name: "Ed25519", signer: edKey, pub: edPub, exp: []string{"@method", "@target-uri", "content-digest", "date"}},
+		{name: "ECDSA", signer: ecKey, pub: &ecKey.PublicKey, exp: []string{"@method", "@target-uri", "content-digest", "date"}},
+		{name: "RSA", signer: rsaKey, pub: &rsaKey.PublicKey, exp: []string{"@method", "@target-uri", "content-digest", "date"}},
+		{
+			name:       "Modified Header",
+			signer:     edKey,
+			pub:        edPub,
+			components: []string{"@method", "content-digest", "x-tenant"},
+			opts:       []intro.Option{intro.WithRequestModifier(func(r *http.Request) { r.Header.Set("X-Tenant", "acme") })},
+			exp:        []string{"@method", "content-digest", "x-tenant"},
+		},
+		{name: "Gzip", signer: edKey, pub: edPub, opts: []intro.Option{intro.WithRequestGzip()}, exp: []string{"@method", "@target-uri", "content-digest", "date"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []signedRequest
+			ts := signatureServer(&requests)
+			defer ts.Close()
+
+			opts := append([]intro.Option{intro.WithClock(introspectiontest.NewClock(now)), intro.WithMessageSignature(tc.signer, "test-key", tc.components...)}, tc.opts...)
+
+			res, err := intro.FromContext(introspectedContextAt(t, ts.URL, opts...))
+			ok(t, err)
+			assert(t, res.Active, "result should be active")
+
+			equals(t, 1, len(requests))
+
+			components, created, err := verifyMessageSignature(requests[0], tc.pub, "test-key")
+			ok(t, err)
+			equals(t, tc.exp, components)
+			equals(t, now.Unix(), created)
+		})
+	}
+}
+
+func TestMessageSignatureRetry(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	ok(t, err)
+
+	now := time.Date(2024, 4, 25, 12, 0, 0, 0, time.UTC)
+	clock := introspectiontest.NewClock(now)
+
+	var requests []signedRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, signedRequest{method: r.Method, targetURI: "http://" + r.Host + r.RequestURI, header: r.Header, body: body})
+
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true}`))
+	}))
+	defer ts.Close()
+
+	token := "expired"
+	creds := intro.TokenSourceCredentials(func(ctx context.Context) (string, error) {
+		t := token
+		token = "fresh"
+		clock.Advance(time.Second)
+		return t, nil
+	})
+
+	_, err = intro.FromContext(introspectedContextAt(t, ts.URL, intro.WithClock(clock), intro.WithCredentials(creds), intro.WithMessageSignature(key, "test-key", "@method", "@target-uri", "authorization", "content-digest")))
+	ok(t, err)
+
+	equals(t, 2, len(requests))
+
+	for i, r := range requests {
+		_, created, err := verifyMessageSignature(r, pub, "test-key")
+		ok(t, err)
+		equals(t, now.Add(time.Duration(i+1)*time.Second).Unix(), created)
+	}
+}
+
+func TestMessageSignatureUnsupportedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	ok(t, err)
+
+	defer func() {
+		assert(t, recover() != nil, "an unsupported key should panic")
+	}()
+
+	intro.WithMessageSignature(key, "test-key")
+}
@@ -0,0 +1,62 @@
+package introspection
+
+import (
+	"context"
+	"time"
+)
+
+// WithSlidingCacheExpiration renews cached results on use: an entry expires once it wasn't used for idle, but never later than max
+// after it was retrieved nor after the token expires. It replaces the expiry passed to WithCache, continuously used tokens then
+// only pay for an introspection every max. Renewal needs a cache implementing Toucher, like those of this package, with other
+// caches entries expire idle after they were stored.
+func WithSlidingCacheExpiration(idle, max time.Duration) Option {
+	return func(opt *Options) {
+		opt.slidingIdle = idle
+		opt.slidingMax = max
+	}
+}
+
+// slidingTTL returns how long res may remain cached from now: the idle window, capped by the maximum lifetime and the token's expiry
+func slidingTTL(res *Result, now time.Time, opt *Options) time.Duration {
+	exp := opt.slidingIdle
+
+	if left := res.RetrievedAt.Add(opt.slidingMax).Sub(now); left < exp {
+		exp = left
+	}
+
+	if until, ok := res.EffectiveExpiry(res.RetrievedAt); ok {
+		if left := until.Add(opt.clockSkew).Sub(now); left < exp {
+			exp = left
+		}
+	}
+
+	if opt.respectCacheControl {
+		exp = capCacheControl(res, exp, now)
+	}
+
+	return exp
+}
+
+// touch renews the cache entry of res under key, see WithSlidingCacheExpiration. It returns when the entry now expires and whether
+// it was renewed.
+func touch(ctx context.Context, key string, res *Result, opt *Options) (time.Time, bool) {
+	t, ok := opt.cache.(Toucher)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	now := opt.clock.Now()
+
+	exp := slidingTTL(res, now, opt)
+	if exp <= 0 {
+		return time.Time{}, false
+	}
+
+	renewed := false
+	cacheOp(ctx, "touch", key, opt, func() error {
+		renewed = t.Touch(key, exp)
+		return nil
+	})
+
+	return now.Add(exp), renewed
+}
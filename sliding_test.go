@@ -0,0 +1,121 @@
+package introspection_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestSlidingCacheExpiration(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		data := map[string]interface{}{"active": true}
+		if r.PostFormValue("token") == "short-lived" {
+			data["exp"] = start.Add(150 * time.Second).Unix()
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer ts.Close()
+
+	setup := func(cache func(clock intro.Clock) intro.Cache) (*introspectiontest.Clock, http.Handler) {
+		hits = 0
+		clock := introspectiontest.NewClock(start)
+
+		h := intro.Introspection(ts.URL,
+			intro.WithClock(clock),
+			intro.WithCache(cache(clock), time.Hour),
+			intro.WithSlidingCacheExpiration(time.Minute, 5*time.Minute),
+		)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		return clock, h
+	}
+
+	inMemory := func(clock intro.Clock) intro.Cache { return intro.NewInMemoryCache(intro.CacheClock(clock)) }
+
+	t.Run("Renewed On Access", func(t *testing.T) {
+		clock, h := setup(inMemory)
+
+		for i := 0; i < 4; i++ {
+			serveStatus(h, "token")
+			clock.Advance(50 * time.Second)
+		}
+
+		equals(t, 1, hits)
+	})
+
+	t.Run("Evicted When Idle", func(t *testing.T) {
+		clock, h := setup(inMemory)
+
+		serveStatus(h, "token")
+		clock.Advance(50 * time.Second)
+		serveStatus(h, "token")
+		clock.Advance(time.Minute)
+		serveStatus(h, "token")
+
+		equals(t, 2, hits)
+	})
+
+	t.Run("Max Lifetime", func(t *testing.T) {
+		clock, h := setup(inMemory)
+
+		for i := 0; i < 6; i++ {
+			serveStatus(h, "token")
+			clock.Advance(50 * time.Second)
+		}
+		equals(t, 1, hits)
+
+		// 300s after retrieval
+		serveStatus(h, "token")
+		equals(t, 2, hits)
+	})
+
+	t.Run("Token Expiry", func(t *testing.T) {
+		clock, h := setup(inMemory)
+
+		for i := 0; i < 3; i++ {
+			serveStatus(h, "short-lived")
+			clock.Advance(50 * time.Second)
+		}
+		equals(t, 1, hits)
+
+		// the token expired 150s after retrieval
+		serveStatus(h, "short-lived")
+		equals(t, 2, hits)
+	})
+
+	t.Run("Without Toucher", func(t *testing.T) {
+		clock, h := setup(func(clock intro.Clock) intro.Cache {
+			return struct{ intro.Cache }{intro.NewInMemoryCache(intro.CacheClock(clock))}
+		})
+
+		serveStatus(h, "token")
+		clock.Advance(50 * time.Second)
+		serveStatus(h, "token")
+		clock.Advance(10 * time.Second)
+		serveStatus(h, "token")
+
+		equals(t, 2, hits)
+	})
+
+	t.Run("Sharded", func(t *testing.T) {
+		clock, h := setup(func(clock intro.Clock) intro.Cache { return intro.NewShardedCache(4, intro.CacheClock(clock)) })
+
+		for i := 0; i < 4; i++ {
+			serveStatus(h, "token")
+			clock.Advance(50 * time.Second)
+		}
+
+		equals(t, 1, hits)
+	})
+}
@@ -0,0 +1,93 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSoftDeadline is returned by FromContext when the introspection did not complete within the soft deadline and no degraded
+// result is configured, see WithSoftDeadline
+var ErrSoftDeadline = errors.New("introspection did not complete within the soft deadline")
+
+// WithSoftDeadline bounds the time requests wait for the introspection endpoint: when the lookup hasn't completed after d the
+// request proceeds with the result degraded returns, or ErrSoftDeadline if degraded is nil, while the introspection finishes in
+// the background to warm the cache for the next request with the token. This trades consistency for tail latency, degraded is
+// typically a pending, inactive result or one granting a minimal set of scopes. Its result is validated like any other, but never
+// cached. Combine with WithMicroCache to share a background introspection among concurrent requests with the same token. Without
+// WithCache or WithMicroCache there is nothing to warm, the introspection is then cancelled once the deadline passes.
+func WithSoftDeadline(d time.Duration, degraded func(ctx context.Context, token string) (*Result, error)) Option {
+	return func(opt *Options) {
+		opt.softDeadline = d
+		opt.degraded = degraded
+	}
+}
+
+type lookupOutcome struct {
+	res *Result
+	src Source
+	err error
+}
+
+// softLookupResult is microLookupResult bounded by the soft deadline, see WithSoftDeadline
+func softLookupResult(ctx context.Context, token string, opt *Options) (*Result, Source, error) {
+	if opt.softDeadline <= 0 {
+		return microLookupResult(ctx, token, opt)
+	}
+
+	// the lookup only continues in the background if its result warms a cache
+	warms := opt.cache != nil || opt.microCache != nil
+
+	var lookupCtx context.Context
+	var stop func()
+	if warms {
+		var ok bool
+		if lookupCtx, stop, ok = backgroundContext(ctx, opt); !ok {
+			// shutting down, the lookup must not outlive the request
+			return microLookupResult(ctx, token, opt)
+		}
+	} else {
+		lookupCtx, stop = context.WithCancel(ctx)
+	}
+
+	expired := make(chan struct{})
+	timer := opt.clock.AfterFunc(opt.softDeadline, func() { close(expired) })
+	defer timer.Stop()
+
+	// buffered so the background lookup never blocks once the request has moved on
+	done := make(chan lookupOutcome, 1)
+	go func() {
+		defer stop()
+
+		res, src, err := microLookupResult(lookupCtx, token, opt)
+		done <- lookupOutcome{res: res, src: src, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.res, o.src, o.err
+	case <-ctx.Done():
+		return nil, SourceEndpoint, ctx.Err()
+	case <-expired:
+	}
+
+	if !warms {
+		stop()
+	}
+
+	if opt.degraded == nil {
+		return nil, SourceLocal, ErrSoftDeadline
+	}
+
+	res, err := opt.degraded(ctx, token)
+	if err != nil {
+		return nil, SourceLocal, err
+	}
+
+	if res == nil {
+		return nil, SourceLocal, ErrSoftDeadline
+	}
+
+	useScopeOptions(res, opt)
+	return res, SourceLocal, nil
+}
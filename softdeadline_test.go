@@ -0,0 +1,138 @@
+package introspection_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+// notifyingCache signals every Store on stored
+type notifyingCache struct {
+	intro.Cache
+	stored chan struct{}
+}
+
+func (c *notifyingCache) Store(key string, res *intro.Result, exp time.Duration) {
+	c.Cache.Store(key, res, exp)
+	c.stored <- struct{}{}
+}
+
+func TestSoftDeadline(t *testing.T) {
+	received, release := make(chan struct{}, 1), make(chan struct{})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"active": true, "scope": "read write"}`))
+	}))
+	defer ts.Close()
+
+	degraded := func(context.Context, string) (*intro.Result, error) {
+		return &intro.Result{Active: true, Scope: "read"}, nil
+	}
+
+	type outcome struct {
+		res  *intro.Result
+		meta intro.Meta
+		err  error
+	}
+
+	lookup := func(opts ...intro.Option) chan outcome {
+		out := make(chan outcome, 1)
+		go func() {
+			ctx := introspectedContextAt(t, ts.URL, opts...)
+			res, err := intro.FromContext(ctx)
+			meta, _ := intro.MetaFromContext(ctx)
+			out <- outcome{res: res, meta: meta, err: err}
+		}()
+
+		return out
+	}
+
+	t.Run("Degraded And Warmed", func(t *testing.T) {
+		clock := introspectiontest.NewClock(time.Now())
+		cache := &notifyingCache{Cache: intro.NewInMemoryCache(), stored: make(chan struct{}, 1)}
+		opts := []intro.Option{intro.WithClock(clock), intro.WithCache(cache, time.Minute), intro.WithSoftDeadline(50*time.Millisecond, degraded)}
+
+		out := lookup(opts...)
+		<-received
+		clock.Advance(50 * time.Millisecond)
+
+		o := <-out
+		ok(t, o.err)
+		equals(t, "read", o.res.Scope)
+		equals(t, intro.SourceLocal, o.meta.Source)
+
+		release <- struct{}{}
+		<-cache.stored
+
+		o = <-lookup(opts...)
+		ok(t, o.err)
+		equals(t, "read write", o.res.Scope)
+		equals(t, true, o.meta.CacheHit)
+	})
+
+	t.Run("No Degraded Result", func(t *testing.T) {
+		clock := introspectiontest.NewClock(time.Now())
+
+		out := lookup(intro.WithClock(clock), intro.WithSoftDeadline(50*time.Millisecond, nil))
+		<-received
+		clock.Advance(50 * time.Millisecond)
+
+		equals(t, intro.ErrSoftDeadline, (<-out).err)
+		release <- struct{}{}
+	})
+
+	t.Run("No Cache Cancelled", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the connection is only watched for a disconnect once the body is read
+			r.ParseForm()
+
+			received <- struct{}{}
+			<-r.Context().Done()
+			close(cancelled)
+		}))
+		defer slow.Close()
+
+		clock := introspectiontest.NewClock(time.Now())
+
+		out := make(chan error, 1)
+		go func() {
+			_, err := intro.FromContext(introspectedContextAt(t, slow.URL, intro.WithClock(clock), intro.WithSoftDeadline(50*time.Millisecond, nil)))
+			out <- err
+		}()
+
+		<-received
+		clock.Advance(50 * time.Millisecond)
+
+		equals(t, intro.ErrSoftDeadline, <-out)
+
+		select {
+		case <-cancelled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the introspection should be cancelled once the deadline passes without a cache to warm")
+		}
+	})
+
+	t.Run("Within Deadline", func(t *testing.T) {
+		clock := introspectiontest.NewClock(time.Now())
+
+		out := lookup(intro.WithClock(clock), intro.WithSoftDeadline(50*time.Millisecond, degraded))
+		<-received
+		clock.Advance(49 * time.Millisecond)
+		release <- struct{}{}
+
+		o := <-out
+		ok(t, o.err)
+		equals(t, "read write", o.res.Scope)
+		equals(t, intro.SourceEndpoint, o.meta.Source)
+	})
+}
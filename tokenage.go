@@ -0,0 +1,69 @@
+package introspection
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrTokenTooOld is returned by FromContext when an active token was issued longer ago than allowed by WithMaxTokenAge,
+// and by the check of RequireMaxTokenAge
+var ErrTokenTooOld = errors.New("token is too old")
+
+// tokenAgePolicy is the configuration of WithMaxTokenAge and RequireMaxTokenAge
+type tokenAgePolicy struct {
+	maxAge       time.Duration
+	allowMissing bool
+}
+
+// WithMaxTokenAge rejects active tokens whose iat claim is more than d in the past, per the clock set by WithClock and
+// tolerating the skew set by WithClockSkew, with ErrTokenTooOld, e.g. to force clients to authenticate again. Tokens lacking
+// iat are rejected with a MissingClaimError unless allowMissingIat is set. RequireMaxTokenAge applies the check to some routes only.
+func WithMaxTokenAge(d time.Duration, allowMissingIat bool) Option {
+	return func(opt *Options) {
+		opt.tokenAge = &tokenAgePolicy{maxAge: d, allowMissing: allowMissingIat}
+	}
+}
+
+// RequireMaxTokenAge returns a middleware that rejects requests unless the introspection result in their context is active and
+// its token passes the check of WithMaxTokenAge, using the clock and skew of the Introspection middleware. It must be used behind
+// the Introspection middleware, otherwise every request is rejected.
+func RequireMaxTokenAge(d time.Duration, allowMissingIat bool) func(http.Handler) http.Handler {
+	return requirement(requireMaxTokenAge(d, allowMissingIat))
+}
+
+func requireMaxTokenAge(d time.Duration, allowMissingIat bool) func(context.Context) error {
+	p := tokenAgePolicy{maxAge: d, allowMissing: allowMissingIat}
+
+	return func(ctx context.Context) error {
+		res, err := Authorize(ctx)
+		if err != nil {
+			return err
+		}
+
+		clock, skew := SystemClock, time.Duration(0)
+		if val, ok := ctx.Value(resKey).(*result); ok && val.clock != nil {
+			clock, skew = val.clock, val.clockSkew
+		}
+
+		return p.check(res, clock.Now(), skew)
+	}
+}
+
+func (p *tokenAgePolicy) check(res *Result, now time.Time, skew time.Duration) error {
+	iat, ok := numericDateClaim(res, "iat")
+	if !ok {
+		if p.allowMissing {
+			return nil
+		}
+
+		return &MissingClaimError{Name: "iat"}
+	}
+
+	if now.After(time.Unix(iat, 0).Add(p.maxAge).Add(skew)) {
+		return ErrTokenTooOld
+	}
+
+	return nil
+}
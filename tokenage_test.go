@@ -0,0 +1,95 @@
+package introspection_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	intro "github.com/srikrsna/oauth-introspection"
+	"github.com/srikrsna/oauth-introspection/introspectiontest"
+)
+
+func TestMaxTokenAge(t *testing.T) {
+	iat := time.Unix(1500000000, 0)
+
+	tt := []struct {
+		name string
+		now  time.Time
+		data map[string]interface{}
+		opts []intro.Option
+		err  error
+	}{
+		{name: "Fresh", now: iat.Add(time.Minute), data: map[string]interface{}{"active": true, "iat": iat.Unix()}},
+		{name: "At Limit", now: iat.Add(5 * time.Minute), data: map[string]interface{}{"active": true, "iat": iat.Unix()}},
+		{name: "Past Limit", now: iat.Add(5*time.Minute + time.Second), data: map[string]interface{}{"active": true, "iat": iat.Unix()}, err: intro.ErrTokenTooOld},
+		{name: "Within Skew", now: iat.Add(5*time.Minute + 10*time.Second), data: map[string]interface{}{"active": true, "iat": iat.Unix()}, opts: []intro.Option{intro.WithClockSkew(10 * time.Second)}},
+		{name: "Past Skew", now: iat.Add(5*time.Minute + 11*time.Second), data: map[string]interface{}{"active": true, "iat": iat.Unix()}, opts: []intro.Option{intro.WithClockSkew(10 * time.Second)}, err: intro.ErrTokenTooOld},
+		{name: "Fractional Iat Past Limit", now: iat.Add(5*time.Minute + 500*time.Millisecond), data: map[string]interface{}{"active": true, "iat": 1500000000.9}, err: intro.ErrTokenTooOld},
+		{name: "Missing Iat", now: iat, data: map[string]interface{}{"active": true}, err: &intro.MissingClaimError{Name: "iat"}},
+		{name: "Missing Iat Allowed", now: iat, data: map[string]interface{}{"active": true}, opts: []intro.Option{intro.WithMaxTokenAge(5*time.Minute, true)}},
+		{name: "Inactive", now: iat.Add(time.Hour), data: map[string]interface{}{"active": false, "iat": iat.Unix()}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]intro.Option{intro.WithClock(introspectiontest.NewClock(tc.now)), intro.WithMaxTokenAge(5*time.Minute, false)}, tc.opts...)
+
+			_, err := intro.FromContext(introspectedContext(t, tc.data, opts...))
+
+			equals(t, tc.err, err)
+		})
+	}
+}
+
+func TestRequireMaxTokenAge(t *testing.T) {
+	iat := time.Unix(1500000000, 0)
+	clock := introspectiontest.NewClock(iat.Add(10 * time.Minute))
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.PostFormValue("token") == "no-iat" {
+			w.Write([]byte(`{"active": true}`))
+			return
+		}
+
+		w.Write([]byte(`{"active": true, "iat": 1500000000}`))
+	}))
+	defer ts.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	mux := http.NewServeMux()
+	mux.Handle("/profile", next)
+	mux.Handle("/transfer", intro.RequireMaxTokenAge(5*time.Minute, false)(next))
+	mux.Handle("/settings", intro.RequireMaxTokenAge(15*time.Minute, true)(next))
+
+	h := intro.Introspection(ts.URL, intro.WithClock(clock))(mux)
+
+	serve := func(path, token string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	equals(t, http.StatusOK, serve("/profile", "token"))
+	equals(t, http.StatusUnauthorized, serve("/transfer", "token"))
+	equals(t, http.StatusOK, serve("/settings", "token"))
+	equals(t, http.StatusUnauthorized, serve("/transfer", "no-iat"))
+	equals(t, http.StatusOK, serve("/settings", "no-iat"))
+
+	clock.Advance(5 * time.Minute)
+	equals(t, http.StatusOK, serve("/settings", "token"))
+
+	clock.Advance(time.Second)
+	equals(t, http.StatusUnauthorized, serve("/settings", "token"))
+
+	chained, err := intro.NewChain(ts.URL, intro.WithClock(clock)).RequireMaxTokenAge(time.Hour, false).Handler(next)
+	ok(t, err)
+	equals(t, http.StatusOK, serveStatus(chained, "token"))
+}
@@ -0,0 +1,78 @@
+package introspection
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TokenUseError is returned by FromContext when an active result is not of a token use allowed by WithTokenUsePolicy,
+// e.g. an ID token presented to an API
+type TokenUseError struct {
+	// Claim is the claim the token use was read from, it is empty when the result carried none of the checked claims
+	Claim string
+	// Value is the token use the result carried
+	Value string
+}
+
+func (e *TokenUseError) Error() string {
+	if e.Claim == "" {
+		return "token use is missing"
+	}
+
+	return fmt.Sprintf("token use %q is not allowed", e.Value)
+}
+
+// TokenUsePolicy configures WithTokenUsePolicy
+type TokenUsePolicy struct {
+	// Allowed lists the accepted token uses, e.g. access, compared case insensitively
+	Allowed []string
+	// Claims are the claims the token use is read from, the first present one is used. Defaults to token_use, then typ.
+	Claims []string
+	// AllowMissing accepts results carrying none of Claims, they are rejected by default
+	AllowMissing bool
+}
+
+// WithRequiredTokenUse rejects active results whose token_use, or when it is absent typ, claim is not one of values with a
+// TokenUseError, e.g. to keep clients from presenting ID or refresh tokens where access tokens are expected. Results carrying
+// neither claim are rejected as well, use WithTokenUsePolicy to configure the claims and accept them.
+func WithRequiredTokenUse(values ...string) Option {
+	return WithTokenUsePolicy(TokenUsePolicy{Allowed: values})
+}
+
+// WithTokenUsePolicy rejects active results whose token use is not allowed by p with a TokenUseError, see WithRequiredTokenUse
+func WithTokenUsePolicy(p TokenUsePolicy) Option {
+	p.Allowed = append([]string(nil), p.Allowed...)
+	if len(p.Claims) == 0 {
+		p.Claims = []string{"token_use", "typ"}
+	} else {
+		p.Claims = append([]string(nil), p.Claims...)
+	}
+
+	return WithResultValidator(func(_ context.Context, res *Result) error {
+		return p.check(res)
+	})
+}
+
+func (p *TokenUsePolicy) check(res *Result) error {
+	for _, claim := range p.Claims {
+		if _, ok := res.Optionals[claim]; !ok {
+			continue
+		}
+
+		use := res.stringClaim(claim)
+		for _, allowed := range p.Allowed {
+			if strings.EqualFold(use, allowed) {
+				return nil
+			}
+		}
+
+		return &TokenUseError{Claim: claim, Value: use}
+	}
+
+	if p.AllowMissing {
+		return nil
+	}
+
+	return &TokenUseError{}
+}
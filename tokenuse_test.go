@@ -0,0 +1,38 @@
+package introspection_test
+
+import (
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestRequiredTokenUse(t *testing.T) {
+	tt := []struct {
+		name string
+		data map[string]interface{}
+		opt  intro.Option
+		err  error
+	}{
+		{name: "Access", data: map[string]interface{}{"active": true, "token_use": "access"}, opt: intro.WithRequiredTokenUse("access")},
+		{name: "ID", data: map[string]interface{}{"active": true, "token_use": "id"}, opt: intro.WithRequiredTokenUse("access"), err: &intro.TokenUseError{Claim: "token_use", Value: "id"}},
+		{name: "Refresh", data: map[string]interface{}{"active": true, "typ": "Refresh"}, opt: intro.WithRequiredTokenUse("access", "at+jwt"), err: &intro.TokenUseError{Claim: "typ", Value: "Refresh"}},
+		{name: "Typ Fallback", data: map[string]interface{}{"active": true, "typ": "AT+JWT"}, opt: intro.WithRequiredTokenUse("access", "at+jwt")},
+		{name: "Token Use Preferred", data: map[string]interface{}{"active": true, "token_use": "id", "typ": "access"}, opt: intro.WithRequiredTokenUse("access"), err: &intro.TokenUseError{Claim: "token_use", Value: "id"}},
+		{name: "Missing", data: map[string]interface{}{"active": true}, opt: intro.WithRequiredTokenUse("access"), err: &intro.TokenUseError{}},
+		{name: "Missing Allowed", data: map[string]interface{}{"active": true}, opt: intro.WithTokenUsePolicy(intro.TokenUsePolicy{Allowed: []string{"access"}, AllowMissing: true})},
+		{
+			name: "Configured Claims",
+			data: map[string]interface{}{"active": true, "token_use": "id", "use": "access"},
+			opt:  intro.WithTokenUsePolicy(intro.TokenUsePolicy{Allowed: []string{"access"}, Claims: []string{"use"}}),
+		},
+		{name: "Inactive", data: map[string]interface{}{"active": false, "token_use": "id"}, opt: intro.WithRequiredTokenUse("access")},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := intro.FromContext(introspectedContext(t, tc.data, tc.opt))
+
+			equals(t, tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package introspection
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"time"
+)
+
+// WithAddressOverride makes the package built client connect to addr, a host:port, whatever the host of the endpoint, e.g. to
+// reach an authorization server behind a load balancer only reachable by IP that routes by host name. Requests keep the host of the
+// endpoint URL in their Host header and TLS server name, and certificates are verified against it. It applies to every endpoint of
+// WithEndpointPool alike. Pass the same option to EndpointFromDiscovery for discovery requests. It panics when used with a caller
+// supplied Client.
+func WithAddressOverride(addr string) Option {
+	return func(opt *Options) {
+		opt.dialAddress = addr
+	}
+}
+
+// overrideDial returns a DialContext function connecting to addr instead of the address it is called with
+func overrideDial(addr string) func(ctx context.Context, network, _ string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// usesCustomTransport reports whether the package built client needs the transport returned by customTransport
+func usesCustomTransport(opt *Options) bool {
+	return opt.pins != nil || opt.clientCertificate != nil || opt.dialAddress != ""
+}
+
+// customTransport returns a clone of http.DefaultTransport dialing the address override, presenting the client certificate and
+// checking the pins of opt
+func customTransport(opt *Options) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = new(tls.Config)
+	}
+
+	if opt.dialAddress != "" {
+		t.DialContext = overrideDial(opt.dialAddress)
+	}
+
+	if opt.clientCertificate != nil {
+		t.TLSClientConfig.Certificates = []tls.Certificate{*opt.clientCertificate}
+	}
+
+	if pins := opt.pins; pins != nil {
+		t.TLSClientConfig.VerifyPeerCertificate = func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, chain := range verifiedChains {
+				for _, cert := range chain {
+					if pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+						return nil
+					}
+				}
+			}
+
+			return ErrPinMismatch
+		}
+	}
+
+	return t
+}
+
+// discoveryClient returns the client for discovery requests, connecting as configured by opts
+func discoveryClient(opts []Option) *http.Client {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	if opt, _ := applyOptions("", opts); usesCustomTransport(&opt) {
+		client.Transport = customTransport(&opt)
+	}
+
+	return client
+}
@@ -0,0 +1,72 @@
+package introspection_test
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	intro "github.com/srikrsna/oauth-introspection"
+)
+
+func TestAddressOverride(t *testing.T) {
+	ca := newTestCA(t)
+
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}
+	defer func() { http.DefaultTransport = defaultTransport }()
+
+	var host, serverName string
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, serverName = r.Host, r.TLS.ServerName
+
+		w.Header().Add("Content-Type", "application/json")
+
+		if r.URL.Path == "/.well-known/openid-configuration" {
+			w.Write([]byte(`{"introspection_endpoint": "https://` + r.Host + `/introspect"}`))
+			return
+		}
+
+		w.Write([]byte(`{"active": true}`))
+	})
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "as.test")}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	addr := ts.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+	logical := "https://as.test:" + port
+
+	override := intro.WithAddressOverride(addr)
+
+	t.Run("Introspection", func(t *testing.T) {
+		res, err := intro.FromContext(introspectedContextAt(t, logical+"/introspect", override))
+
+		ok(t, err)
+		equals(t, true, res.Active)
+		equals(t, "as.test:"+port, host)
+		equals(t, "as.test", serverName)
+	})
+
+	t.Run("Discovery", func(t *testing.T) {
+		endpoint, err := intro.EndpointFromDiscovery(logical, override)
+
+		ok(t, err)
+		equals(t, logical+"/introspect", endpoint)
+		equals(t, "as.test", serverName)
+	})
+
+	t.Run("Certificate Checked Against Logical Name", func(t *testing.T) {
+		_, err := intro.FromContext(introspectedContextAt(t, "https://other.test:"+port+"/introspect", override))
+
+		assert(t, err != nil, "a certificate for another name should be rejected")
+	})
+
+	t.Run("Without Override", func(t *testing.T) {
+		_, err := intro.FromContext(introspectedContextAt(t, logical+"/introspect"))
+
+		assert(t, err != nil, "the logical name should not resolve")
+	})
+}
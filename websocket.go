@@ -0,0 +1,83 @@
+package introspection
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const wsProtocolsKey = resKeyType(2)
+
+// WebSocketProtocols describes the Sec-WebSocket-Protocol entries of an upgrade request whose token was taken from that header
+type WebSocketProtocols struct {
+	// Token holds the entries that carried the token, either the prefix followed by the token or a single prefixed entry
+	Token []string
+	// Remaining holds the other entries in their original order, the handler should select the protocol it echoes back from these
+	Remaining []string
+}
+
+// WithWebSocketProtocolToken lets WebSocket upgrade requests without an Authorization header carry the token in Sec-WebSocket-Protocol,
+// as browsers can't set headers on WebSocket connections. An entry equal to prefix marks the next entry as the token ("bearer, <token>"),
+// an entry starting with prefix carries the token after it ("access_token.<token>"). Non upgrade requests are unaffected.
+// Use WebSocketProtocolsFromContext to learn which entries remain to be negotiated.
+func WithWebSocketProtocolToken(prefix string) Option {
+	return func(opt *Options) {
+		opt.wsProtocolPrefix = prefix
+	}
+}
+
+// WebSocketProtocolsFromContext returns the Sec-WebSocket-Protocol entries of the request if its token was taken from them
+func WebSocketProtocolsFromContext(ctx context.Context) (*WebSocketProtocols, bool) {
+	p, ok := ctx.Value(wsProtocolsKey).(*WebSocketProtocols)
+	return p, ok
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// headerHasToken reports whether the comma separated values of header h contain token, compared case insensitively
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// webSocketProtocolToken extracts the token from the Sec-WebSocket-Protocol entries of r
+func webSocketProtocolToken(r *http.Request, prefix string) (string, *WebSocketProtocols, bool) {
+	var entries []string
+	for _, v := range r.Header["Sec-Websocket-Protocol"] {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	for i, e := range entries {
+		var token string
+		n := 1
+
+		switch {
+		case e == prefix && i+1 < len(entries):
+			token, n = entries[i+1], 2
+		case e != prefix && strings.HasPrefix(e, prefix):
+			token = e[len(prefix):]
+		default:
+			continue
+		}
+
+		return token, &WebSocketProtocols{
+			Token:     entries[i : i+n],
+			Remaining: append(append([]string(nil), entries[:i]...), entries[i+n:]...),
+		}, true
+	}
+
+	return "", nil, false
+}